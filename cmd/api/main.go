@@ -18,6 +18,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -30,10 +31,15 @@ import (
 	"github.com/go-chi/cors"
 
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/handlers"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/mail"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/oidc"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository/postgres"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/storage"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/worker"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
 )
 
@@ -59,6 +65,24 @@ func main() {
 		"git_commit": gitCommit,
 	}).Info("Starting Tiny School Hub API")
 
+	// Load access token signing keys
+	signingKeys, err := loadSigningKeys(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load JWT signing keys")
+	}
+
+	// Load password policy
+	passwordPolicy, err := auth.NewPasswordPolicy(cfg.Password.MinLength, cfg.Password.BlocklistFile, cfg.Password.BreachedDir)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load password policy")
+	}
+
+	// Load the identity providers of schools that log in with OpenID Connect
+	oidcProviders, err := loadOIDCProviders(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load OIDC providers")
+	}
+
 	// Initialize database
 	db, err := postgres.NewDB(cfg.Database.URL)
 	if err != nil {
@@ -80,15 +104,89 @@ func main() {
 	classRepo := postgres.NewClassRepo(db)
 	memberRepo := postgres.NewClassMemberRepo(db)
 	photoRepo := postgres.NewPhotoRepo(db)
-	_ = postgres.NewAbsenceRepo(db)      // TODO: use in handlers
-	_ = postgres.NewMessageRepo(db)      // TODO: use in handlers
-	_ = postgres.NewAnnouncementRepo(db) // TODO: use in handlers
+	absenceRepo := postgres.NewAbsenceRepo(db)
+	messageRepo := postgres.NewMessageRepo(db)
+	announcementRepo := postgres.NewAnnouncementRepo(db)
 	tokenRepo := postgres.NewRefreshTokenRepo(db)
+	invitationRepo := postgres.NewRoleInvitationRepo(db)
+	roleChangeRepo := postgres.NewRoleChangeRepo(db)
+	inviteRepo := postgres.NewClassInviteRepo(db)
+	joinRequestRepo := postgres.NewClassJoinRequestRepo(db)
+	storageDeletionRepo := postgres.NewStorageDeletionRepo(db)
+	securityEventRepo := postgres.NewSecurityEventRepo(db)
+	sessionRepo := postgres.NewSessionRepo(db)
+	userTokenRepo := postgres.NewUserTokenRepo(db)
+	mfaRepo := postgres.NewMFARepo(db)
+	mfaChallengeRepo := postgres.NewMFAChallengeRepo(db)
+	loginFailureRepo := postgres.NewLoginFailureRepo(db)
+	identityRepo := postgres.NewUserIdentityRepo(db)
+	oidcStateRepo := postgres.NewOIDCLoginStateRepo(db)
+	rateLimitRepo := postgres.NewRateLimitRepo(db)
+	webAuthnCredentialRepo := postgres.NewWebAuthnCredentialRepo(db)
+	webAuthnChallengeRepo := postgres.NewWebAuthnChallengeRepo(db)
+	apiKeyRepo := postgres.NewAPIKeyRepo(db)
+	revocationRepo := postgres.NewAccessTokenRevocationRepo(db)
+
+	mailer := mail.New(&cfg.Mail, logger)
+
+	// Access token revocations are checked in memory; impersonation tokens
+	// may outlive regular ones
+	tokenLifetime := max(cfg.JWT.AccessExpiry, cfg.Auth.ImpersonationExpiry)
+	tokenRevocations := middleware.NewTokenRevocations(revocationRepo, tokenLifetime, cfg.JWT.RevocationRefreshInterval, logger)
+	if err := tokenRevocations.Load(context.Background()); err != nil {
+		logger.WithError(err).Fatal("Failed to load access token revocations")
+	}
+
+	// Storage cleanup is shared by handlers and its own retry loop
+	storageCleaner := worker.NewStorageCleaner(storageDeletionRepo, storageClient, cfg.Storage.CleanupInterval, logger)
+	photoProcessor := worker.NewPhotoProcessor(photoRepo, storageClient, cfg.Photos.ProcessInterval, logger)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userRepo, profileRepo, tokenRepo, cfg, logger)
+	authHandler := handlers.NewAuthHandler(userRepo, profileRepo, tokenRepo, sessionRepo, invitationRepo, roleChangeRepo, securityEventRepo, userTokenRepo, mfaRepo, mfaChallengeRepo, loginFailureRepo, mailer, signingKeys, passwordPolicy, cfg, logger)
+	oidcHandler := handlers.NewOIDCHandler(authHandler, userRepo, profileRepo, roleChangeRepo, securityEventRepo, identityRepo, oidcStateRepo, oidcProviders, cfg, logger)
+	magicLinkHandler := handlers.NewMagicLinkHandler(authHandler, userRepo, userTokenRepo, rateLimitRepo, mailer, cfg, logger)
+	passkeyHandler := handlers.NewPasskeyHandler(authHandler, userRepo, profileRepo, webAuthnCredentialRepo, webAuthnChallengeRepo, securityEventRepo, cfg, logger)
 	classHandler := handlers.NewClassHandler(classRepo, memberRepo, cfg, logger)
-	photoHandler := handlers.NewPhotoHandler(photoRepo, memberRepo, storageClient, cfg, logger)
+	photoHandler := handlers.NewPhotoHandler(photoRepo, memberRepo, storageClient, storageCleaner, photoProcessor, cfg, logger)
+	absenceHandler := handlers.NewAbsenceHandler(absenceRepo, memberRepo, profileRepo, cfg, logger)
+	messageHandler := handlers.NewMessageHandler(messageRepo, memberRepo, userRepo, cfg, logger)
+	announcementHandler := handlers.NewAnnouncementHandler(announcementRepo, memberRepo, cfg, logger)
+	userHandler := handlers.NewUserHandler(userRepo, profileRepo, memberRepo, storageClient, storageCleaner, cfg, logger)
+	inviteHandler := handlers.NewInviteHandler(inviteRepo, joinRequestRepo, memberRepo, cfg, logger)
+	passwordHandler := handlers.NewPasswordHandler(userRepo, profileRepo, userTokenRepo, tokenRepo, sessionRepo, securityEventRepo, mailer, passwordPolicy, cfg, logger)
+	verificationHandler := handlers.NewVerificationHandler(userRepo, userTokenRepo, mailer, cfg, logger)
+	mfaHandler := handlers.NewMFAHandler(userRepo, mfaRepo, securityEventRepo, cfg, logger)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, tokenRepo, cfg, logger)
+	adminHandler := handlers.NewAdminHandler(userRepo, invitationRepo, roleChangeRepo, securityEventRepo, mfaRepo, loginFailureRepo, sessionRepo, tokenRepo, tokenRevocations, signingKeys, cfg, logger)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, userRepo, securityEventRepo, logger)
+
+	// API keys of integrations are accepted next to access tokens
+	apiKeyAuth := middleware.NewAPIKeyAuthenticator(apiKeyRepo, userRepo)
+
+	// Start background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	photoSweeper := worker.NewPhotoSweeper(photoRepo, storageCleaner, cfg.Photos.PendingTTL, cfg.Photos.SweepInterval, logger)
+	go photoSweeper.Run(workerCtx)
+	go storageCleaner.Run(workerCtx)
+	go photoProcessor.Run(workerCtx)
+	go tokenRevocations.Run(workerCtx)
+
+	expiryCleaner := worker.NewExpiryCleaner(cfg.Database.CleanupInterval, logger,
+		worker.ExpiryCleanup{Table: "rate_limits", DeleteExpired: func(ctx context.Context, now time.Time) error {
+			return rateLimitRepo.DeleteExpired(ctx, now.Add(-cfg.MagicLink.RequestWindow))
+		}},
+		worker.ExpiryCleanup{Table: "oidc_login_states", DeleteExpired: oidcStateRepo.DeleteExpired},
+		worker.ExpiryCleanup{Table: "webauthn_challenges", DeleteExpired: webAuthnChallengeRepo.DeleteExpired},
+		worker.ExpiryCleanup{Table: "mfa_challenges", DeleteExpired: mfaChallengeRepo.DeleteExpired},
+	)
+	go expiryCleaner.Run(workerCtx)
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to parse trusted proxies")
+	}
 
 	// Initialize router
 	r := chi.NewRouter()
@@ -96,7 +194,7 @@ func main() {
 	// Global middleware
 	r.Use(chiMiddleware.Logger)
 	r.Use(chiMiddleware.Recoverer)
-	r.Use(chiMiddleware.RealIP)
+	r.Use(middleware.RealIP(trustedProxies))
 	r.Use(middleware.RequestID)
 
 	// CORS middleware
@@ -117,6 +215,7 @@ func main() {
 	r.Get("/healthz", healthzHandler(logger))
 	r.Get("/readyz", readyzHandler(db, storageClient, logger))
 	r.Get("/version", versionHandler(logger))
+	r.Get("/.well-known/jwks.json", jwksHandler(signingKeys))
 
 	// API v1 routes
 	r.Route("/v1", func(r chi.Router) {
@@ -125,27 +224,125 @@ func main() {
 		r.Post("/auth/login", authHandler.Login)
 		r.Post("/auth/refresh", authHandler.Refresh)
 		r.Post("/auth/logout", authHandler.Logout)
+		r.Post("/auth/password/forgot", passwordHandler.Forgot)
+		r.Post("/auth/password/reset", passwordHandler.Reset)
+		r.Post("/auth/verify-email", verificationHandler.Verify)
+		r.Post("/auth/mfa/setup", authHandler.SetupMFA)
+		r.Post("/auth/mfa/verify", authHandler.VerifyMFA)
+		r.Post("/auth/magic-link", magicLinkHandler.Request)
+		r.Post("/auth/magic-link/login", magicLinkHandler.Login)
+		r.Get("/auth/oidc/providers", oidcHandler.ListProviders)
+		r.Post("/auth/oidc/{provider}/authorize", oidcHandler.Authorize)
+		r.Post("/auth/oidc/{provider}/callback", oidcHandler.Callback)
+		r.Post("/auth/passkey/options", passkeyHandler.LoginOptions)
+		r.Post("/auth/passkey/login", passkeyHandler.Login)
 
 		// Protected routes
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware(cfg))
-
-			// User routes
-			r.Get("/me", handlers.NotImplemented) // TODO: implement
-
-			// Class routes
-			r.Post("/classes", middleware.RequireRole("TEACHER", "ADMIN")(http.HandlerFunc(classHandler.Create)).ServeHTTP)
-			r.Get("/classes", classHandler.ListMyClasses)
-			r.Get("/classes/{id}", classHandler.GetByID)
-			r.Get("/classes/{id}/members", classHandler.ListMembers)
-
-			// Photo routes
-			r.Post("/classes/{id}/photos", photoHandler.CreateUpload)
-			r.Get("/classes/{id}/photos", photoHandler.List)
-
-			// Absence routes - TODO: implement
-			// Message routes - TODO: implement
-			// Announcement routes - TODO: implement
+			r.Use(middleware.AuthMiddleware(signingKeys, apiKeyAuth, tokenRevocations))
+			r.Use(middleware.Impersonation(logger))
+
+			// Routes that API keys of school information system integrations
+			// may call, each limited to a scope. Access tokens are not affected.
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireVerified)
+
+				r.Post("/classes", middleware.RequireScope(domain.APIKeyScopeClassesWrite)(middleware.RequireRole("TEACHER", "ADMIN")(http.HandlerFunc(classHandler.Create))).ServeHTTP)
+				r.Get("/classes", middleware.RequireScope(domain.APIKeyScopeClassesRead)(http.HandlerFunc(classHandler.ListMyClasses)).ServeHTTP)
+				r.Get("/classes/{id}", middleware.RequireScope(domain.APIKeyScopeClassesRead)(http.HandlerFunc(classHandler.GetByID)).ServeHTTP)
+				r.Get("/classes/{id}/members", middleware.RequireScope(domain.APIKeyScopeMembersRead)(http.HandlerFunc(classHandler.ListMembers)).ServeHTTP)
+				r.Delete("/classes/{id}/members/{memberId}", middleware.RequireScope(domain.APIKeyScopeMembersWrite)(http.HandlerFunc(classHandler.RemoveMember)).ServeHTTP)
+				r.Get("/classes/{id}/join-requests", middleware.RequireScope(domain.APIKeyScopeMembersRead)(http.HandlerFunc(inviteHandler.ListJoinRequests)).ServeHTTP)
+				r.Patch("/classes/{id}/join-requests/{requestId}", middleware.RequireScope(domain.APIKeyScopeMembersWrite)(http.HandlerFunc(inviteHandler.DecideJoinRequest)).ServeHTTP)
+				r.Get("/classes/{id}/absences", middleware.RequireScope(domain.APIKeyScopeAbsencesRead)(http.HandlerFunc(absenceHandler.List)).ServeHTTP)
+				r.Patch("/classes/{id}/absences/{absenceId}", middleware.RequireScope(domain.APIKeyScopeAbsencesWrite)(http.HandlerFunc(absenceHandler.UpdateStatus)).ServeHTTP)
+			})
+
+			// Everything else is only available with an access token
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RejectAPIKeys)
+
+				// User routes
+				r.Get("/me", userHandler.GetMe)
+				r.Patch("/me", userHandler.UpdateMe)
+				r.Post("/me/verification", verificationHandler.Resend)
+
+				// Everything else requires a verified email address
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireVerified)
+
+					r.Post("/me/avatar", userHandler.CreateAvatarUpload)
+					r.Get("/me/join-requests", inviteHandler.ListMyJoinRequests)
+
+					// Session routes
+					r.Get("/me/sessions", sessionHandler.List)
+					r.Delete("/me/sessions", sessionHandler.RevokeAll)
+					r.Delete("/me/sessions/{id}", sessionHandler.Revoke)
+
+					// Two-factor authentication routes
+					r.Get("/me/mfa", mfaHandler.Status)
+					r.Post("/me/mfa", mfaHandler.Setup)
+					r.Post("/me/mfa/confirm", mfaHandler.Confirm)
+					r.Delete("/me/mfa", mfaHandler.Disable)
+					r.Post("/me/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+
+					// Passkey routes
+					r.Get("/me/passkeys", passkeyHandler.List)
+					r.Post("/me/passkeys/options", passkeyHandler.RegistrationOptions)
+					r.Post("/me/passkeys", passkeyHandler.Register)
+					r.Delete("/me/passkeys/{id}", passkeyHandler.Delete)
+
+					// Invite and join request routes
+					r.Post("/classes/{id}/invites", inviteHandler.CreateInvite)
+					r.Get("/classes/{id}/invites", inviteHandler.ListInvites)
+					r.Delete("/classes/{id}/invites/{inviteId}", inviteHandler.RevokeInvite)
+					r.Post("/invites/redeem", middleware.RequireRole("PARENT")(http.HandlerFunc(inviteHandler.Redeem)).ServeHTTP)
+
+					// Photo routes
+					r.Post("/classes/{id}/photos", photoHandler.CreateUpload)
+					r.Get("/classes/{id}/photos", photoHandler.List)
+					r.Post("/classes/{id}/photos/{photoId}/complete", photoHandler.Complete)
+					r.Delete("/classes/{id}/photos/{photoId}", photoHandler.Delete)
+
+					// Absence routes
+					r.Post("/classes/{id}/absences", absenceHandler.Create)
+
+					// Message routes
+					r.Post("/messages", messageHandler.Send)
+					r.Get("/messages", messageHandler.Inbox)
+					r.Post("/messages/{id}/read", messageHandler.MarkAsRead)
+					r.Get("/classes/{id}/messages", messageHandler.ListByClass)
+
+					// Announcement routes
+					r.Post("/classes/{id}/announcements", announcementHandler.CreateForClass)
+					r.Get("/classes/{id}/announcements", announcementHandler.ListByClass)
+					r.Post("/announcements", middleware.RequireRole("ADMIN")(http.HandlerFunc(announcementHandler.CreateGlobal)).ServeHTTP)
+					r.Get("/announcements", announcementHandler.ListGlobal)
+					r.Get("/announcements/scheduled", announcementHandler.ListScheduled)
+					r.Get("/announcements/{id}", announcementHandler.GetByID)
+					r.Patch("/announcements/{id}", announcementHandler.Update)
+					r.Delete("/announcements/{id}", announcementHandler.Delete)
+
+					// Admin routes
+					r.Group(func(r chi.Router) {
+						r.Use(middleware.RequireRole("ADMIN"))
+
+						r.Post("/admin/invitations", adminHandler.CreateInvitation)
+						r.Get("/admin/invitations", adminHandler.ListInvitations)
+						r.Delete("/admin/invitations/{id}", adminHandler.RevokeInvitation)
+						r.Patch("/admin/users/{id}/role", adminHandler.UpdateUserRole)
+						r.Get("/admin/users/{id}/role-changes", adminHandler.ListRoleChanges)
+						r.Get("/admin/users/{id}/security-events", adminHandler.ListSecurityEvents)
+						r.Delete("/admin/users/{id}/mfa", adminHandler.ResetUserMFA)
+						r.Post("/admin/users/{id}/unlock", adminHandler.UnlockUser)
+						r.Post("/admin/users/{id}/impersonate", adminHandler.Impersonate)
+						r.Post("/admin/users/{id}/sign-out", adminHandler.SignOutUser)
+						r.Post("/admin/api-keys", apiKeyHandler.Create)
+						r.Get("/admin/api-keys", apiKeyHandler.List)
+						r.Delete("/admin/api-keys/{id}", apiKeyHandler.Revoke)
+					})
+				})
+			})
 		})
 	})
 
@@ -172,6 +369,8 @@ func main() {
 	<-sigChan
 
 	logger.Info("Shutting down server...")
+	stopWorkers()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -182,6 +381,37 @@ func main() {
 	logger.Info("Server stopped")
 }
 
+// loadSigningKeys loads the access token signing keys. Without a configured key
+// directory, which is only allowed in development, an ephemeral key is
+// generated and tokens stop working when the server restarts.
+func loadSigningKeys(cfg *config.Config, logger *log.Logger) (*auth.KeySet, error) {
+	if cfg.JWT.SigningKeysDir != "" {
+		return auth.LoadKeySet(cfg.JWT.SigningKeysDir)
+	}
+
+	logger.Warn("JWT_SIGNING_KEYS_DIR is not set, using an ephemeral signing key")
+	key, err := auth.GenerateSigningKey("dev-" + time.Now().UTC().Format("20060102150405"))
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewKeySet(key)
+}
+
+// loadOIDCProviders loads the configured identity providers. OpenID Connect
+// login has no providers when OIDC_PROVIDERS_FILE is not set.
+func loadOIDCProviders(cfg *config.Config, logger *log.Logger) (*oidc.Registry, error) {
+	if cfg.OIDC.ProvidersFile == "" {
+		return oidc.NewRegistry(nil, nil), nil
+	}
+
+	providers, err := oidc.LoadProviders(cfg.OIDC.ProvidersFile)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithField("providers", len(providers)).Info("OIDC providers loaded")
+	return oidc.NewRegistry(providers, nil), nil
+}
+
 // healthzHandler returns a simple liveness check
 func healthzHandler(_ *log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
@@ -230,3 +460,13 @@ func versionHandler(_ *log.Logger) http.HandlerFunc {
 		_, _ = w.Write([]byte(response))
 	}
 }
+
+// jwksHandler publishes the public keys that verify access tokens
+func jwksHandler(keys *auth.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(keys.JWKS())
+	}
+}
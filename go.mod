@@ -17,6 +17,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/rs/zerolog v1.31.0
 	golang.org/x/crypto v0.45.0
+	golang.org/x/image v0.25.0
 	golang.org/x/time v0.14.0
 )
 
@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -14,7 +17,16 @@ type Config struct {
 	Server    ServerConfig
 	Database  DatabaseConfig
 	JWT       JWTConfig
+	Auth      AuthConfig
+	Password  PasswordConfig
 	Storage   StorageConfig
+	Photos    PhotoConfig
+	Mail      MailConfig
+	MFA       MFAConfig
+	Login     LoginConfig
+	OIDC      OIDCConfig
+	MagicLink MagicLinkConfig
+	WebAuthn  WebAuthnConfig
 	RateLimit int
 	CORS      CORSConfig
 	Log       LogConfig
@@ -24,18 +36,57 @@ type Config struct {
 type ServerConfig struct {
 	Port string
 	Env  string
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are trusted. Without it the
+	// client address is the TCP peer.
+	TrustedProxies []string
 }
 
 // DatabaseConfig holds database connection configuration
 type DatabaseConfig struct {
 	URL string
+	// CleanupInterval is how often rows that are only kept until they
+	// expire, such as rate limit windows and login challenges, are deleted
+	CleanupInterval time.Duration
 }
 
 // JWTConfig holds JWT token configuration
 type JWTConfig struct {
-	Secret        string
-	AccessExpiry  time.Duration
-	RefreshExpiry time.Duration
+	// SigningKeysDir holds the PEM private keys that sign access tokens. In
+	// development an ephemeral key is generated when it is not set.
+	SigningKeysDir string
+	AccessExpiry   time.Duration
+	RefreshExpiry  time.Duration
+	// RevocationRefreshInterval is how often access token revocations made
+	// by other instances are loaded
+	RevocationRefreshInterval time.Duration
+}
+
+// AuthConfig holds account and credential lifecycle configuration
+type AuthConfig struct {
+	InvitationExpiry        time.Duration
+	PasswordResetExpiry     time.Duration
+	EmailVerificationExpiry time.Duration
+	// ImpersonationExpiry is how long an admin may act as another user with
+	// one impersonation token
+	ImpersonationExpiry time.Duration
+}
+
+// PasswordConfig holds password policy and hashing configuration. Raising the
+// argon2id cost only affects new hashes; existing ones are rehashed on the
+// next login.
+type PasswordConfig struct {
+	MinLength int
+	// BlocklistFile adds passwords, one per line, to the built-in list of
+	// common passwords
+	BlocklistFile string
+	// BreachedDir holds breached password SHA-1 hashes as Pwned Passwords
+	// range files named PREFIX.txt; the check is skipped when it is empty
+	BreachedDir string
+	// Argon2Memory is in KiB
+	Argon2Memory  int
+	Argon2Time    int
+	Argon2Threads int
 }
 
 // StorageConfig holds S3-compatible storage configuration
@@ -47,6 +98,127 @@ type StorageConfig struct {
 	SecretKey    string
 	UsePathStyle bool
 	Insecure     bool
+	// CleanupInterval is how often failed object deletions are retried
+	CleanupInterval time.Duration
+}
+
+// PhotoConfig holds photo upload lifecycle configuration
+type PhotoConfig struct {
+	// PendingTTL is how long an unconfirmed upload is kept before it is purged
+	PendingTTL    time.Duration
+	SweepInterval time.Duration
+	// ProcessInterval is how often the processor looks for photos that still
+	// need resized variants, in addition to being woken up on upload
+	ProcessInterval time.Duration
+}
+
+// MailConfig holds outgoing email configuration. Without an SMTP host emails
+// are only written to the log.
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	// AppBaseURL is the web app address used to build links in emails
+	AppBaseURL string
+}
+
+// MFAConfig holds two-factor authentication configuration
+type MFAConfig struct {
+	// Issuer is the account issuer shown in authenticator apps
+	Issuer string
+	// RequiredRoles lists roles that must enroll in two-factor authentication
+	// before they can log in
+	RequiredRoles []string
+	// ChallengeExpiry is how long a login may wait for its second factor
+	ChallengeExpiry time.Duration
+}
+
+// LoginConfig holds brute-force protection for password logins. Failures are
+// counted per account and per client IP.
+type LoginConfig struct {
+	// MaxAccountAttempts is how many failed logins an account allows before it
+	// is locked; 0 disables the account lockout
+	MaxAccountAttempts int
+	// MaxIPAttempts is how many failed logins a client IP allows before it is
+	// locked out; 0 disables the IP lockout
+	MaxIPAttempts int
+	// LockoutBase is the first lockout. Every further failure doubles it, up
+	// to LockoutMax.
+	LockoutBase time.Duration
+	LockoutMax  time.Duration
+	// FailureWindow is how long failures are remembered after the last one
+	FailureWindow time.Duration
+}
+
+// LockoutDuration returns how long to lock out after the given number of
+// consecutive failures, or 0 if maxAttempts has not been reached yet
+func (c *LoginConfig) LockoutDuration(failures, maxAttempts int) time.Duration {
+	if maxAttempts <= 0 || failures < maxAttempts {
+		return 0
+	}
+
+	lockout := c.LockoutBase
+	for i := maxAttempts; i < failures && lockout < c.LockoutMax; i++ {
+		lockout *= 2
+	}
+	return min(lockout, c.LockoutMax)
+}
+
+// OIDCConfig holds OpenID Connect login configuration
+type OIDCConfig struct {
+	// ProvidersFile is a JSON file listing the identity providers of schools;
+	// OpenID Connect login is disabled when it is empty
+	ProvidersFile string
+	// StateExpiry is how long a login may wait for the provider callback
+	StateExpiry time.Duration
+}
+
+// MagicLinkConfig holds passwordless email login configuration
+type MagicLinkConfig struct {
+	Enabled bool
+	// Roles lists the roles that may log in with a magic link
+	Roles  []string
+	Expiry time.Duration
+	// MaxPerEmail and MaxPerIP limit how many links can be requested per
+	// RequestWindow; 0 disables a limit
+	MaxPerEmail   int
+	MaxPerIP      int
+	RequestWindow time.Duration
+}
+
+// WebAuthnConfig holds passkey configuration
+type WebAuthnConfig struct {
+	// RPID is the domain passkeys are registered for. Changing it invalidates
+	// all registered passkeys.
+	RPID   string
+	RPName string
+	// Origins lists the web app origins passkey ceremonies may run on
+	Origins []string
+	// ChallengeExpiry is how long a ceremony may wait for the authenticator
+	ChallengeExpiry time.Duration
+}
+
+// AllowsRole reports whether users with role may log in with a magic link
+func (c *MagicLinkConfig) AllowsRole(role string) bool {
+	return containsFold(c.Roles, role)
+}
+
+// IsRequired reports whether users with role must use two-factor authentication
+func (c *MFAConfig) IsRequired(role string) bool {
+	return containsFold(c.RequiredRoles, role)
+}
+
+// containsFold reports whether a configured list contains value, ignoring
+// case and surrounding spaces
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
 }
 
 // CORSConfig holds CORS configuration
@@ -65,27 +237,90 @@ func Load() (*Config, error) {
 	// Try to load .env file, but don't fail if it doesn't exist
 	_ = godotenv.Load()
 
+	appBaseURL := strings.TrimSuffix(getEnv("APP_BASE_URL", "http://localhost:3000"), "/")
+
 	cfg := &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
-			Env:  getEnv("ENV", "development"),
+			Port:           getEnv("PORT", "8080"),
+			Env:            getEnv("ENV", "development"),
+			TrustedProxies: parseSlice(getEnv("TRUSTED_PROXIES", "")),
 		},
 		Database: DatabaseConfig{
-			URL: getEnv("DATABASE_URL", ""),
+			URL:             getEnv("DATABASE_URL", ""),
+			CleanupInterval: parseDuration(getEnv("DB_CLEANUP_INTERVAL", "15m"), 15*time.Minute),
 		},
 		JWT: JWTConfig{
-			Secret:        getEnv("JWT_SECRET", ""),
-			AccessExpiry:  parseDuration(getEnv("JWT_ACCESS_EXPIRY", "15m"), 15*time.Minute),
-			RefreshExpiry: parseDuration(getEnv("JWT_REFRESH_EXPIRY", "168h"), 168*time.Hour),
+			SigningKeysDir:            getEnv("JWT_SIGNING_KEYS_DIR", ""),
+			AccessExpiry:              parseDuration(getEnv("JWT_ACCESS_EXPIRY", "15m"), 15*time.Minute),
+			RefreshExpiry:             parseDuration(getEnv("JWT_REFRESH_EXPIRY", "168h"), 168*time.Hour),
+			RevocationRefreshInterval: parseDuration(getEnv("JWT_REVOCATION_REFRESH_INTERVAL", "5s"), 5*time.Second),
+		},
+		Auth: AuthConfig{
+			InvitationExpiry:        parseDuration(getEnv("INVITATION_EXPIRY", "72h"), 72*time.Hour),
+			PasswordResetExpiry:     parseDuration(getEnv("PASSWORD_RESET_EXPIRY", "30m"), 30*time.Minute),
+			EmailVerificationExpiry: parseDuration(getEnv("EMAIL_VERIFICATION_EXPIRY", "48h"), 48*time.Hour),
+			ImpersonationExpiry:     parseDuration(getEnv("IMPERSONATION_EXPIRY", "15m"), 15*time.Minute),
+		},
+		Password: PasswordConfig{
+			MinLength:     parseInt(getEnv("PASSWORD_MIN_LENGTH", "10")),
+			BlocklistFile: getEnv("PASSWORD_BLOCKLIST_FILE", ""),
+			BreachedDir:   getEnv("PASSWORD_BREACHED_DIR", ""),
+			Argon2Memory:  parseInt(getEnv("PASSWORD_ARGON2_MEMORY", "65536")),
+			Argon2Time:    parseInt(getEnv("PASSWORD_ARGON2_TIME", "3")),
+			Argon2Threads: parseInt(getEnv("PASSWORD_ARGON2_THREADS", "4")),
 		},
 		Storage: StorageConfig{
-			Endpoint:     getEnv("STORAGE_ENDPOINT", ""),
-			Region:       getEnv("STORAGE_REGION", "us-east-1"),
-			Bucket:       getEnv("STORAGE_BUCKET", ""),
-			AccessKey:    getEnv("STORAGE_ACCESS_KEY", ""),
-			SecretKey:    getEnv("STORAGE_SECRET_KEY", ""),
-			UsePathStyle: parseBool(getEnv("STORAGE_USE_PATH_STYLE", "false")),
-			Insecure:     parseBool(getEnv("STORAGE_INSECURE", "false")),
+			Endpoint:        getEnv("STORAGE_ENDPOINT", ""),
+			Region:          getEnv("STORAGE_REGION", "us-east-1"),
+			Bucket:          getEnv("STORAGE_BUCKET", ""),
+			AccessKey:       getEnv("STORAGE_ACCESS_KEY", ""),
+			SecretKey:       getEnv("STORAGE_SECRET_KEY", ""),
+			UsePathStyle:    parseBool(getEnv("STORAGE_USE_PATH_STYLE", "false")),
+			Insecure:        parseBool(getEnv("STORAGE_INSECURE", "false")),
+			CleanupInterval: parseDuration(getEnv("STORAGE_CLEANUP_INTERVAL", "1m"), time.Minute),
+		},
+		Photos: PhotoConfig{
+			PendingTTL:      parseDuration(getEnv("PHOTO_PENDING_TTL", "1h"), time.Hour),
+			SweepInterval:   parseDuration(getEnv("PHOTO_SWEEP_INTERVAL", "10m"), 10*time.Minute),
+			ProcessInterval: parseDuration(getEnv("PHOTO_PROCESS_INTERVAL", "30s"), 30*time.Second),
+		},
+		Mail: MailConfig{
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     parseInt(getEnv("SMTP_PORT", "587")),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", "TinySchoolHub <no-reply@tinyschoolhub.local>"),
+			AppBaseURL:   appBaseURL,
+		},
+		MFA: MFAConfig{
+			Issuer:          getEnv("MFA_ISSUER", "TinySchoolHub"),
+			RequiredRoles:   parseSlice(getEnv("MFA_REQUIRED_ROLES", "")),
+			ChallengeExpiry: parseDuration(getEnv("MFA_CHALLENGE_EXPIRY", "5m"), 5*time.Minute),
+		},
+		Login: LoginConfig{
+			MaxAccountAttempts: parseInt(getEnv("LOGIN_MAX_ACCOUNT_ATTEMPTS", "5")),
+			MaxIPAttempts:      parseInt(getEnv("LOGIN_MAX_IP_ATTEMPTS", "20")),
+			LockoutBase:        parseDuration(getEnv("LOGIN_LOCKOUT_BASE", "1m"), time.Minute),
+			LockoutMax:         parseDuration(getEnv("LOGIN_LOCKOUT_MAX", "1h"), time.Hour),
+			FailureWindow:      parseDuration(getEnv("LOGIN_FAILURE_WINDOW", "24h"), 24*time.Hour),
+		},
+		OIDC: OIDCConfig{
+			ProvidersFile: getEnv("OIDC_PROVIDERS_FILE", ""),
+			StateExpiry:   parseDuration(getEnv("OIDC_STATE_EXPIRY", "10m"), 10*time.Minute),
+		},
+		MagicLink: MagicLinkConfig{
+			Enabled:       parseBool(getEnv("MAGIC_LINK_ENABLED", "true")),
+			Roles:         parseSlice(getEnv("MAGIC_LINK_ROLES", "PARENT")),
+			Expiry:        parseDuration(getEnv("MAGIC_LINK_EXPIRY", "15m"), 15*time.Minute),
+			MaxPerEmail:   parseInt(getEnv("MAGIC_LINK_MAX_PER_EMAIL", "3")),
+			MaxPerIP:      parseInt(getEnv("MAGIC_LINK_MAX_PER_IP", "20")),
+			RequestWindow: parseDuration(getEnv("MAGIC_LINK_REQUEST_WINDOW", "1h"), time.Hour),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:            getEnv("WEBAUTHN_RP_ID", hostname(appBaseURL)),
+			RPName:          getEnv("WEBAUTHN_RP_NAME", "TinySchoolHub"),
+			Origins:         parseSlice(getEnv("WEBAUTHN_ORIGINS", appBaseURL)),
+			ChallengeExpiry: parseDuration(getEnv("WEBAUTHN_CHALLENGE_EXPIRY", "5m"), 5*time.Minute),
 		},
 		RateLimit: parseInt(getEnv("RATE_LIMIT", "100")),
 		CORS: CORSConfig{
@@ -110,8 +345,13 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("DATABASE_URL is required")
 	}
 
-	if c.JWT.Secret == "" {
-		return fmt.Errorf("JWT_SECRET is required")
+	if c.JWT.SigningKeysDir == "" && c.Server.Env != "development" {
+		return fmt.Errorf("JWT_SIGNING_KEYS_DIR is required")
+	}
+
+	if c.Password.Argon2Memory <= 0 || c.Password.Argon2Time <= 0 ||
+		c.Password.Argon2Threads <= 0 || c.Password.Argon2Threads > math.MaxUint8 {
+		return fmt.Errorf("PASSWORD_ARGON2_MEMORY, PASSWORD_ARGON2_TIME and PASSWORD_ARGON2_THREADS must be positive, with at most 255 threads")
 	}
 
 	if c.Storage.Endpoint == "" {
@@ -176,6 +416,15 @@ func parseDuration(value string, defaultDuration time.Duration) time.Duration {
 	return d
 }
 
+// hostname returns the host of rawURL without its port, or "" if it is not a URL
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
 func parseSlice(value string) []string {
 	if value == "" {
 		return []string{}
@@ -9,7 +9,7 @@ import (
 func TestLoad_Success(t *testing.T) {
 	// Set required environment variables
 	os.Setenv("DATABASE_URL", "postgres://localhost:5432/testdb")
-	os.Setenv("JWT_SECRET", "test-secret-key")
+	os.Setenv("JWT_SIGNING_KEYS_DIR", "/etc/tinyschoolhub/jwt-keys")
 	os.Setenv("STORAGE_ENDPOINT", "localhost:9000")
 	os.Setenv("STORAGE_BUCKET", "test-bucket")
 	os.Setenv("STORAGE_ACCESS_KEY", "test-access")
@@ -32,6 +32,16 @@ func TestLoad_Success(t *testing.T) {
 	if cfg.Server.Env != "development" {
 		t.Errorf("Server.Env = %v, want development", cfg.Server.Env)
 	}
+	if !cfg.MagicLink.Enabled || !cfg.MagicLink.AllowsRole("PARENT") || cfg.MagicLink.AllowsRole("TEACHER") {
+		t.Errorf("MagicLink = %+v, want enabled for parents only", cfg.MagicLink)
+	}
+	// Passkeys default to the web app address
+	if cfg.WebAuthn.RPID != "localhost" {
+		t.Errorf("WebAuthn.RPID = %v, want localhost", cfg.WebAuthn.RPID)
+	}
+	if len(cfg.WebAuthn.Origins) != 1 || cfg.WebAuthn.Origins[0] != "http://localhost:3000" {
+		t.Errorf("WebAuthn.Origins = %v, want [http://localhost:3000]", cfg.WebAuthn.Origins)
+	}
 }
 
 func TestLoad_MissingRequiredFields(t *testing.T) {
@@ -43,66 +53,67 @@ func TestLoad_MissingRequiredFields(t *testing.T) {
 		{
 			name: "missing DATABASE_URL",
 			envVars: map[string]string{
-				"JWT_SECRET":         "secret",
-				"STORAGE_ENDPOINT":   "localhost:9000",
-				"STORAGE_BUCKET":     "bucket",
-				"STORAGE_ACCESS_KEY": "access",
-				"STORAGE_SECRET_KEY": "secret",
+				"JWT_SIGNING_KEYS_DIR": "/etc/keys",
+				"STORAGE_ENDPOINT":     "localhost:9000",
+				"STORAGE_BUCKET":       "bucket",
+				"STORAGE_ACCESS_KEY":   "access",
+				"STORAGE_SECRET_KEY":   "secret",
 			},
 			expectedError: "DATABASE_URL is required",
 		},
 		{
-			name: "missing JWT_SECRET",
+			name: "missing JWT_SIGNING_KEYS_DIR",
 			envVars: map[string]string{
+				"ENV":                "production",
 				"DATABASE_URL":       "postgres://localhost:5432/db",
 				"STORAGE_ENDPOINT":   "localhost:9000",
 				"STORAGE_BUCKET":     "bucket",
 				"STORAGE_ACCESS_KEY": "access",
 				"STORAGE_SECRET_KEY": "secret",
 			},
-			expectedError: "JWT_SECRET is required",
+			expectedError: "JWT_SIGNING_KEYS_DIR is required",
 		},
 		{
 			name: "missing STORAGE_ENDPOINT",
 			envVars: map[string]string{
-				"DATABASE_URL":       "postgres://localhost:5432/db",
-				"JWT_SECRET":         "secret",
-				"STORAGE_BUCKET":     "bucket",
-				"STORAGE_ACCESS_KEY": "access",
-				"STORAGE_SECRET_KEY": "secret",
+				"DATABASE_URL":         "postgres://localhost:5432/db",
+				"JWT_SIGNING_KEYS_DIR": "/etc/keys",
+				"STORAGE_BUCKET":       "bucket",
+				"STORAGE_ACCESS_KEY":   "access",
+				"STORAGE_SECRET_KEY":   "secret",
 			},
 			expectedError: "STORAGE_ENDPOINT is required",
 		},
 		{
 			name: "missing STORAGE_BUCKET",
 			envVars: map[string]string{
-				"DATABASE_URL":       "postgres://localhost:5432/db",
-				"JWT_SECRET":         "secret",
-				"STORAGE_ENDPOINT":   "localhost:9000",
-				"STORAGE_ACCESS_KEY": "access",
-				"STORAGE_SECRET_KEY": "secret",
+				"DATABASE_URL":         "postgres://localhost:5432/db",
+				"JWT_SIGNING_KEYS_DIR": "/etc/keys",
+				"STORAGE_ENDPOINT":     "localhost:9000",
+				"STORAGE_ACCESS_KEY":   "access",
+				"STORAGE_SECRET_KEY":   "secret",
 			},
 			expectedError: "STORAGE_BUCKET is required",
 		},
 		{
 			name: "missing STORAGE_ACCESS_KEY",
 			envVars: map[string]string{
-				"DATABASE_URL":       "postgres://localhost:5432/db",
-				"JWT_SECRET":         "secret",
-				"STORAGE_ENDPOINT":   "localhost:9000",
-				"STORAGE_BUCKET":     "bucket",
-				"STORAGE_SECRET_KEY": "secret",
+				"DATABASE_URL":         "postgres://localhost:5432/db",
+				"JWT_SIGNING_KEYS_DIR": "/etc/keys",
+				"STORAGE_ENDPOINT":     "localhost:9000",
+				"STORAGE_BUCKET":       "bucket",
+				"STORAGE_SECRET_KEY":   "secret",
 			},
 			expectedError: "STORAGE_ACCESS_KEY is required",
 		},
 		{
 			name: "missing STORAGE_SECRET_KEY",
 			envVars: map[string]string{
-				"DATABASE_URL":       "postgres://localhost:5432/db",
-				"JWT_SECRET":         "secret",
-				"STORAGE_ENDPOINT":   "localhost:9000",
-				"STORAGE_BUCKET":     "bucket",
-				"STORAGE_ACCESS_KEY": "access",
+				"DATABASE_URL":         "postgres://localhost:5432/db",
+				"JWT_SIGNING_KEYS_DIR": "/etc/keys",
+				"STORAGE_ENDPOINT":     "localhost:9000",
+				"STORAGE_BUCKET":       "bucket",
+				"STORAGE_ACCESS_KEY":   "access",
 			},
 			expectedError: "STORAGE_SECRET_KEY is required",
 		},
@@ -134,10 +145,17 @@ func TestLoad_CustomValues(t *testing.T) {
 	// Set all environment variables with custom values
 	os.Setenv("PORT", "9090")
 	os.Setenv("ENV", "production")
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,192.0.2.1")
 	os.Setenv("DATABASE_URL", "postgres://db:5432/mydb")
-	os.Setenv("JWT_SECRET", "my-secret")
+	os.Setenv("DB_CLEANUP_INTERVAL", "5m")
+	os.Setenv("JWT_SIGNING_KEYS_DIR", "/etc/keys")
 	os.Setenv("JWT_ACCESS_EXPIRY", "30m")
 	os.Setenv("JWT_REFRESH_EXPIRY", "720h")
+	os.Setenv("JWT_REVOCATION_REFRESH_INTERVAL", "10s")
+	os.Setenv("INVITATION_EXPIRY", "24h")
+	os.Setenv("PASSWORD_RESET_EXPIRY", "15m")
+	os.Setenv("EMAIL_VERIFICATION_EXPIRY", "24h")
+	os.Setenv("IMPERSONATION_EXPIRY", "5m")
 	os.Setenv("STORAGE_ENDPOINT", "s3.amazonaws.com")
 	os.Setenv("STORAGE_REGION", "eu-west-1")
 	os.Setenv("STORAGE_BUCKET", "my-bucket")
@@ -145,6 +163,42 @@ func TestLoad_CustomValues(t *testing.T) {
 	os.Setenv("STORAGE_SECRET_KEY", "my-secret")
 	os.Setenv("STORAGE_USE_PATH_STYLE", "true")
 	os.Setenv("STORAGE_INSECURE", "true")
+	os.Setenv("STORAGE_CLEANUP_INTERVAL", "30s")
+	os.Setenv("PHOTO_PENDING_TTL", "2h")
+	os.Setenv("PHOTO_SWEEP_INTERVAL", "5m")
+	os.Setenv("PHOTO_PROCESS_INTERVAL", "15s")
+	os.Setenv("SMTP_HOST", "smtp.example.com")
+	os.Setenv("SMTP_PORT", "2525")
+	os.Setenv("SMTP_USERNAME", "mailer")
+	os.Setenv("SMTP_PASSWORD", "mail-secret")
+	os.Setenv("MAIL_FROM", "School <school@example.com>")
+	os.Setenv("APP_BASE_URL", "https://app.example.com/")
+	os.Setenv("MFA_ISSUER", "School")
+	os.Setenv("MFA_REQUIRED_ROLES", "TEACHER,ADMIN")
+	os.Setenv("MFA_CHALLENGE_EXPIRY", "2m")
+	os.Setenv("PASSWORD_MIN_LENGTH", "12")
+	os.Setenv("PASSWORD_BLOCKLIST_FILE", "/etc/blocklist.txt")
+	os.Setenv("PASSWORD_BREACHED_DIR", "/var/lib/pwned")
+	os.Setenv("PASSWORD_ARGON2_MEMORY", "19456")
+	os.Setenv("PASSWORD_ARGON2_TIME", "2")
+	os.Setenv("PASSWORD_ARGON2_THREADS", "1")
+	os.Setenv("LOGIN_MAX_ACCOUNT_ATTEMPTS", "3")
+	os.Setenv("LOGIN_MAX_IP_ATTEMPTS", "50")
+	os.Setenv("LOGIN_LOCKOUT_BASE", "30s")
+	os.Setenv("LOGIN_LOCKOUT_MAX", "2h")
+	os.Setenv("LOGIN_FAILURE_WINDOW", "12h")
+	os.Setenv("OIDC_PROVIDERS_FILE", "/etc/tinyschoolhub/oidc.json")
+	os.Setenv("OIDC_STATE_EXPIRY", "5m")
+	os.Setenv("MAGIC_LINK_ENABLED", "false")
+	os.Setenv("MAGIC_LINK_ROLES", "PARENT,TEACHER")
+	os.Setenv("MAGIC_LINK_EXPIRY", "10m")
+	os.Setenv("MAGIC_LINK_MAX_PER_EMAIL", "2")
+	os.Setenv("MAGIC_LINK_MAX_PER_IP", "10")
+	os.Setenv("MAGIC_LINK_REQUEST_WINDOW", "30m")
+	os.Setenv("WEBAUTHN_RP_ID", "example.com")
+	os.Setenv("WEBAUTHN_RP_NAME", "Example School")
+	os.Setenv("WEBAUTHN_ORIGINS", "https://app.example.com,https://teachers.example.com")
+	os.Setenv("WEBAUTHN_CHALLENGE_EXPIRY", "2m")
 	os.Setenv("RATE_LIMIT", "200")
 	os.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000,https://example.com")
 	os.Setenv("LOG_LEVEL", "debug")
@@ -166,8 +220,11 @@ func TestLoad_CustomValues(t *testing.T) {
 	if cfg.Database.URL != "postgres://db:5432/mydb" {
 		t.Errorf("Database.URL = %v, want postgres://db:5432/mydb", cfg.Database.URL)
 	}
-	if cfg.JWT.Secret != "my-secret" {
-		t.Errorf("JWT.Secret = %v, want my-secret", cfg.JWT.Secret)
+	if cfg.Database.CleanupInterval != 5*time.Minute {
+		t.Errorf("Database.CleanupInterval = %v, want 5m", cfg.Database.CleanupInterval)
+	}
+	if cfg.JWT.SigningKeysDir != "/etc/keys" {
+		t.Errorf("JWT.SigningKeysDir = %v, want /etc/keys", cfg.JWT.SigningKeysDir)
 	}
 	if cfg.JWT.AccessExpiry != 30*time.Minute {
 		t.Errorf("JWT.AccessExpiry = %v, want 30m", cfg.JWT.AccessExpiry)
@@ -175,6 +232,9 @@ func TestLoad_CustomValues(t *testing.T) {
 	if cfg.JWT.RefreshExpiry != 720*time.Hour {
 		t.Errorf("JWT.RefreshExpiry = %v, want 720h", cfg.JWT.RefreshExpiry)
 	}
+	if cfg.Auth.InvitationExpiry != 24*time.Hour {
+		t.Errorf("Auth.InvitationExpiry = %v, want 24h", cfg.Auth.InvitationExpiry)
+	}
 	if cfg.Storage.Endpoint != "s3.amazonaws.com" {
 		t.Errorf("Storage.Endpoint = %v, want s3.amazonaws.com", cfg.Storage.Endpoint)
 	}
@@ -187,6 +247,114 @@ func TestLoad_CustomValues(t *testing.T) {
 	if !cfg.Storage.Insecure {
 		t.Error("Storage.Insecure = false, want true")
 	}
+	if cfg.Storage.CleanupInterval != 30*time.Second {
+		t.Errorf("Storage.CleanupInterval = %v, want 30s", cfg.Storage.CleanupInterval)
+	}
+	if cfg.Photos.PendingTTL != 2*time.Hour {
+		t.Errorf("Photos.PendingTTL = %v, want 2h", cfg.Photos.PendingTTL)
+	}
+	if cfg.Photos.SweepInterval != 5*time.Minute {
+		t.Errorf("Photos.SweepInterval = %v, want 5m", cfg.Photos.SweepInterval)
+	}
+	if cfg.Photos.ProcessInterval != 15*time.Second {
+		t.Errorf("Photos.ProcessInterval = %v, want 15s", cfg.Photos.ProcessInterval)
+	}
+	if cfg.Auth.PasswordResetExpiry != 15*time.Minute {
+		t.Errorf("Auth.PasswordResetExpiry = %v, want 15m", cfg.Auth.PasswordResetExpiry)
+	}
+	if cfg.Auth.EmailVerificationExpiry != 24*time.Hour {
+		t.Errorf("Auth.EmailVerificationExpiry = %v, want 24h", cfg.Auth.EmailVerificationExpiry)
+	}
+	if len(cfg.Server.TrustedProxies) != 2 || cfg.Server.TrustedProxies[1] != "192.0.2.1" {
+		t.Errorf("Server.TrustedProxies = %v, want [10.0.0.0/8 192.0.2.1]", cfg.Server.TrustedProxies)
+	}
+	if cfg.JWT.RevocationRefreshInterval != 10*time.Second {
+		t.Errorf("JWT.RevocationRefreshInterval = %v, want 10s", cfg.JWT.RevocationRefreshInterval)
+	}
+	if cfg.Auth.ImpersonationExpiry != 5*time.Minute {
+		t.Errorf("Auth.ImpersonationExpiry = %v, want 5m", cfg.Auth.ImpersonationExpiry)
+	}
+	if cfg.Mail.SMTPHost != "smtp.example.com" || cfg.Mail.SMTPPort != 2525 {
+		t.Errorf("Mail SMTP = %s:%d, want smtp.example.com:2525", cfg.Mail.SMTPHost, cfg.Mail.SMTPPort)
+	}
+	if cfg.Mail.SMTPUsername != "mailer" || cfg.Mail.SMTPPassword != "mail-secret" {
+		t.Errorf("Mail credentials = %s/%s, want mailer/mail-secret", cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword)
+	}
+	if cfg.Mail.From != "School <school@example.com>" {
+		t.Errorf("Mail.From = %v, want School <school@example.com>", cfg.Mail.From)
+	}
+	if cfg.Mail.AppBaseURL != "https://app.example.com" {
+		t.Errorf("Mail.AppBaseURL = %v, want https://app.example.com", cfg.Mail.AppBaseURL)
+	}
+	if cfg.MFA.Issuer != "School" {
+		t.Errorf("MFA.Issuer = %v, want School", cfg.MFA.Issuer)
+	}
+	if !cfg.MFA.IsRequired("TEACHER") || !cfg.MFA.IsRequired("ADMIN") || cfg.MFA.IsRequired("PARENT") {
+		t.Errorf("MFA.RequiredRoles = %v, want [TEACHER ADMIN]", cfg.MFA.RequiredRoles)
+	}
+	if cfg.MFA.ChallengeExpiry != 2*time.Minute {
+		t.Errorf("MFA.ChallengeExpiry = %v, want 2m", cfg.MFA.ChallengeExpiry)
+	}
+	if cfg.Password.MinLength != 12 {
+		t.Errorf("Password.MinLength = %v, want 12", cfg.Password.MinLength)
+	}
+	if cfg.Password.BlocklistFile != "/etc/blocklist.txt" {
+		t.Errorf("Password.BlocklistFile = %v, want /etc/blocklist.txt", cfg.Password.BlocklistFile)
+	}
+	if cfg.Password.BreachedDir != "/var/lib/pwned" {
+		t.Errorf("Password.BreachedDir = %v, want /var/lib/pwned", cfg.Password.BreachedDir)
+	}
+	if cfg.Password.Argon2Memory != 19456 || cfg.Password.Argon2Time != 2 || cfg.Password.Argon2Threads != 1 {
+		t.Errorf("Password = %+v, want m=19456 t=2 p=1", cfg.Password)
+	}
+	if cfg.Login.MaxAccountAttempts != 3 {
+		t.Errorf("Login.MaxAccountAttempts = %v, want 3", cfg.Login.MaxAccountAttempts)
+	}
+	if cfg.Login.MaxIPAttempts != 50 {
+		t.Errorf("Login.MaxIPAttempts = %v, want 50", cfg.Login.MaxIPAttempts)
+	}
+	if cfg.Login.LockoutBase != 30*time.Second {
+		t.Errorf("Login.LockoutBase = %v, want 30s", cfg.Login.LockoutBase)
+	}
+	if cfg.Login.LockoutMax != 2*time.Hour {
+		t.Errorf("Login.LockoutMax = %v, want 2h", cfg.Login.LockoutMax)
+	}
+	if cfg.Login.FailureWindow != 12*time.Hour {
+		t.Errorf("Login.FailureWindow = %v, want 12h", cfg.Login.FailureWindow)
+	}
+	if cfg.OIDC.ProvidersFile != "/etc/tinyschoolhub/oidc.json" {
+		t.Errorf("OIDC.ProvidersFile = %v, want /etc/tinyschoolhub/oidc.json", cfg.OIDC.ProvidersFile)
+	}
+	if cfg.OIDC.StateExpiry != 5*time.Minute {
+		t.Errorf("OIDC.StateExpiry = %v, want 5m", cfg.OIDC.StateExpiry)
+	}
+	if cfg.MagicLink.Enabled {
+		t.Error("MagicLink.Enabled = true, want false")
+	}
+	if !cfg.MagicLink.AllowsRole("TEACHER") || !cfg.MagicLink.AllowsRole("PARENT") || cfg.MagicLink.AllowsRole("ADMIN") {
+		t.Errorf("MagicLink.Roles = %v, want PARENT and TEACHER", cfg.MagicLink.Roles)
+	}
+	if cfg.MagicLink.Expiry != 10*time.Minute {
+		t.Errorf("MagicLink.Expiry = %v, want 10m", cfg.MagicLink.Expiry)
+	}
+	if cfg.MagicLink.MaxPerEmail != 2 || cfg.MagicLink.MaxPerIP != 10 {
+		t.Errorf("MagicLink limits = %v/%v, want 2/10", cfg.MagicLink.MaxPerEmail, cfg.MagicLink.MaxPerIP)
+	}
+	if cfg.MagicLink.RequestWindow != 30*time.Minute {
+		t.Errorf("MagicLink.RequestWindow = %v, want 30m", cfg.MagicLink.RequestWindow)
+	}
+	if cfg.WebAuthn.RPID != "example.com" {
+		t.Errorf("WebAuthn.RPID = %v, want example.com", cfg.WebAuthn.RPID)
+	}
+	if cfg.WebAuthn.RPName != "Example School" {
+		t.Errorf("WebAuthn.RPName = %v, want Example School", cfg.WebAuthn.RPName)
+	}
+	if len(cfg.WebAuthn.Origins) != 2 {
+		t.Errorf("WebAuthn.Origins length = %v, want 2", len(cfg.WebAuthn.Origins))
+	}
+	if cfg.WebAuthn.ChallengeExpiry != 2*time.Minute {
+		t.Errorf("WebAuthn.ChallengeExpiry = %v, want 2m", cfg.WebAuthn.ChallengeExpiry)
+	}
 	if cfg.RateLimit != 200 {
 		t.Errorf("RateLimit = %v, want 200", cfg.RateLimit)
 	}
@@ -376,7 +544,8 @@ func TestGetEnv(t *testing.T) {
 func TestValidate(t *testing.T) {
 	baseConfig := &Config{
 		Database: DatabaseConfig{URL: "postgres://localhost:5432/db"},
-		JWT:      JWTConfig{Secret: "secret"},
+		JWT:      JWTConfig{SigningKeysDir: "/etc/keys"},
+		Password: PasswordConfig{Argon2Memory: 65536, Argon2Time: 3, Argon2Threads: 4},
 		Storage: StorageConfig{
 			Endpoint:  "localhost:9000",
 			Bucket:    "bucket",
@@ -403,11 +572,26 @@ func TestValidate(t *testing.T) {
 			wantErr: "DATABASE_URL is required",
 		},
 		{
-			name: "missing JWT secret",
+			name: "missing JWT signing keys",
 			modify: func(c *Config) {
-				c.JWT.Secret = ""
+				c.JWT.SigningKeysDir = ""
 			},
-			wantErr: "JWT_SECRET is required",
+			wantErr: "JWT_SIGNING_KEYS_DIR is required",
+		},
+		{
+			name: "development generates signing keys",
+			modify: func(c *Config) {
+				c.Server.Env = "development"
+				c.JWT.SigningKeysDir = ""
+			},
+			wantErr: "",
+		},
+		{
+			name: "invalid argon2 threads",
+			modify: func(c *Config) {
+				c.Password.Argon2Threads = 256
+			},
+			wantErr: "PASSWORD_ARGON2_MEMORY, PASSWORD_ARGON2_TIME and PASSWORD_ARGON2_THREADS must be positive, with at most 255 threads",
 		},
 		{
 			name: "missing storage endpoint",
@@ -443,8 +627,10 @@ func TestValidate(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a copy of base config
 			cfg := &Config{
+				Server:   baseConfig.Server,
 				Database: baseConfig.Database,
 				JWT:      baseConfig.JWT,
+				Password: baseConfig.Password,
 				Storage:  baseConfig.Storage,
 			}
 			tt.modify(cfg)
@@ -465,14 +651,51 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestLoginConfig_LockoutDuration(t *testing.T) {
+	cfg := &LoginConfig{LockoutBase: time.Minute, LockoutMax: 10 * time.Minute}
+
+	tests := []struct {
+		name        string
+		failures    int
+		maxAttempts int
+		want        time.Duration
+	}{
+		{"below limit", 4, 5, 0},
+		{"limit reached", 5, 5, time.Minute},
+		{"one more failure doubles", 6, 5, 2 * time.Minute},
+		{"two more failures", 7, 5, 4 * time.Minute},
+		{"capped", 9, 5, 10 * time.Minute},
+		{"far past the limit", 1000, 5, 10 * time.Minute},
+		{"disabled", 100, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.LockoutDuration(tt.failures, tt.maxAttempts); got != tt.want {
+				t.Errorf("LockoutDuration(%d, %d) = %v, want %v", tt.failures, tt.maxAttempts, got, tt.want)
+			}
+		})
+	}
+}
+
 // Helper function to cleanup environment variables
 func cleanupEnv() {
 	envVars := []string{
-		"PORT", "ENV", "DATABASE_URL", "JWT_SECRET",
-		"JWT_ACCESS_EXPIRY", "JWT_REFRESH_EXPIRY",
+		"PORT", "ENV", "TRUSTED_PROXIES", "DATABASE_URL", "DB_CLEANUP_INTERVAL", "JWT_SIGNING_KEYS_DIR",
+		"JWT_ACCESS_EXPIRY", "JWT_REFRESH_EXPIRY", "JWT_REVOCATION_REFRESH_INTERVAL", "INVITATION_EXPIRY", "PASSWORD_RESET_EXPIRY", "EMAIL_VERIFICATION_EXPIRY", "IMPERSONATION_EXPIRY",
 		"STORAGE_ENDPOINT", "STORAGE_REGION", "STORAGE_BUCKET",
 		"STORAGE_ACCESS_KEY", "STORAGE_SECRET_KEY",
-		"STORAGE_USE_PATH_STYLE", "STORAGE_INSECURE",
+		"STORAGE_USE_PATH_STYLE", "STORAGE_INSECURE", "STORAGE_CLEANUP_INTERVAL",
+		"PHOTO_PENDING_TTL", "PHOTO_SWEEP_INTERVAL", "PHOTO_PROCESS_INTERVAL",
+		"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "MAIL_FROM", "APP_BASE_URL",
+		"MFA_ISSUER", "MFA_REQUIRED_ROLES", "MFA_CHALLENGE_EXPIRY",
+		"PASSWORD_MIN_LENGTH", "PASSWORD_BLOCKLIST_FILE", "PASSWORD_BREACHED_DIR",
+		"PASSWORD_ARGON2_MEMORY", "PASSWORD_ARGON2_TIME", "PASSWORD_ARGON2_THREADS",
+		"LOGIN_MAX_ACCOUNT_ATTEMPTS", "LOGIN_MAX_IP_ATTEMPTS", "LOGIN_LOCKOUT_BASE", "LOGIN_LOCKOUT_MAX", "LOGIN_FAILURE_WINDOW",
+		"OIDC_PROVIDERS_FILE", "OIDC_STATE_EXPIRY",
+		"MAGIC_LINK_ENABLED", "MAGIC_LINK_ROLES", "MAGIC_LINK_EXPIRY",
+		"MAGIC_LINK_MAX_PER_EMAIL", "MAGIC_LINK_MAX_PER_IP", "MAGIC_LINK_REQUEST_WINDOW",
+		"WEBAUTHN_RP_ID", "WEBAUTHN_RP_NAME", "WEBAUTHN_ORIGINS", "WEBAUTHN_CHALLENGE_EXPIRY",
 		"RATE_LIMIT", "CORS_ALLOWED_ORIGINS",
 		"LOG_LEVEL", "LOG_FORMAT",
 	}
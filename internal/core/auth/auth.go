@@ -5,130 +5,133 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/argon2"
+	"github.com/google/uuid"
 )
 
-// Argon2 parameters for password hashing
-const (
-	argon2Time        = 1
-	argon2Memory      = 64 * 1024
-	argon2Threads     = 4
-	argon2KeyLen      = 32
-	saltLength        = 16
-	refreshTokenBytes = 32
-)
+const refreshTokenBytes = 32
+
+// APIKeyPrefix starts every API key, which tells keys apart from access
+// tokens in the Authorization header
+const APIKeyPrefix = "tsh_"
+
+// apiKeyDisplayLength is how much of an API key is kept to recognize it
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+// Token times are kept to the millisecond instead of the whole second, so an
+// access token revocation can tell tokens issued just before it from tokens
+// issued just after it
+func init() {
+	jwt.TimePrecision = time.Millisecond
+}
 
 // Claims represents JWT claims
 type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// SessionID identifies the login session the token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// Unverified is set while the user has not verified their email address.
+	// It is omitted once verified so tokens issued before the claim existed
+	// are treated as verified.
+	Unverified bool `json:"unverified,omitempty"`
+	// Actor is set on impersonation tokens and names the admin acting as
+	// the user, following the act claim of RFC 8693
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// HashPassword hashes a password using argon2id
-func HashPassword(password string) (string, error) {
-	salt := make([]byte, saltLength)
-	if _, err := rand.Read(salt); err != nil {
-		return "", fmt.Errorf("failed to generate salt: %w", err)
-	}
+// Actor identifies who is acting on behalf of the subject of a token
+type Actor struct {
+	UserID string `json:"sub"`
+	Email  string `json:"email,omitempty"`
+}
 
-	hash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+// GenerateAccessToken generates a JWT access token
+func GenerateAccessToken(userID, email, role string, keys *KeySet, expiry time.Duration) (string, error) {
+	return GenerateSessionAccessToken(userID, email, role, "", keys, expiry)
+}
 
-	// Format: base64(salt):base64(hash)
-	encoded := base64.RawStdEncoding.EncodeToString(salt) + ":" + base64.RawStdEncoding.EncodeToString(hash)
-	return encoded, nil
+// GenerateSessionAccessToken generates a JWT access token bound to a session
+func GenerateSessionAccessToken(userID, email, role, sessionID string, keys *KeySet, expiry time.Duration) (string, error) {
+	return SignAccessToken(&Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+	}, keys, expiry)
 }
 
-// VerifyPassword verifies a password against a hash
-func VerifyPassword(password, encoded string) (bool, error) {
-	// Parse salt and hash
-	var salt, hash []byte
-	var err error
-
-	parts := []byte(encoded)
-	colonIdx := -1
-	for i, b := range parts {
-		if b == ':' {
-			colonIdx = i
-			break
-		}
-	}
-	if colonIdx == -1 {
-		return false, fmt.Errorf("invalid hash format")
+// SignAccessToken signs claims as an access token valid for expiry from now.
+// It sets the registered claims: a unique jti and the time claims. The token
+// is signed by the currently active key of the set and names it in the kid
+// header.
+func SignAccessToken(claims *Claims, keys *KeySet, expiry time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
 	}
 
-	salt, err = base64.RawStdEncoding.DecodeString(string(parts[:colonIdx]))
-	if err != nil {
-		return false, fmt.Errorf("failed to decode salt: %w", err)
-	}
+	return keys.sign(claims, now)
+}
 
-	hash, err = base64.RawStdEncoding.DecodeString(string(parts[colonIdx+1:]))
+// GenerateRefreshToken generates a random refresh token
+func GenerateRefreshToken() (string, error) {
+	token, err := GenerateOpaqueToken()
 	if err != nil {
-		return false, fmt.Errorf("failed to decode hash: %w", err)
-	}
-
-	// Hash the password with the same salt
-	computedHash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
-
-	// Compare hashes
-	if len(computedHash) != len(hash) {
-		return false, nil
-	}
-
-	for i := range computedHash {
-		if computedHash[i] != hash[i] {
-			return false, nil
-		}
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
 	}
+	return token, nil
+}
 
-	return true, nil
+// HashRefreshToken hashes a refresh token for storage
+func HashRefreshToken(token string) string {
+	return HashToken(token)
 }
 
-// GenerateAccessToken generates a JWT access token
-func GenerateAccessToken(userID, email, role, secret string, expiry time.Duration) (string, error) {
-	now := time.Now()
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+// GenerateOpaqueToken generates a random single-use token such as an invitation
+// token. Only its hash (see HashToken) should ever be stored.
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// GenerateRefreshToken generates a random refresh token
-func GenerateRefreshToken() (string, error) {
+// GenerateAPIKey generates an API key and the start of it that is shown to
+// recognize it. Only the hash of the key (see HashToken) should be stored.
+func GenerateAPIKey() (key, displayPrefix string, err error) {
 	b := make([]byte, refreshTokenBytes)
 	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
 	}
-	return base64.URLEncoding.EncodeToString(b), nil
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyDisplayLength], nil
 }
 
-// HashRefreshToken hashes a refresh token for storage
-func HashRefreshToken(token string) string {
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashToken hashes an opaque token for storage and lookup
+func HashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
 	return base64.URLEncoding.EncodeToString(hash[:])
 }
 
-// ValidateAccessToken validates a JWT access token
-func ValidateAccessToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+// ValidateAccessToken validates a JWT access token against any key in the set
+func ValidateAccessToken(tokenString string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.verificationKey,
+		jwt.WithValidMethods(keys.algorithms()))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
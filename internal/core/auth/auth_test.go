@@ -1,11 +1,16 @@
 package auth
 
 import (
+	"encoding/base64"
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/argon2"
 )
 
+var testArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 1, Threads: 4}
+
 func TestHashPassword(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -36,17 +41,20 @@ func TestHashPassword(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			hash, err := HashPassword(tt.password)
+			hash, err := HashPassword(tt.password, testArgon2Params)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("HashPassword() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
 			if !tt.wantErr {
-				// Verify hash format (salt:hash)
-				parts := strings.Split(hash, ":")
-				if len(parts) != 2 {
-					t.Errorf("HashPassword() hash format incorrect, got %d parts, want 2", len(parts))
+				// Verify hash format ($argon2id$v=19$m=...,t=...,p=...$salt$hash)
+				parts := strings.Split(hash, "$")
+				if len(parts) != 6 {
+					t.Errorf("HashPassword() hash format incorrect, got %d parts, want 6", len(parts))
+				}
+				if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$") {
+					t.Errorf("HashPassword() = %s, want argon2id PHC string with the given parameters", hash)
 				}
 
 				// Verify hash is not empty
@@ -60,7 +68,7 @@ func TestHashPassword(t *testing.T) {
 
 func TestVerifyPassword(t *testing.T) {
 	password := "correctPassword123"
-	hash, err := HashPassword(password)
+	hash, err := HashPassword(password, testArgon2Params)
 	if err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
@@ -126,12 +134,12 @@ func TestVerifyPassword(t *testing.T) {
 func TestHashPasswordUniqueness(t *testing.T) {
 	password := "samePassword"
 
-	hash1, err := HashPassword(password)
+	hash1, err := HashPassword(password, testArgon2Params)
 	if err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
 
-	hash2, err := HashPassword(password)
+	hash2, err := HashPassword(password, testArgon2Params)
 	if err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
@@ -150,8 +158,84 @@ func TestHashPasswordUniqueness(t *testing.T) {
 	}
 }
 
+// legacyHash builds a hash in the salt:hash format stored before hashes
+// recorded their parameters
+func legacyHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+	return base64.RawStdEncoding.EncodeToString(salt) + ":" + base64.RawStdEncoding.EncodeToString(hash)
+}
+
+func TestVerifyPassword_Legacy(t *testing.T) {
+	hash := legacyHash("legacyPassword")
+
+	valid, err := VerifyPassword("legacyPassword", hash)
+	if err != nil || !valid {
+		t.Errorf("VerifyPassword() = %v, %v, want true for legacy hash", valid, err)
+	}
+
+	valid, err = VerifyPassword("wrongPassword", hash)
+	if err != nil || valid {
+		t.Errorf("VerifyPassword() = %v, %v, want false for wrong password", valid, err)
+	}
+}
+
+func TestVerifyPassword_UsesStoredParams(t *testing.T) {
+	params := Argon2Params{Memory: 8 * 1024, Time: 2, Threads: 1}
+	hash, err := HashPassword("password", params)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	valid, err := VerifyPassword("password", hash)
+	if err != nil || !valid {
+		t.Errorf("VerifyPassword() = %v, %v, want true", valid, err)
+	}
+
+	invalid := []string{
+		strings.Replace(hash, "$argon2id$", "$argon2i$", 1),
+		strings.Replace(hash, "v=19", "v=16", 1),
+		strings.Replace(hash, "m=8192,t=2,p=1", "m=0,t=2,p=1", 1),
+		strings.Replace(hash, "m=8192,t=2,p=1", "garbage", 1),
+	}
+	for _, encoded := range invalid {
+		if _, err := VerifyPassword("password", encoded); err == nil {
+			t.Errorf("VerifyPassword(%q) should fail", encoded)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, err := HashPassword("password", testArgon2Params)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	weaker, err := HashPassword("password", Argon2Params{Memory: 8 * 1024, Time: 1, Threads: 1})
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"current parameters", current, false},
+		{"outdated parameters", weaker, true},
+		{"legacy format", legacyHash("password"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.hash, testArgon2Params); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGenerateAccessToken(t *testing.T) {
-	secret := "test-secret-key"
+	keys := newTestKeySet(t)
 
 	tests := []struct {
 		name    string
@@ -181,7 +265,7 @@ func TestGenerateAccessToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateAccessToken(tt.userID, tt.email, tt.role, secret, tt.expiry)
+			token, err := GenerateAccessToken(tt.userID, tt.email, tt.role, keys, tt.expiry)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GenerateAccessToken() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -196,7 +280,7 @@ func TestGenerateAccessToken(t *testing.T) {
 			}
 
 			// Verify token can be parsed
-			claims, err := ValidateAccessToken(token, secret)
+			claims, err := ValidateAccessToken(token, keys)
 			if err != nil {
 				t.Errorf("Generated token is invalid: %v", err)
 				return
@@ -216,17 +300,17 @@ func TestGenerateAccessToken(t *testing.T) {
 }
 
 func TestValidateAccessToken(t *testing.T) {
-	secret := "test-secret-key"
+	keys := newTestKeySet(t)
 	userID := "user-123"
 	email := "test@example.com"
 	role := "PARENT"
 
-	validToken, err := GenerateAccessToken(userID, email, role, secret, 15*time.Minute)
+	validToken, err := GenerateAccessToken(userID, email, role, keys, 15*time.Minute)
 	if err != nil {
 		t.Fatalf("Failed to generate token: %v", err)
 	}
 
-	expiredToken, err := GenerateAccessToken(userID, email, role, secret, -1*time.Hour)
+	expiredToken, err := GenerateAccessToken(userID, email, role, keys, -1*time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to generate expired token: %v", err)
 	}
@@ -234,44 +318,44 @@ func TestValidateAccessToken(t *testing.T) {
 	tests := []struct {
 		name    string
 		token   string
-		secret  string
+		keys    *KeySet
 		wantErr bool
 	}{
 		{
 			name:    "valid token",
 			token:   validToken,
-			secret:  secret,
+			keys:    keys,
 			wantErr: false,
 		},
 		{
 			name:    "expired token",
 			token:   expiredToken,
-			secret:  secret,
+			keys:    keys,
 			wantErr: true,
 		},
 		{
-			name:    "wrong secret",
+			name:    "signed by another key",
 			token:   validToken,
-			secret:  "wrong-secret",
+			keys:    newTestKeySet(t),
 			wantErr: true,
 		},
 		{
 			name:    "invalid token format",
 			token:   "invalid.token.here",
-			secret:  secret,
+			keys:    keys,
 			wantErr: true,
 		},
 		{
 			name:    "empty token",
 			token:   "",
-			secret:  secret,
+			keys:    keys,
 			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			claims, err := ValidateAccessToken(tt.token, tt.secret)
+			claims, err := ValidateAccessToken(tt.token, tt.keys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateAccessToken() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -292,6 +376,118 @@ func TestValidateAccessToken(t *testing.T) {
 	}
 }
 
+func TestGenerateSessionAccessToken(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := GenerateSessionAccessToken("user-1", "user@test.com", "PARENT", "session-1", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateSessionAccessToken() error = %v", err)
+	}
+
+	claims, err := ValidateAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if claims.SessionID != "session-1" {
+		t.Errorf("SessionID = %q, want session-1", claims.SessionID)
+	}
+}
+
+func TestSignAccessToken_Unverified(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := SignAccessToken(&Claims{UserID: "user-1", Role: "PARENT", Unverified: true}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("SignAccessToken() error = %v", err)
+	}
+
+	claims, err := ValidateAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if !claims.Unverified {
+		t.Error("Unverified = false, want true")
+	}
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		t.Error("SignAccessToken() should set expiry and issued at")
+	}
+	if claims.ID == "" {
+		t.Error("SignAccessToken() should set a jti")
+	}
+
+	// Tokens of verified users do not carry the claim at all
+	jti := claims.ID
+	token, err = GenerateAccessToken("user-1", "user@test.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	claims, err = ValidateAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if claims.Unverified {
+		t.Error("Unverified = true, want false")
+	}
+	if claims.ID == jti {
+		t.Error("Every token should get its own jti")
+	}
+}
+
+func TestSignAccessToken_Actor(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := SignAccessToken(&Claims{
+		UserID: "user-1",
+		Role:   "PARENT",
+		Actor:  &Actor{UserID: "admin-1", Email: "admin@test.com"},
+	}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("SignAccessToken() error = %v", err)
+	}
+
+	claims, err := ValidateAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if claims.Actor == nil || claims.Actor.UserID != "admin-1" || claims.Actor.Email != "admin@test.com" {
+		t.Errorf("Actor = %+v, want admin-1", claims.Actor)
+	}
+
+	// Regular tokens do not carry the claim at all
+	token, err = GenerateAccessToken("user-1", "user@test.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	claims, err = ValidateAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if claims.Actor != nil {
+		t.Errorf("Actor = %+v, want nil", claims.Actor)
+	}
+}
+
+func TestSignAccessToken_IssuedAtPrecision(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	before := time.Now().Truncate(time.Millisecond)
+	token, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+
+	claims, err := ValidateAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	// Reading the claim back as a float may lose a millisecond, but never
+	// moves the issue time later
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.Before(before.Add(-time.Millisecond)) || issuedAt.After(time.Now()) {
+		t.Errorf("IssuedAt = %v, want the signing time to the millisecond (%v)", issuedAt, before)
+	}
+}
+
 func TestGenerateRefreshToken(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -368,16 +564,84 @@ func TestHashRefreshToken(t *testing.T) {
 	}
 }
 
+func TestGenerateOpaqueToken(t *testing.T) {
+	token1, err := GenerateOpaqueToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	token2, err := GenerateOpaqueToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	if len(token1) < 32 {
+		t.Errorf("GenerateOpaqueToken() token too short: %d bytes", len(token1))
+	}
+	if token1 == token2 {
+		t.Error("GenerateOpaqueToken() should generate unique tokens")
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+
+	if !IsAPIKey(key) {
+		t.Errorf("IsAPIKey(%q) = false", key)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != len(APIKeyPrefix)+8 {
+		t.Errorf("GenerateAPIKey() prefix = %q, want the first characters of %q", prefix, key)
+	}
+	if len(key) < 40 {
+		t.Errorf("GenerateAPIKey() key too short: %d bytes", len(key))
+	}
+
+	other, _, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+	if key == other {
+		t.Error("GenerateAPIKey() should generate unique keys")
+	}
+
+	// Access tokens are JWTs, which never start with the prefix
+	keys := newTestKeySet(t)
+	token, err := GenerateAccessToken("user-1", "test@example.com", "TEACHER", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if IsAPIKey(token) {
+		t.Error("IsAPIKey() = true for an access token")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token := "test-invitation-token"
+
+	if HashToken(token) != HashToken(token) {
+		t.Error("HashToken() should be deterministic")
+	}
+	if HashToken(token) == token {
+		t.Error("HashToken() should not return the original token")
+	}
+	if HashToken(token) != HashRefreshToken(token) {
+		t.Error("HashToken() and HashRefreshToken() should hash the same way")
+	}
+}
+
 func TestClaimsValidation(t *testing.T) {
-	secret := "test-secret"
+	keys := newTestKeySet(t)
 
 	t.Run("token with future expiry is valid", func(t *testing.T) {
-		token, err := GenerateAccessToken("user-1", "user@test.com", "TEACHER", secret, 1*time.Hour)
+		token, err := GenerateAccessToken("user-1", "user@test.com", "TEACHER", keys, 1*time.Hour)
 		if err != nil {
 			t.Fatalf("Failed to generate token: %v", err)
 		}
 
-		claims, err := ValidateAccessToken(token, secret)
+		claims, err := ValidateAccessToken(token, keys)
 		if err != nil {
 			t.Errorf("Token should be valid: %v", err)
 		}
@@ -388,12 +652,12 @@ func TestClaimsValidation(t *testing.T) {
 	})
 
 	t.Run("token with past expiry is invalid", func(t *testing.T) {
-		token, err := GenerateAccessToken("user-1", "user@test.com", "TEACHER", secret, -1*time.Hour)
+		token, err := GenerateAccessToken("user-1", "user@test.com", "TEACHER", keys, -1*time.Hour)
 		if err != nil {
 			t.Fatalf("Failed to generate token: %v", err)
 		}
 
-		_, err = ValidateAccessToken(token, secret)
+		_, err = ValidateAccessToken(token, keys)
 		if err == nil {
 			t.Error("Expired token should be invalid")
 		}
@@ -405,13 +669,13 @@ func BenchmarkHashPassword(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = HashPassword(password)
+		_, _ = HashPassword(password, testArgon2Params)
 	}
 }
 
 func BenchmarkVerifyPassword(b *testing.B) {
 	password := "benchmarkPassword123"
-	hash, _ := HashPassword(password)
+	hash, _ := HashPassword(password, testArgon2Params)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -420,20 +684,20 @@ func BenchmarkVerifyPassword(b *testing.B) {
 }
 
 func BenchmarkGenerateAccessToken(b *testing.B) {
-	secret := "test-secret"
+	keys := newTestKeySet(b)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = GenerateAccessToken("user-123", "test@example.com", "TEACHER", secret, 15*time.Minute)
+		_, _ = GenerateAccessToken("user-123", "test@example.com", "TEACHER", keys, 15*time.Minute)
 	}
 }
 
 func BenchmarkValidateAccessToken(b *testing.B) {
-	secret := "test-secret"
-	token, _ := GenerateAccessToken("user-123", "test@example.com", "TEACHER", secret, 15*time.Minute)
+	keys := newTestKeySet(b)
+	token, _ := GenerateAccessToken("user-123", "test@example.com", "TEACHER", keys, 15*time.Minute)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = ValidateAccessToken(token, secret)
+		_, _ = ValidateAccessToken(token, keys)
 	}
 }
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	minRSAKeyBits = 2048
+	// pemNotBeforeHeader is the optional PEM header that schedules when a key
+	// starts signing tokens
+	pemNotBeforeHeader = "Not-Before"
+)
+
+var (
+	// ErrNoSigningKey is returned when no key in the set is active yet
+	ErrNoSigningKey = errors.New("no active signing key")
+	// ErrUnknownKey is returned for tokens signed by a key not in the set
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// SigningKey is a private key that signs access tokens. Its ID is sent as the
+// kid header so verifiers can pick the matching public key.
+type SigningKey struct {
+	ID string
+	// Key is an ECDSA P-256, RSA (2048 bits or more) or Ed25519 private key
+	Key crypto.Signer
+	// NotBefore is when the key starts signing. Until then it is only
+	// published, so verifiers can fetch it before tokens signed with it appear.
+	NotBefore time.Time
+
+	method jwt.SigningMethod
+}
+
+// KeySet holds the keys that sign and verify access tokens. The active key
+// with the latest NotBefore signs; every key in the set verifies, so tokens
+// signed before a rotation stay valid until they expire.
+type KeySet struct {
+	keys []*SigningKey
+	byID map[string]*SigningKey
+}
+
+// NewKeySet creates a key set. Key IDs must be unique.
+func NewKeySet(keys ...*SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key set needs at least one key")
+	}
+
+	ks := &KeySet{byID: make(map[string]*SigningKey, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key has no ID")
+		}
+		if _, exists := ks.byID[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key ID %q", key.ID)
+		}
+		method, err := signingMethodFor(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", key.ID, err)
+		}
+		key.method = method
+		ks.keys = append(ks.keys, key)
+		ks.byID[key.ID] = key
+	}
+
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].NotBefore.Before(ks.keys[j].NotBefore)
+	})
+	return ks, nil
+}
+
+// GenerateSigningKey generates an ECDSA P-256 key that is active immediately.
+// It is meant for development and tests, where keys do not have to survive a
+// restart.
+func GenerateSigningKey(id string) (*SigningKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return &SigningKey{ID: id, Key: key}, nil
+}
+
+// LoadKeySet loads every *.pem file in dir as a signing key. The file name
+// without its extension is the key ID. A "Not-Before" PEM header with an
+// RFC 3339 time schedules when the key starts signing.
+func LoadKeySet(dir string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem signing keys found in %s", dir)
+	}
+
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path comes from operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+	}
+
+	key := &SigningKey{
+		ID:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Key: signer,
+	}
+	if notBefore, ok := block.Headers[pemNotBeforeHeader]; ok {
+		key.NotBefore, err = time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s header: %w", path, pemNotBeforeHeader, err)
+		}
+	}
+	return key, nil
+}
+
+// sign signs claims with the key that is active at now
+func (ks *KeySet) sign(claims jwt.Claims, now time.Time) (string, error) {
+	var active *SigningKey
+	for _, key := range ks.keys {
+		if key.NotBefore.After(now) {
+			break
+		}
+		active = key
+	}
+	if active == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.ID
+	return token.SignedString(active.Key)
+}
+
+// verificationKey is a jwt.Keyfunc that returns the public key named by the
+// token's kid header, as long as the token uses that key's algorithm
+func (ks *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.byID[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Key.Public(), nil
+}
+
+// algorithms lists the signing algorithms of the keys in the set
+func (ks *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, including keys that are scheduled
+// but not signing yet
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.method.Alg()}
+		switch pub := key.Key.Public().(type) {
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = pub.Curve.Params().Name
+			jwk.X = base64URL(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64URL(pub.Y.FillBytes(make([]byte, size)))
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64URL(pub.N.Bytes())
+			jwk.E = base64URL(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64URL(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// signingMethodFor returns the JWT algorithm for a private key
+func signingMethodFor(key crypto.Signer) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s, use P-256", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
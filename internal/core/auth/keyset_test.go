@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKeySet(tb testing.TB) *KeySet {
+	tb.Helper()
+
+	key, err := GenerateSigningKey("test-key")
+	if err != nil {
+		tb.Fatalf("GenerateSigningKey() error = %v", err)
+	}
+	keys, err := NewKeySet(key)
+	if err != nil {
+		tb.Fatalf("NewKeySet() error = %v", err)
+	}
+	return keys
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeySet_Algorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		wantAlg string
+		wantKty string
+	}{
+		{name: "ES256", key: ecKey, wantAlg: "ES256", wantKty: "EC"},
+		{name: "RS256", key: rsaKey, wantAlg: "RS256", wantKty: "RSA"},
+		{name: "EdDSA", key: edKey, wantAlg: "EdDSA", wantKty: "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewKeySet(&SigningKey{ID: tt.name, Key: tt.key})
+			if err != nil {
+				t.Fatalf("NewKeySet() error = %v", err)
+			}
+
+			token, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", keys, time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateAccessToken() error = %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified() error = %v", err)
+			}
+			if parsed.Method.Alg() != tt.wantAlg {
+				t.Errorf("alg = %s, want %s", parsed.Method.Alg(), tt.wantAlg)
+			}
+			if parsed.Header["kid"] != tt.name {
+				t.Errorf("kid = %v, want %s", parsed.Header["kid"], tt.name)
+			}
+
+			claims, err := ValidateAccessToken(token, keys)
+			if err != nil {
+				t.Fatalf("ValidateAccessToken() error = %v", err)
+			}
+			if claims.UserID != "user-1" {
+				t.Errorf("UserID = %s, want user-1", claims.UserID)
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS() has %d keys, want 1", len(jwks.Keys))
+			}
+			jwk := jwks.Keys[0]
+			if jwk.KeyType != tt.wantKty || jwk.Algorithm != tt.wantAlg || jwk.KeyID != tt.name || jwk.Use != "sig" {
+				t.Errorf("JWKS() key = %+v", jwk)
+			}
+		})
+	}
+}
+
+func TestNewKeySet_Invalid(t *testing.T) {
+	valid, err := GenerateSigningKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024) //nolint:gosec // testing that weak keys are rejected
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		keys []*SigningKey
+	}{
+		{name: "no keys", keys: nil},
+		{name: "missing ID", keys: []*SigningKey{{Key: valid.Key}}},
+		{name: "duplicate ID", keys: []*SigningKey{valid, {ID: "a", Key: valid.Key}}},
+		{name: "unsupported curve", keys: []*SigningKey{{ID: "p384", Key: p384}}},
+		{name: "short RSA key", keys: []*SigningKey{{ID: "rsa", Key: smallRSA}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeySet(tt.keys...); err == nil {
+				t.Error("NewKeySet() should fail")
+			}
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	now := time.Now()
+
+	old, err := GenerateSigningKey("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.NotBefore = now.Add(-48 * time.Hour)
+	current, err := GenerateSigningKey("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.NotBefore = now.Add(-time.Hour)
+	next, err := GenerateSigningKey("next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.NotBefore = now.Add(24 * time.Hour)
+
+	keys, err := NewKeySet(next, old, current)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	token, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	if kid := tokenKeyID(t, token); kid != "current" {
+		t.Errorf("token signed by %q, want current", kid)
+	}
+
+	// Tokens from the previous key stay valid until it is removed from the set
+	oldOnly, err := NewKeySet(&SigningKey{ID: "old", Key: old.Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", oldOnly, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateAccessToken(oldToken, keys); err != nil {
+		t.Errorf("token from previous key should validate: %v", err)
+	}
+
+	// The next key is published before it signs
+	if got := len(keys.JWKS().Keys); got != 3 {
+		t.Errorf("JWKS() has %d keys, want 3", got)
+	}
+
+	pending, err := NewKeySet(&SigningKey{ID: "next", Key: next.Key, NotBefore: next.NotBefore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", pending, time.Minute); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("GenerateAccessToken() error = %v, want ErrNoSigningKey", err)
+	}
+}
+
+func TestValidateAccessToken_KeyMismatch(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	t.Run("unknown kid", func(t *testing.T) {
+		other, err := GenerateSigningKey("other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherKeys, err := NewKeySet(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", otherKeys, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateAccessToken(token, keys); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("ValidateAccessToken() error = %v, want ErrUnknownKey", err)
+		}
+	})
+
+	t.Run("HMAC token", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "user-1"})
+		token.Header["kid"] = "test-key"
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateAccessToken(signed, keys); err == nil {
+			t.Error("HMAC signed token should be rejected")
+		}
+	})
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "2026-01.pem"), &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	writePEM(t, filepath.Join(dir, "2026-02.pem"), &pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{"Not-Before": notBefore},
+		Bytes:   der,
+	})
+
+	keys, err := LoadKeySet(dir)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+
+	token, err := GenerateAccessToken("user-1", "user@test.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	if kid := tokenKeyID(t, token); kid != "2026-01" {
+		t.Errorf("token signed by %q, want 2026-01", kid)
+	}
+	if got := len(keys.JWKS().Keys); got != 2 {
+		t.Errorf("JWKS() has %d keys, want 2", got)
+	}
+
+	t.Run("empty directory", func(t *testing.T) {
+		if _, err := LoadKeySet(t.TempDir()); err == nil {
+			t.Error("LoadKeySet() should fail without keys")
+		}
+	})
+
+	t.Run("invalid Not-Before header", func(t *testing.T) {
+		bad := t.TempDir()
+		writePEM(t, filepath.Join(bad, "bad.pem"), &pem.Block{
+			Type:    "PRIVATE KEY",
+			Headers: map[string]string{"Not-Before": "tomorrow"},
+			Bytes:   der,
+		})
+		if _, err := LoadKeySet(bad); err == nil || !strings.Contains(err.Error(), "Not-Before") {
+			t.Errorf("LoadKeySet() error = %v, want Not-Before error", err)
+		}
+	})
+}
+
+func writePEM(t *testing.T, path string, block *pem.Block) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
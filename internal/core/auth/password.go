@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2KeyLen = 32
+	saltLength   = 16
+)
+
+// ErrInvalidHash is returned for stored password hashes that cannot be parsed
+var ErrInvalidHash = errors.New("invalid password hash format")
+
+// Argon2Params are the argon2id cost parameters of a password hash
+type Argon2Params struct {
+	// Memory is in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// legacyArgon2Params are the fixed parameters of hashes stored in the old
+// base64(salt):base64(hash) format, which did not record them
+var legacyArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 1, Threads: 4}
+
+// HashPassword hashes a password using argon2id. The result is a PHC string
+// that records the parameters, e.g. $argon2id$v=19$m=65536,t=3,p=4$salt$hash.
+func HashPassword(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPassword verifies a password against a hash in PHC or legacy format
+func VerifyPassword(password, encoded string) (bool, error) {
+	params, salt, hash, err := decodePasswordHash(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	// Hash the password with the same salt and parameters
+	computedHash := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(hash))) //nolint:gosec // decoded hashes are short
+
+	return subtle.ConstantTimeCompare(computedHash, hash) == 1, nil
+}
+
+// NeedsRehash reports whether a stored hash uses a legacy format or parameters
+// other than params, so it should be replaced after the next successful login
+func NeedsRehash(encoded string, params Argon2Params) bool {
+	stored, salt, hash, err := decodePasswordHash(encoded)
+	if err != nil || !strings.HasPrefix(encoded, "$") {
+		return true
+	}
+	return stored != params || len(salt) != saltLength || len(hash) != argon2KeyLen
+}
+
+// decodePasswordHash parses a PHC argon2id string or a legacy salt:hash value
+func decodePasswordHash(encoded string) (params Argon2Params, salt, hash []byte, err error) {
+	var encodedSalt, encodedHash string
+
+	if strings.HasPrefix(encoded, "$") {
+		// $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 6 || parts[1] != "argon2id" {
+			return params, nil, nil, ErrInvalidHash
+		}
+
+		var version int
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrInvalidHash)
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+			return params, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+		if params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+			return params, nil, nil, fmt.Errorf("%w: invalid parameters", ErrInvalidHash)
+		}
+		encodedSalt, encodedHash = parts[4], parts[5]
+	} else {
+		var ok bool
+		encodedSalt, encodedHash, ok = strings.Cut(encoded, ":")
+		if !ok {
+			return params, nil, nil, ErrInvalidHash
+		}
+		params = legacyArgon2Params
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("failed to decode salt: %w", err)
+	}
+	hash, err = base64.RawStdEncoding.DecodeString(encodedHash)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("failed to decode hash: %w", err)
+	}
+	if len(hash) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, hash, nil
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // the breached password list is keyed by SHA-1
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// breachedPrefixLength is the length of the SHA-1 hex prefix that names a
+	// breached password range file
+	breachedPrefixLength = 5
+	// minPersonalInfoLength is the shortest email or name part a password is
+	// checked against, so short names do not reject unrelated passwords
+	minPersonalInfoLength = 3
+)
+
+//go:embed common_passwords.txt
+var commonPasswords []byte
+
+// PasswordRule identifies a password policy rule
+type PasswordRule string
+
+const (
+	// PasswordRuleMinLength requires a minimum number of characters
+	PasswordRuleMinLength PasswordRule = "min_length"
+	// PasswordRuleCommon rejects passwords on the blocklist
+	PasswordRuleCommon PasswordRule = "common_password"
+	// PasswordRulePersonalInfo rejects passwords containing the email address
+	// or the name of the user
+	PasswordRulePersonalInfo PasswordRule = "personal_info"
+	// PasswordRuleBreached rejects passwords found in known data breaches
+	PasswordRuleBreached PasswordRule = "breached_password"
+)
+
+// PasswordPolicy checks new passwords
+type PasswordPolicy struct {
+	minLength   int
+	blocklist   map[string]struct{}
+	breachedDir string
+}
+
+// NewPasswordPolicy creates a password policy. The built-in list of common
+// passwords is extended with blocklistFile, one password per line, if set.
+// breachedDir, if set, holds breached password hashes split by SHA-1 prefix
+// as files named PREFIX.txt (five upper case hex characters) with one
+// SUFFIX:COUNT line per hash, the format of the Pwned Passwords range API.
+// Only the file for the password's prefix is read.
+func NewPasswordPolicy(minLength int, blocklistFile, breachedDir string) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{
+		minLength:   minLength,
+		blocklist:   make(map[string]struct{}),
+		breachedDir: breachedDir,
+	}
+
+	p.addToBlocklist(commonPasswords)
+	if blocklistFile != "" {
+		data, err := os.ReadFile(blocklistFile) //nolint:gosec // path comes from operator configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+		}
+		p.addToBlocklist(data)
+	}
+
+	if breachedDir != "" {
+		if info, err := os.Stat(breachedDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("breached password directory %s is not readable", breachedDir)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *PasswordPolicy) addToBlocklist(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocklist[strings.ToLower(line)] = struct{}{}
+	}
+}
+
+// Check returns the rules password fails. personalInfo lists the user's email
+// address and name. An error means the breached password list could not be
+// read; the other rules are still checked.
+func (p *PasswordPolicy) Check(password string, personalInfo ...string) ([]PasswordRule, error) {
+	var failed []PasswordRule
+
+	if utf8.RuneCountInString(password) < p.minLength {
+		failed = append(failed, PasswordRuleMinLength)
+	}
+
+	lower := strings.ToLower(password)
+	if _, blocked := p.blocklist[lower]; blocked {
+		failed = append(failed, PasswordRuleCommon)
+	}
+
+	if containsPersonalInfo(lower, personalInfo) {
+		failed = append(failed, PasswordRulePersonalInfo)
+	}
+
+	breached, err := p.isBreached(password)
+	if breached {
+		failed = append(failed, PasswordRuleBreached)
+	}
+
+	return failed, err
+}
+
+// containsPersonalInfo reports whether password contains the local part of an
+// email address, a whole name or any longer part of a name
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if local, _, ok := strings.Cut(info, "@"); ok {
+			info = local
+		}
+
+		parts := strings.FieldsFunc(info, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		parts = append(parts, strings.Join(parts, ""))
+		for _, candidate := range parts {
+			if utf8.RuneCountInString(candidate) >= minPersonalInfoLength && strings.Contains(password, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isBreached looks the password up in the range file for its SHA-1 prefix
+func (p *PasswordPolicy) isBreached(password string) (bool, error) {
+	if p.breachedDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password)) //nolint:gosec // lookup key, not used for security
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	file, err := os.Open(filepath.Join(p.breachedDir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open breached password range: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(entry), suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password range: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/sha1" //nolint:gosec // matches the breached password list format
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeBreachedRange stores password in a range file the way the Pwned
+// Passwords downloader does
+func writeBreachedRange(t *testing.T, dir, password string) {
+	t.Helper()
+
+	sum := sha1.Sum([]byte(password)) //nolint:gosec // test fixture
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	content := "0000000000000000000000000000000000A:3\n" + hash[5:] + ":42\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	dir := t.TempDir()
+	writeBreachedRange(t, dir, "correct horse battery staple")
+
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(blocklist, []byte("# local additions\nSpringfield Elementary\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := NewPasswordPolicy(10, blocklist, dir)
+	if err != nil {
+		t.Fatalf("NewPasswordPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []PasswordRule
+	}{
+		{"strong password", "plum-orbit-Kettle-42", nil},
+		{"too short", "x7#kQ2", []PasswordRule{PasswordRuleMinLength}},
+		{"common and short", "1234", []PasswordRule{PasswordRuleMinLength, PasswordRuleCommon}},
+		{"common regardless of case", "Password1234", []PasswordRule{PasswordRuleCommon}},
+		{"blocklist file", "springfield elementary", []PasswordRule{PasswordRuleCommon}},
+		{"contains email local part", "ms.frizzle-2026!", []PasswordRule{PasswordRulePersonalInfo}},
+		{"contains name", "Valerie-rocks-2026", []PasswordRule{PasswordRulePersonalInfo}},
+		{"contains joined name", "valeriefrizzle!!", []PasswordRule{PasswordRulePersonalInfo}},
+		{"breached", "correct horse battery staple", []PasswordRule{PasswordRuleBreached}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Check(tt.password, "ms.frizzle@school.example", "Valerie Frizzle")
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_ShortNamesIgnored(t *testing.T) {
+	policy, err := NewPasswordPolicy(10, "", "")
+	if err != nil {
+		t.Fatalf("NewPasswordPolicy() error = %v", err)
+	}
+
+	// A two letter name should not reject every password containing it
+	got, err := policy.Check("jo-plum-orbit-kettle", "x@example.com", "Jo Li")
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Check() = %v, want no failed rules", got)
+	}
+}
+
+func TestNewPasswordPolicy_Invalid(t *testing.T) {
+	if _, err := NewPasswordPolicy(10, filepath.Join(t.TempDir(), "missing.txt"), ""); err == nil {
+		t.Error("NewPasswordPolicy() should fail for a missing blocklist file")
+	}
+	if _, err := NewPasswordPolicy(10, "", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewPasswordPolicy() should fail for a missing breached password directory")
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key from RFC 6238 appendix B
+const rfc6238Secret = "12345678901234567890"
+
+func TestHOTP_RFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		step := TOTPStep(time.Unix(tt.unix, 0))
+		if got := hotp([]byte(rfc6238Secret), uint64(step), 8); got != tt.want {
+			t.Errorf("hotp(t=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTOTPCode(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte(rfc6238Secret))
+
+	code, err := GenerateTOTPCode(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("GenerateTOTPCode() error = %v", err)
+	}
+	// Six digit codes are the last six digits of the RFC vector
+	if code != "287082" {
+		t.Errorf("GenerateTOTPCode() = %s, want 287082", code)
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := GenerateTOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("GenerateTOTPCode() error = %v", err)
+	}
+
+	step, ok := ValidateTOTPCode(secret, code, now)
+	if !ok || step != TOTPStep(now) {
+		t.Errorf("ValidateTOTPCode() = %d, %v, want %d, true", step, ok, TOTPStep(now))
+	}
+
+	// One period of clock drift is tolerated
+	if _, ok := ValidateTOTPCode(secret, code, now.Add(totpPeriod)); !ok {
+		t.Error("ValidateTOTPCode() should accept a code from the previous period")
+	}
+
+	if _, ok := ValidateTOTPCode(secret, code, now.Add(3*totpPeriod)); ok {
+		t.Error("ValidateTOTPCode() should reject a code from three periods ago")
+	}
+
+	if _, ok := ValidateTOTPCode(secret, "12345", now); ok {
+		t.Error("ValidateTOTPCode() should reject a code with the wrong length")
+	}
+
+	if _, ok := ValidateTOTPCode("not base32!", code, now); ok {
+		t.Error("ValidateTOTPCode() should reject an invalid secret")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("TinySchoolHub", "teacher@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/TinySchoolHub:teacher@example.com?") {
+		t.Errorf("TOTPURI() = %s, unexpected label", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=TinySchoolHub", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("TOTPURI() = %s, missing %s", uri, param)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 17 || code[8] != '-' {
+			t.Errorf("recovery code %q has unexpected format", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("abcdefgh-ijklmnop")
+
+	for _, input := range []string{"ABCDEFGH-IJKLMNOP", "abcdefghijklmnop", "abcdefgh ijklmnop"} {
+		if got := HashRecoveryCode(input); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from the canonical form", input)
+		}
+	}
+
+	if HashRecoveryCode("abcdefgh-ijklmnoq") == want {
+		t.Error("HashRecoveryCode() should differ for different codes")
+	}
+}
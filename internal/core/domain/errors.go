@@ -15,4 +15,5 @@ var (
 	ErrNotAMember         = errors.New("not a member of this class")
 	ErrInvalidFileType    = errors.New("invalid file type")
 	ErrFileTooLarge       = errors.New("file too large")
+	ErrLockedOut          = errors.New("locked out")
 )
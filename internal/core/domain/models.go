@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"net/netip"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,15 +31,22 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"` // Never serialize password
 	Role         Role      `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// VerifiedAt is when the user proved they own their email address
+	VerifiedAt *time.Time `json:"verified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// IsVerified reports whether the user has verified their email address
+func (u *User) IsVerified() bool {
+	return u.VerifiedAt != nil
 }
 
 // Profile represents user profile information
 type Profile struct {
 	UserID      uuid.UUID  `json:"user_id"`
 	DisplayName string     `json:"display_name"`
-	AvatarURL   *string    `json:"avatar_url,omitempty"`
+	AvatarURL   *string    `json:"avatar_url,omitempty"` // Storage key of the uploaded avatar
 	ChildName   *string    `json:"child_name,omitempty"`
 	ClassID     *uuid.UUID `json:"class_id,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
@@ -81,15 +89,135 @@ type ClassMember struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// ClassInvite is a revocable, expiring code that parents redeem to ask to join a class
+type ClassInvite struct {
+	ID        uuid.UUID  `json:"id"`
+	ClassID   uuid.UUID  `json:"class_id"`
+	Code      string     `json:"code"`
+	CreatedBy uuid.UUID  `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IsValid checks if the invite can still be redeemed
+func (ci *ClassInvite) IsValid() bool {
+	return ci.RevokedAt == nil && time.Now().Before(ci.ExpiresAt)
+}
+
+// JoinRequestStatus represents the state of a class join request
+type JoinRequestStatus string
+
+const (
+	JoinRequestStatusPending  JoinRequestStatus = "PENDING"
+	JoinRequestStatusApproved JoinRequestStatus = "APPROVED"
+	JoinRequestStatusRejected JoinRequestStatus = "REJECTED"
+)
+
+// IsValid checks if the join request status is valid
+func (s JoinRequestStatus) IsValid() bool {
+	switch s {
+	case JoinRequestStatusPending, JoinRequestStatusApproved, JoinRequestStatusRejected:
+		return true
+	}
+	return false
+}
+
+// ClassJoinRequest is a parent's request to join a class, decided by a teacher
+type ClassJoinRequest struct {
+	ID        uuid.UUID         `json:"id"`
+	ClassID   uuid.UUID         `json:"class_id"`
+	UserID    uuid.UUID         `json:"user_id"`
+	InviteID  *uuid.UUID        `json:"invite_id,omitempty"`
+	Status    JoinRequestStatus `json:"status"`
+	DecidedBy *uuid.UUID        `json:"decided_by,omitempty"`
+	DecidedAt *time.Time        `json:"decided_at,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	// Requester details, filled in when listing requests for a class
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// PhotoStatus represents the upload state of a photo
+type PhotoStatus string
+
+const (
+	// PhotoStatusPending is a photo whose upload has not been confirmed yet
+	PhotoStatusPending PhotoStatus = "PENDING"
+	// PhotoStatusProcessing is a confirmed upload whose metadata is being
+	// stripped. It is not visible to the class yet.
+	PhotoStatusProcessing PhotoStatus = "PROCESSING"
+	// PhotoStatusReady is a sanitized photo visible to class members
+	PhotoStatusReady PhotoStatus = "READY"
+)
+
 // Photo represents a photo uploaded to a class
 type Photo struct {
+	ID            uuid.UUID   `json:"id"`
+	ClassID       uuid.UUID   `json:"class_id"`
+	UploaderID    uuid.UUID   `json:"uploader_id"`
+	Caption       *string     `json:"caption,omitempty"`
+	MediaKey      string      `json:"media_key"`
+	ContentType   string      `json:"content_type"`
+	FileSizeBytes int         `json:"file_size_bytes"`
+	Status        PhotoStatus `json:"status"`
+	VariantsReady bool        `json:"variants_ready"`
+	// Sanitized is set once EXIF, XMP and GPS metadata have been removed
+	Sanitized bool      `json:"sanitized"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ProcessingAttempts counts failed processing runs
+	ProcessingAttempts int `json:"-"`
+}
+
+// PhotoVariant names a resized rendition of a photo
+type PhotoVariant string
+
+const (
+	PhotoVariantThumbnail PhotoVariant = "thumbnail"
+	PhotoVariantMedium    PhotoVariant = "medium"
+)
+
+// PhotoVariants lists every variant generated for a photo
+var PhotoVariants = []PhotoVariant{PhotoVariantThumbnail, PhotoVariantMedium}
+
+// IsReady reports whether the photo has been confirmed and sanitized
+func (p *Photo) IsReady() bool {
+	return p.Status == PhotoStatusReady
+}
+
+// VariantKey derives the storage key of a variant, stored next to the original
+func (p *Photo) VariantKey(variant PhotoVariant) string {
+	return p.MediaKey + "-" + string(variant) + ".jpg"
+}
+
+// SanitizedKey derives the storage key of the original with its metadata
+// removed. MediaKey holds the raw upload, which is never served because the
+// uploader could overwrite it while the upload URL is still valid.
+func (p *Photo) SanitizedKey() string {
+	return p.MediaKey + "-sanitized"
+}
+
+// ObjectKeys returns every storage key that belongs to the photo, including
+// objects that may not have been generated yet
+func (p *Photo) ObjectKeys() []string {
+	keys := []string{p.MediaKey, p.SanitizedKey()}
+	for _, variant := range PhotoVariants {
+		keys = append(keys, p.VariantKey(variant))
+	}
+	return keys
+}
+
+// StorageDeletion is a pending removal of a storage object. It is written in
+// the same transaction that deletes the owning row, so an object is never
+// orphaned if the storage call fails.
+type StorageDeletion struct {
 	ID            uuid.UUID `json:"id"`
-	ClassID       uuid.UUID `json:"class_id"`
-	UploaderID    uuid.UUID `json:"uploader_id"`
-	Caption       *string   `json:"caption,omitempty"`
-	MediaKey      string    `json:"media_key"`
-	ContentType   string    `json:"content_type"`
-	FileSizeBytes int       `json:"file_size_bytes"`
+	ObjectKey     string    `json:"object_key"`
+	Attempts      int       `json:"attempts"`
+	LastError     *string   `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
 	CreatedAt     time.Time `json:"created_at"`
 }
 
@@ -109,6 +237,22 @@ const (
 	AbsenceStatusAcked   AbsenceStatus = "ACKED"
 )
 
+// IsValid checks if the absence status is valid
+func (s AbsenceStatus) IsValid() bool {
+	switch s {
+	case AbsenceStatusPending, AbsenceStatusAcked:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether an absence with status s may be set to
+// next. Teachers can only acknowledge a pending absence; keeping the current
+// status is always allowed.
+func (s AbsenceStatus) CanTransitionTo(next AbsenceStatus) bool {
+	return s == next || (s == AbsenceStatusPending && next == AbsenceStatusAcked)
+}
+
 // Absence represents a student absence record
 type Absence struct {
 	ID          uuid.UUID     `json:"id"`
@@ -134,6 +278,11 @@ type Message struct {
 	CreatedAt   time.Time  `json:"created_at"`
 }
 
+// IsDirect reports whether the message is addressed to a single recipient
+func (m *Message) IsDirect() bool {
+	return m.RecipientID != nil
+}
+
 // Announcement represents a class or global announcement
 type Announcement struct {
 	ID        uuid.UUID  `json:"id"`
@@ -146,10 +295,24 @@ type Announcement struct {
 	UpdatedAt time.Time  `json:"updated_at"`
 }
 
-// RefreshToken represents a refresh token for JWT authentication
+// IsGlobal reports whether the announcement is school-wide rather than class-scoped
+func (a *Announcement) IsGlobal() bool {
+	return a.ClassID == nil
+}
+
+// IsPublished reports whether the announcement is visible to readers at the given time
+func (a *Announcement) IsPublished(now time.Time) bool {
+	return !a.PublishAt.After(now)
+}
+
+// RefreshToken represents a refresh token for JWT authentication. Every
+// rotation issues a new token in the same family, so replaying a rotated
+// token can revoke every token descended from the same login.
 type RefreshToken struct {
 	ID        uuid.UUID  `json:"id"`
 	UserID    uuid.UUID  `json:"user_id"`
+	FamilyID  uuid.UUID  `json:"family_id"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
 	TokenHash string     `json:"-"` // Never serialize token
 	ExpiresAt time.Time  `json:"expires_at"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty"`
@@ -170,3 +333,381 @@ func (rt *RefreshToken) IsExpired() bool {
 func (rt *RefreshToken) IsValid() bool {
 	return !rt.IsRevoked() && !rt.IsExpired()
 }
+
+// Session is a login on one device. Its ID is the family ID of the refresh
+// tokens rotated from that login.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsActive reports whether the session can still be used to refresh tokens
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// UserTokenPurpose identifies what a single-use user token may be used for
+type UserTokenPurpose string
+
+const (
+	UserTokenPasswordReset     UserTokenPurpose = "PASSWORD_RESET"
+	UserTokenEmailVerification UserTokenPurpose = "EMAIL_VERIFICATION"
+	UserTokenMagicLink         UserTokenPurpose = "MAGIC_LINK"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email. Only the
+// hash of the token is stored.
+type UserToken struct {
+	ID        uuid.UUID        `json:"id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Purpose   UserTokenPurpose `json:"purpose"`
+	TokenHash string           `json:"-"`
+	ExpiresAt time.Time        `json:"expires_at"`
+	UsedAt    *time.Time       `json:"used_at,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// IsValid reports whether the token is unused and has not expired
+func (t *UserToken) IsValid(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// RoleInvitation is an admin-issued, single-use token that lets the invited
+// email address register with an elevated role
+type RoleInvitation struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     string     `json:"email"`
+	Role      Role       `json:"role"`
+	TokenHash string     `json:"-"` // Never serialize token
+	CreatedBy uuid.UUID  `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *uuid.UUID `json:"used_by,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IsValid checks if the invitation can still be redeemed
+func (ri *RoleInvitation) IsValid() bool {
+	return ri.UsedAt == nil && ri.RevokedAt == nil && time.Now().Before(ri.ExpiresAt)
+}
+
+// RoleChange records a change of a user's role for auditing
+type RoleChange struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	OldRole   Role       `json:"old_role"`
+	NewRole   Role       `json:"new_role"`
+	ChangedBy *uuid.UUID `json:"changed_by,omitempty"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MaxMFAChallengeAttempts is how many codes a login challenge accepts before
+// it is discarded
+const MaxMFAChallengeAttempts = 5
+
+// MFAFactor is a user's TOTP authenticator. It stays pending, and is not
+// required at login, until the user confirms it with a first valid code.
+type MFAFactor struct {
+	UserID uuid.UUID `json:"-"`
+	Secret string    `json:"-"`
+	// LastUsedStep is the TOTP time step of the last accepted code, so a code
+	// can never be used twice
+	LastUsedStep int64      `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// IsEnabled reports whether enrollment has been confirmed
+func (f *MFAFactor) IsEnabled() bool {
+	return f.EnabledAt != nil
+}
+
+// MFARecoveryCode is a hashed single-use code that replaces a TOTP code when
+// the authenticator is lost
+type MFARecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFAChallenge is a login that passed the password check and is waiting for
+// the second factor. Only the hash of its token is stored.
+type MFAChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// IsValid reports whether the challenge can still be completed
+func (c *MFAChallenge) IsValid(now time.Time) bool {
+	return c.UsedAt == nil && now.Before(c.ExpiresAt) && c.Attempts < MaxMFAChallengeAttempts
+}
+
+// LoginFailureScope is what failed logins are counted against
+type LoginFailureScope string
+
+const (
+	// LoginFailureScopeAccount counts failures per email address, whether or
+	// not an account exists for it
+	LoginFailureScopeAccount LoginFailureScope = "ACCOUNT"
+	// LoginFailureScopeIP counts failures per client IP address
+	LoginFailureScopeIP LoginFailureScope = "IP"
+)
+
+// LoginFailure counts the recent consecutive failed logins for an account or
+// a client IP
+type LoginFailure struct {
+	Scope        LoginFailureScope `json:"scope"`
+	Key          string            `json:"key"`
+	Failures     int               `json:"failures"`
+	LastFailedAt time.Time         `json:"last_failed_at"`
+	LockedUntil  *time.Time        `json:"locked_until,omitempty"`
+}
+
+// IsLocked reports whether logins are refused at now
+func (f *LoginFailure) IsLocked(now time.Time) bool {
+	return f.LockedUntil != nil && now.Before(*f.LockedUntil)
+}
+
+// RateLimitScope identifies what requests are counted against for rate limits
+// shared by all API instances
+type RateLimitScope string
+
+const (
+	// RateLimitScopeMagicLinkEmail counts magic link requests per email address
+	RateLimitScopeMagicLinkEmail RateLimitScope = "MAGIC_LINK_EMAIL"
+	// RateLimitScopeMagicLinkIP counts magic link requests per client IP address
+	RateLimitScopeMagicLinkIP RateLimitScope = "MAGIC_LINK_IP"
+)
+
+// UserIdentity links a user to their account at an OpenID Connect provider
+type UserIdentity struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Provider string    `json:"provider"`
+	// Subject is the provider's stable identifier for the account
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginState is an OpenID Connect login waiting for the provider to send
+// the user back. Only the hash of its state parameter is stored.
+type OIDCLoginState struct {
+	ID        uuid.UUID
+	Provider  string
+	StateHash string
+	// CodeVerifier is the PKCE secret that redeems the authorization code
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+	CreatedAt    time.Time
+}
+
+// WebAuthnCredential is a passkey registered by a user. CredentialID and
+// PublicKey are stored as sent by the authenticator and never returned.
+type WebAuthnCredential struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       uuid.UUID `json:"user_id"`
+	CredentialID []byte    `json:"-"`
+	// PublicKey is the credential public key as a COSE_Key
+	PublicKey []byte `json:"-"`
+	// SignCount is the authenticator's signature counter at the last login
+	SignCount  uint32     `json:"-"`
+	AAGUID     []byte     `json:"-"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnCeremony is what a WebAuthn challenge was issued for
+type WebAuthnCeremony string
+
+const (
+	// WebAuthnCeremonyRegistration is a user adding a passkey
+	WebAuthnCeremonyRegistration WebAuthnCeremony = "REGISTRATION"
+	// WebAuthnCeremonyLogin is a login with a passkey
+	WebAuthnCeremonyLogin WebAuthnCeremony = "LOGIN"
+)
+
+// WebAuthnChallenge is a WebAuthn ceremony waiting for the authenticator
+// response. Only the hash of the challenge is stored. UserID is nil for
+// logins, where the credential identifies the user.
+type WebAuthnChallenge struct {
+	ID            uuid.UUID
+	UserID        *uuid.UUID
+	Ceremony      WebAuthnCeremony
+	ChallengeHash string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
+
+// APIKeyScope grants an API key access to a group of endpoints
+type APIKeyScope string
+
+const (
+	APIKeyScopeClassesRead   APIKeyScope = "classes:read"
+	APIKeyScopeClassesWrite  APIKeyScope = "classes:write"
+	APIKeyScopeMembersRead   APIKeyScope = "members:read"
+	APIKeyScopeMembersWrite  APIKeyScope = "members:write"
+	APIKeyScopeAbsencesRead  APIKeyScope = "absences:read"
+	APIKeyScopeAbsencesWrite APIKeyScope = "absences:write"
+)
+
+// IsValid checks if the scope is known
+func (s APIKeyScope) IsValid() bool {
+	switch s {
+	case APIKeyScopeClassesRead, APIKeyScopeClassesWrite, APIKeyScopeMembersRead,
+		APIKeyScopeMembersWrite, APIKeyScopeAbsencesRead, APIKeyScopeAbsencesWrite:
+		return true
+	}
+	return false
+}
+
+// APIKey lets an integration, such as a school information system, call the
+// API as a user without their password. Only the hash of the key is stored.
+type APIKey struct {
+	ID uuid.UUID `json:"id"`
+	// UserID is the account the key acts as
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	// Prefix is the start of the key, to recognize it in lists and logs
+	Prefix  string        `json:"prefix"`
+	KeyHash string        `json:"-"` // Never serialize key
+	Scopes  []APIKeyScope `json:"scopes"`
+	// AllowedIPs lists the addresses or CIDR ranges the key may be used
+	// from; any address is allowed when it is empty
+	AllowedIPs []string   `json:"allowed_ips,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedBy  uuid.UUID  `json:"created_by"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// IsActive reports whether the key can be used at now
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP reports whether the key may be used from ip. Entries that do not
+// parse never match.
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, allowed := range k.AllowedIPs {
+		if prefix, err := netip.ParsePrefix(allowed); err == nil && prefix.Contains(addr) {
+			return true
+		}
+		if allowedAddr, err := netip.ParseAddr(allowed); err == nil && allowedAddr.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTokenRevocation invalidates every access token of a user issued before
+// ValidAfter, e.g. after a role change. It is kept when the user is deleted so
+// their tokens stay rejected.
+type AccessTokenRevocation struct {
+	UserID     uuid.UUID `json:"user_id"`
+	ValidAfter time.Time `json:"valid_after"`
+}
+
+// Revokes reports whether a token issued at issuedAt is revoked. Access tokens
+// carry their issue time to the millisecond and never later than they were
+// signed, so every token issued before the revocation is revoked. A token
+// issued within a millisecond after it may be revoked too, which only costs a
+// fresh login.
+func (rv *AccessTokenRevocation) Revokes(issuedAt time.Time) bool {
+	return issuedAt.Before(rv.ValidAfter)
+}
+
+// SecurityEventType identifies a security relevant event on an account
+type SecurityEventType string
+
+const (
+	// SecurityEventRefreshTokenReuse is a revoked refresh token being presented
+	// again, which means the token family is likely compromised
+	SecurityEventRefreshTokenReuse SecurityEventType = "REFRESH_TOKEN_REUSE"
+	// SecurityEventPasswordReset is a password changed through a reset link
+	SecurityEventPasswordReset SecurityEventType = "PASSWORD_RESET"
+	// SecurityEventMFAEnabled is two-factor authentication being turned on
+	SecurityEventMFAEnabled SecurityEventType = "MFA_ENABLED"
+	// SecurityEventMFADisabled is two-factor authentication being turned off,
+	// by the user or reset by an admin
+	SecurityEventMFADisabled SecurityEventType = "MFA_DISABLED"
+	// SecurityEventMFARecoveryCodeUsed is a login completed with a recovery code
+	SecurityEventMFARecoveryCodeUsed SecurityEventType = "MFA_RECOVERY_CODE_USED"
+	// SecurityEventMFAChallengeFailed is a wrong second factor at login
+	SecurityEventMFAChallengeFailed SecurityEventType = "MFA_CHALLENGE_FAILED"
+	// SecurityEventAccountLocked is an account locked after repeated failed logins
+	SecurityEventAccountLocked SecurityEventType = "ACCOUNT_LOCKED"
+	// SecurityEventAccountUnlocked is a login lockout lifted by an admin
+	SecurityEventAccountUnlocked SecurityEventType = "ACCOUNT_UNLOCKED"
+	// SecurityEventIdentityLinked is an OpenID Connect account linked to an
+	// existing account with the same verified email address
+	SecurityEventIdentityLinked SecurityEventType = "IDENTITY_LINKED"
+	// SecurityEventPasskeyAdded is a passkey registered for the account
+	SecurityEventPasskeyAdded SecurityEventType = "PASSKEY_ADDED"
+	// SecurityEventPasskeyRemoved is a passkey deleted from the account
+	SecurityEventPasskeyRemoved SecurityEventType = "PASSKEY_REMOVED"
+	// SecurityEventPasskeyCloneDetected is a passkey login refused because the
+	// signature counter went backwards, which means the key may be copied
+	SecurityEventPasskeyCloneDetected SecurityEventType = "PASSKEY_CLONE_DETECTED"
+	// SecurityEventAPIKeyCreated is an admin creating an API key that acts as
+	// the account
+	SecurityEventAPIKeyCreated SecurityEventType = "API_KEY_CREATED"
+	// SecurityEventAPIKeyRevoked is an admin revoking an API key of the account
+	SecurityEventAPIKeyRevoked SecurityEventType = "API_KEY_REVOKED"
+	// SecurityEventImpersonationStarted is an admin obtaining an
+	// impersonation token to view the account as its user
+	SecurityEventImpersonationStarted SecurityEventType = "IMPERSONATION_STARTED"
+	// SecurityEventSignedOut is an admin ending every session of the account
+	// and revoking its access tokens
+	SecurityEventSignedOut SecurityEventType = "SIGNED_OUT_BY_ADMIN"
+)
+
+// SecurityEvent is an audit record of a security relevant event on an account
+type SecurityEvent struct {
+	ID        uuid.UUID         `json:"id"`
+	UserID    uuid.UUID         `json:"user_id"`
+	Type      SecurityEventType `json:"type"`
+	IPAddress string            `json:"ip_address,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -217,6 +217,42 @@ func TestPhotoValidation(t *testing.T) {
 	}
 }
 
+func TestPhotoIsReady(t *testing.T) {
+	pending := Photo{Status: PhotoStatusPending}
+	if pending.IsReady() {
+		t.Error("pending photo should not be ready")
+	}
+
+	ready := Photo{Status: PhotoStatusReady}
+	if !ready.IsReady() {
+		t.Error("confirmed photo should be ready")
+	}
+}
+
+func TestPhotoObjectKeys(t *testing.T) {
+	photo := Photo{MediaKey: "photos/class/photo"}
+
+	if got := photo.VariantKey(PhotoVariantThumbnail); got != "photos/class/photo-thumbnail.jpg" {
+		t.Errorf("VariantKey(thumbnail) = %q", got)
+	}
+
+	keys := photo.ObjectKeys()
+	want := []string{
+		"photos/class/photo",
+		"photos/class/photo-sanitized",
+		"photos/class/photo-thumbnail.jpg",
+		"photos/class/photo-medium.jpg",
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("ObjectKeys() = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("ObjectKeys()[%d] = %q, want %q", i, keys[i], want[i])
+		}
+	}
+}
+
 func TestAbsenceValidation(t *testing.T) {
 	absenceDate := time.Now()
 
@@ -277,6 +313,45 @@ func TestAbsenceValidation(t *testing.T) {
 	}
 }
 
+func TestAbsenceStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status AbsenceStatus
+		want   bool
+	}{
+		{"pending status", AbsenceStatusPending, true},
+		{"acked status", AbsenceStatusAcked, true},
+		{"unknown status", AbsenceStatus("REJECTED"), false},
+		{"empty status", AbsenceStatus(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.IsValid(); got != tt.want {
+				t.Errorf("AbsenceStatus.IsValid() = %v, want %v for status %s", got, tt.want, tt.status)
+			}
+		})
+	}
+}
+
+func TestAbsenceStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to AbsenceStatus
+		want     bool
+	}{
+		{AbsenceStatusPending, AbsenceStatusAcked, true},
+		{AbsenceStatusAcked, AbsenceStatusAcked, true},
+		{AbsenceStatusPending, AbsenceStatusPending, true},
+		{AbsenceStatusAcked, AbsenceStatusPending, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
 func TestMessageValidation(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -326,6 +401,21 @@ func TestMessageValidation(t *testing.T) {
 	}
 }
 
+func TestMessageIsDirect(t *testing.T) {
+	recipientID := uuid.New()
+	classID := uuid.New()
+
+	direct := Message{ID: uuid.New(), SenderID: uuid.New(), RecipientID: &recipientID, Body: "Hi"}
+	if !direct.IsDirect() {
+		t.Error("Message with recipient should be direct")
+	}
+
+	broadcast := Message{ID: uuid.New(), SenderID: uuid.New(), ClassID: &classID, Body: "Hello class"}
+	if broadcast.IsDirect() {
+		t.Error("Class message should not be direct")
+	}
+}
+
 func TestAnnouncementValidation(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -380,6 +470,48 @@ func TestAnnouncementValidation(t *testing.T) {
 	}
 }
 
+func TestAnnouncementPublishing(t *testing.T) {
+	now := time.Now()
+	classID := uuid.New()
+
+	tests := []struct {
+		name          string
+		announcement  Announcement
+		wantPublished bool
+		wantGlobal    bool
+	}{
+		{
+			name:          "published class announcement",
+			announcement:  Announcement{ClassID: &classID, PublishAt: now.Add(-time.Hour)},
+			wantPublished: true,
+			wantGlobal:    false,
+		},
+		{
+			name:          "published exactly now",
+			announcement:  Announcement{PublishAt: now},
+			wantPublished: true,
+			wantGlobal:    true,
+		},
+		{
+			name:          "scheduled global announcement",
+			announcement:  Announcement{PublishAt: now.Add(time.Hour)},
+			wantPublished: false,
+			wantGlobal:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.announcement.IsPublished(now); got != tt.wantPublished {
+				t.Errorf("IsPublished() = %v, want %v", got, tt.wantPublished)
+			}
+			if got := tt.announcement.IsGlobal(); got != tt.wantGlobal {
+				t.Errorf("IsGlobal() = %v, want %v", got, tt.wantGlobal)
+			}
+		})
+	}
+}
+
 func TestRefreshTokenValidation(t *testing.T) {
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
 
@@ -479,3 +611,296 @@ func TestProfileValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestRoleInvitationIsValid(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		invitation RoleInvitation
+		valid      bool
+	}{
+		{
+			name:       "pending invitation",
+			invitation: RoleInvitation{ExpiresAt: time.Now().Add(time.Hour)},
+			valid:      true,
+		},
+		{
+			name:       "expired invitation",
+			invitation: RoleInvitation{ExpiresAt: past},
+			valid:      false,
+		},
+		{
+			name:       "used invitation",
+			invitation: RoleInvitation{ExpiresAt: time.Now().Add(time.Hour), UsedAt: &past},
+			valid:      false,
+		},
+		{
+			name:       "revoked invitation",
+			invitation: RoleInvitation{ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &past},
+			valid:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.invitation.IsValid(); got != tt.valid {
+				t.Errorf("IsValid() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestClassInviteIsValid(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		invite ClassInvite
+		valid  bool
+	}{
+		{"active invite", ClassInvite{ExpiresAt: time.Now().Add(time.Hour)}, true},
+		{"expired invite", ClassInvite{ExpiresAt: past}, false},
+		{"revoked invite", ClassInvite{ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.invite.IsValid(); got != tt.valid {
+				t.Errorf("IsValid() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestJoinRequestStatus(t *testing.T) {
+	tests := []struct {
+		status JoinRequestStatus
+		valid  bool
+	}{
+		{JoinRequestStatusPending, true},
+		{JoinRequestStatusApproved, true},
+		{JoinRequestStatusRejected, true},
+		{JoinRequestStatus("CANCELLED"), false},
+		{JoinRequestStatus(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.IsValid(); got != tt.valid {
+				t.Errorf("IsValid() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestSessionIsActive(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		session Session
+		want    bool
+	}{
+		{"active", Session{ExpiresAt: now.Add(time.Hour)}, true},
+		{"expired", Session{ExpiresAt: now.Add(-time.Hour)}, false},
+		{"revoked", Session{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.session.IsActive(now); got != tt.want {
+				t.Errorf("IsActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserTokenIsValid(t *testing.T) {
+	now := time.Now()
+	usedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		token UserToken
+		want  bool
+	}{
+		{"valid", UserToken{ExpiresAt: now.Add(time.Minute)}, true},
+		{"expired", UserToken{ExpiresAt: now.Add(-time.Minute)}, false},
+		{"used", UserToken{ExpiresAt: now.Add(time.Minute), UsedAt: &usedAt}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.token.IsValid(now); got != tt.want {
+				t.Errorf("IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserIsVerified(t *testing.T) {
+	user := &User{}
+	if user.IsVerified() {
+		t.Error("IsVerified() = true for a user without verified_at")
+	}
+
+	now := time.Now()
+	user.VerifiedAt = &now
+	if !user.IsVerified() {
+		t.Error("IsVerified() = false for a verified user")
+	}
+}
+
+func TestMFAFactorIsEnabled(t *testing.T) {
+	factor := &MFAFactor{}
+	if factor.IsEnabled() {
+		t.Error("IsEnabled() = true for a pending factor")
+	}
+
+	now := time.Now()
+	factor.EnabledAt = &now
+	if !factor.IsEnabled() {
+		t.Error("IsEnabled() = false for a confirmed factor")
+	}
+}
+
+func TestMFAChallengeIsValid(t *testing.T) {
+	now := time.Now()
+	usedAt := now.Add(-time.Second)
+
+	tests := []struct {
+		name      string
+		challenge MFAChallenge
+		want      bool
+	}{
+		{"valid", MFAChallenge{ExpiresAt: now.Add(time.Minute)}, true},
+		{"expired", MFAChallenge{ExpiresAt: now.Add(-time.Minute)}, false},
+		{"used", MFAChallenge{ExpiresAt: now.Add(time.Minute), UsedAt: &usedAt}, false},
+		{"too many attempts", MFAChallenge{ExpiresAt: now.Add(time.Minute), Attempts: MaxMFAChallengeAttempts}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.challenge.IsValid(now); got != tt.want {
+				t.Errorf("IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginFailureIsLocked(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Minute)
+	past := now.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		failure LoginFailure
+		want    bool
+	}{
+		{"not locked", LoginFailure{Failures: 2}, false},
+		{"locked", LoginFailure{Failures: 5, LockedUntil: &future}, true},
+		{"lockout expired", LoginFailure{Failures: 5, LockedUntil: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.failure.IsLocked(now); got != tt.want {
+				t.Errorf("IsLocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyIsActive(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{"no expiry", APIKey{}, true},
+		{"not expired", APIKey{ExpiresAt: &future}, true},
+		{"expired", APIKey{ExpiresAt: &past}, false},
+		{"revoked", APIKey{RevokedAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.IsActive(now); got != tt.want {
+				t.Errorf("IsActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	key := &APIKey{Scopes: []APIKeyScope{APIKeyScopeClassesRead, APIKeyScopeMembersWrite}}
+
+	if !key.HasScope(APIKeyScopeClassesRead) || !key.HasScope(APIKeyScopeMembersWrite) {
+		t.Error("HasScope() = false for a granted scope")
+	}
+	if key.HasScope(APIKeyScopeAbsencesRead) {
+		t.Error("HasScope() = true for a scope that was not granted")
+	}
+	if APIKeyScope("admin:write").IsValid() || !APIKeyScopeAbsencesWrite.IsValid() {
+		t.Error("IsValid() is wrong")
+	}
+}
+
+func TestAPIKeyAllowsIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		ip      string
+		want    bool
+	}{
+		{"no allowlist", nil, "203.0.113.7", true},
+		{"listed address", []string{"203.0.113.7"}, "203.0.113.7", true},
+		{"in range", []string{"10.0.0.0/8"}, "10.1.2.3", true},
+		{"mapped IPv4", []string{"10.0.0.0/8"}, "::ffff:10.1.2.3", true},
+		{"IPv6 range", []string{"2001:db8::/32"}, "2001:db8::1", true},
+		{"not listed", []string{"10.0.0.0/8", "203.0.113.7"}, "198.51.100.1", false},
+		{"invalid address", []string{"10.0.0.0/8"}, "not-an-ip", false},
+		{"invalid entry", []string{"school"}, "10.1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &APIKey{AllowedIPs: tt.allowed}
+			if got := key.AllowsIP(tt.ip); got != tt.want {
+				t.Errorf("AllowsIP(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessTokenRevocationRevokes(t *testing.T) {
+	validAfter := time.Date(2026, 3, 1, 10, 0, 0, 500_250_000, time.UTC)
+	revocation := &AccessTokenRevocation{ValidAfter: validAfter}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued earlier", validAfter.Add(-time.Minute), true},
+		{"issued earlier in the same second", validAfter.Truncate(time.Second), true},
+		{"issued earlier in the same millisecond", validAfter.Truncate(time.Millisecond), true},
+		{"issued in the next millisecond", validAfter.Truncate(time.Millisecond).Add(time.Millisecond), false},
+		{"issued later", validAfter.Add(time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := revocation.Revokes(tt.issuedAt); got != tt.want {
+				t.Errorf("Revokes(%v) = %v, want %v", tt.issuedAt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const absenceDateLayout = "2006-01-02"
+
+// AbsenceHandler handles absence reporting endpoints
+type AbsenceHandler struct {
+	absenceRepo repository.AbsenceRepository
+	memberRepo  repository.ClassMemberRepository
+	profileRepo repository.ProfileRepository
+	cfg         *config.Config
+	logger      *log.Logger
+}
+
+// NewAbsenceHandler creates a new absence handler
+func NewAbsenceHandler(
+	absenceRepo repository.AbsenceRepository,
+	memberRepo repository.ClassMemberRepository,
+	profileRepo repository.ProfileRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *AbsenceHandler {
+	return &AbsenceHandler{
+		absenceRepo: absenceRepo,
+		memberRepo:  memberRepo,
+		profileRepo: profileRepo,
+		cfg:         cfg,
+		logger:      logger,
+	}
+}
+
+type createAbsenceRequest struct {
+	StudentName string  `json:"student_name"`
+	AbsenceDate string  `json:"absence_date"`
+	Reason      *string `json:"reason,omitempty"`
+}
+
+type updateAbsenceStatusRequest struct {
+	Status domain.AbsenceStatus `json:"status"`
+}
+
+// Create reports an absence. Teachers may log an absence for any student in
+// their class; parents may only report an absence for their own child.
+func (h *AbsenceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := h.memberRepo.IsMember(ctx, userID, classID)
+	if err != nil || !isMember {
+		writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+		return
+	}
+
+	isTeacher, err := h.memberRepo.IsTeacher(ctx, userID, classID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check class role")
+		writeError(w, "internal_error", "Failed to report absence", http.StatusInternalServerError)
+		return
+	}
+
+	var req createAbsenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	absenceDate, err := time.Parse(absenceDateLayout, req.AbsenceDate)
+	if err != nil {
+		writeError(w, "invalid_input", "absence_date must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	absence := &domain.Absence{
+		ID:          uuid.New(),
+		ClassID:     classID,
+		AbsenceDate: absenceDate,
+		ReporterID:  userID,
+		Reason:      req.Reason,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if isTeacher {
+		// Absences logged by the teacher need no further acknowledgement
+		absence.StudentName = strings.TrimSpace(req.StudentName)
+		absence.ReportedBy = domain.ReportedByTeacher
+		absence.Status = domain.AbsenceStatusAcked
+		if absence.StudentName == "" {
+			writeError(w, "invalid_input", "student_name is required", http.StatusBadRequest)
+			return
+		}
+	} else {
+		childName, ok := h.childName(w, r, userID)
+		if !ok {
+			return
+		}
+		if req.StudentName != "" && !strings.EqualFold(strings.TrimSpace(req.StudentName), childName) {
+			writeError(w, "forbidden", "Parents can only report absences for their own child", http.StatusForbidden)
+			return
+		}
+		absence.StudentName = childName
+		absence.ReportedBy = domain.ReportedByParent
+		absence.Status = domain.AbsenceStatusPending
+	}
+
+	if err := h.absenceRepo.Create(ctx, absence); err != nil {
+		h.logger.WithError(err).Error("Failed to create absence")
+		writeError(w, "internal_error", "Failed to report absence", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, absence, http.StatusCreated)
+}
+
+// childName resolves the child a parent is allowed to report absences for
+func (h *AbsenceHandler) childName(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (string, bool) {
+	profile, err := h.profileRepo.GetByUserID(r.Context(), userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).Error("Failed to get profile")
+		writeError(w, "internal_error", "Failed to report absence", http.StatusInternalServerError)
+		return "", false
+	}
+	if profile == nil || profile.ChildName == nil || strings.TrimSpace(*profile.ChildName) == "" {
+		writeError(w, "invalid_input", "Set your child's name on your profile before reporting an absence", http.StatusBadRequest)
+		return "", false
+	}
+	return strings.TrimSpace(*profile.ChildName), true
+}
+
+// List returns absences for a class. Teachers see every record, parents only
+// the ones they reported themselves.
+func (h *AbsenceHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := h.memberRepo.IsMember(ctx, userID, classID)
+	if err != nil || !isMember {
+		writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+		return
+	}
+
+	isTeacher, err := h.memberRepo.IsTeacher(ctx, userID, classID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check class role")
+		writeError(w, "internal_error", "Failed to list absences", http.StatusInternalServerError)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	var absences []*domain.Absence
+	if isTeacher {
+		absences, err = h.absenceRepo.ListByClass(ctx, classID, limit, offset)
+	} else {
+		absences, err = h.absenceRepo.ListByClassAndReporter(ctx, classID, userID, limit, offset)
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list absences")
+		writeError(w, "internal_error", "Failed to list absences", http.StatusInternalServerError)
+		return
+	}
+
+	if absences == nil {
+		absences = []*domain.Absence{}
+	}
+
+	writeJSON(w, absences, http.StatusOK)
+}
+
+// UpdateStatus lets a class teacher acknowledge a pending absence
+func (h *AbsenceHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	absenceID, err := uuid.Parse(chi.URLParam(r, "absenceId"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid absence ID", http.StatusBadRequest)
+		return
+	}
+
+	isTeacher, err := h.memberRepo.IsTeacher(ctx, userID, classID)
+	if err != nil || !isTeacher {
+		writeError(w, "forbidden", "Must be a teacher to update absences", http.StatusForbidden)
+		return
+	}
+
+	var req updateAbsenceStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !req.Status.IsValid() {
+		writeError(w, "invalid_input", "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	absence, err := h.absenceRepo.GetByID(ctx, absenceID)
+	if err != nil || absence.ClassID != classID {
+		writeError(w, "not_found", "Absence not found", http.StatusNotFound)
+		return
+	}
+
+	if !absence.Status.CanTransitionTo(req.Status) {
+		writeError(w, "invalid_transition", "Absence cannot change from "+string(absence.Status)+" to "+string(req.Status), http.StatusConflict)
+		return
+	}
+
+	if absence.Status != req.Status {
+		if err := h.absenceRepo.UpdateStatus(ctx, absenceID, req.Status); err != nil {
+			h.logger.WithError(err).Error("Failed to update absence status")
+			writeError(w, "internal_error", "Failed to update absence", http.StatusInternalServerError)
+			return
+		}
+		absence.Status = req.Status
+		absence.UpdatedAt = time.Now()
+	}
+
+	writeJSON(w, absence, http.StatusOK)
+}
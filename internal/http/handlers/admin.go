@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const (
+	maxRoleChangeReasonLength    = 500
+	maxImpersonationReasonLength = 500
+)
+
+// AdminHandler handles administrative account management endpoints
+type AdminHandler struct {
+	userRepo         repository.UserRepository
+	invitationRepo   repository.RoleInvitationRepository
+	roleChangeRepo   repository.RoleChangeRepository
+	securityRepo     repository.SecurityEventRepository
+	mfaRepo          repository.MFARepository
+	loginFailureRepo repository.LoginFailureRepository
+	sessionRepo      repository.SessionRepository
+	tokenRepo        repository.RefreshTokenRepository
+	revocations      *middleware.TokenRevocations
+	keys             *auth.KeySet
+	cfg              *config.Config
+	logger           *log.Logger
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(
+	userRepo repository.UserRepository,
+	invitationRepo repository.RoleInvitationRepository,
+	roleChangeRepo repository.RoleChangeRepository,
+	securityRepo repository.SecurityEventRepository,
+	mfaRepo repository.MFARepository,
+	loginFailureRepo repository.LoginFailureRepository,
+	sessionRepo repository.SessionRepository,
+	tokenRepo repository.RefreshTokenRepository,
+	revocations *middleware.TokenRevocations,
+	keys *auth.KeySet,
+	cfg *config.Config,
+	logger *log.Logger,
+) *AdminHandler {
+	return &AdminHandler{
+		userRepo:         userRepo,
+		invitationRepo:   invitationRepo,
+		roleChangeRepo:   roleChangeRepo,
+		securityRepo:     securityRepo,
+		mfaRepo:          mfaRepo,
+		loginFailureRepo: loginFailureRepo,
+		sessionRepo:      sessionRepo,
+		tokenRepo:        tokenRepo,
+		revocations:      revocations,
+		keys:             keys,
+		cfg:              cfg,
+		logger:           logger,
+	}
+}
+
+type createInvitationRequest struct {
+	Email string      `json:"email"`
+	Role  domain.Role `json:"role"`
+}
+
+// invitationResponse includes the plaintext token, which is only ever
+// returned once when the invitation is created
+type invitationResponse struct {
+	*domain.RoleInvitation
+	Token string `json:"token"`
+}
+
+type impersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// impersonationResponse carries an access token that acts as the user. It
+// cannot be refreshed.
+type impersonationResponse struct {
+	AccessToken string       `json:"access_token"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	User        *domain.User `json:"user"`
+}
+
+type updateRoleRequest struct {
+	Role   domain.Role `json:"role"`
+	Reason string      `json:"reason"`
+}
+
+// CreateInvitation issues a single-use invitation that lets the given email
+// register as a teacher or admin
+func (h *AdminHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req createInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		writeError(w, "invalid_input", "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role != domain.RoleTeacher && req.Role != domain.RoleAdmin {
+		writeError(w, "invalid_input", "role must be TEACHER or ADMIN", http.StatusBadRequest)
+		return
+	}
+
+	if existing, _ := h.userRepo.GetByEmail(ctx, email); existing != nil {
+		writeError(w, "already_exists", "User already exists, change their role instead", http.StatusConflict)
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate invitation token")
+		writeError(w, "internal_error", "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	invitation := &domain.RoleInvitation{
+		ID:        uuid.New(),
+		Email:     email,
+		Role:      req.Role,
+		TokenHash: auth.HashToken(token),
+		CreatedBy: adminID,
+		ExpiresAt: time.Now().Add(h.cfg.Auth.InvitationExpiry),
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.invitationRepo.Create(ctx, invitation); err != nil {
+		h.logger.WithError(err).Error("Failed to create invitation")
+		writeError(w, "internal_error", "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithFields(map[string]interface{}{
+		"admin_id":      adminID.String(),
+		"invitation_id": invitation.ID.String(),
+		"role":          string(invitation.Role),
+	}).Info("Role invitation created")
+
+	writeJSON(w, invitationResponse{
+		RoleInvitation: invitation,
+		Token:          token,
+	}, http.StatusCreated)
+}
+
+// ListInvitations lists invitations that have not been used, revoked or expired
+func (h *AdminHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	invitations, err := h.invitationRepo.ListPending(r.Context(), limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list invitations")
+		writeError(w, "internal_error", "Failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+
+	if invitations == nil {
+		invitations = []*domain.RoleInvitation{}
+	}
+
+	writeJSON(w, invitations, http.StatusOK)
+}
+
+// RevokeInvitation revokes an invitation so it can no longer be redeemed
+func (h *AdminHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	invitationID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.invitationRepo.GetByID(ctx, invitationID); err != nil {
+		writeError(w, "not_found", "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.invitationRepo.Revoke(ctx, invitationID, time.Now()); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke invitation")
+		writeError(w, "internal_error", "Failed to revoke invitation", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateUserRole changes a user's role and records who changed it and why
+func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Prevents admins from accidentally locking themselves out
+	if userID == adminID {
+		writeError(w, "forbidden", "You cannot change your own role", http.StatusForbidden)
+		return
+	}
+
+	var req updateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !req.Role.IsValid() {
+		writeError(w, "invalid_input", "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxRoleChangeReasonLength {
+		writeError(w, "invalid_input", "reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	if user.Role == req.Role {
+		writeJSON(w, user, http.StatusOK)
+		return
+	}
+
+	change := &domain.RoleChange{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		OldRole:   user.Role,
+		NewRole:   req.Role,
+		ChangedBy: &adminID,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.roleChangeRepo.Apply(ctx, change); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "conflict", "User role was changed concurrently, please retry", http.StatusConflict)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to change user role")
+		writeError(w, "internal_error", "Failed to change role", http.StatusInternalServerError)
+		return
+	}
+
+	// Apply revoked the user's access tokens along with the change
+	h.revocations.Add(user.ID, change.CreatedAt)
+
+	h.logger.WithFields(map[string]interface{}{
+		"admin_id": adminID.String(),
+		"user_id":  user.ID.String(),
+		"old_role": string(change.OldRole),
+		"new_role": string(change.NewRole),
+	}).Info("User role changed")
+
+	user.Role = change.NewRole
+	user.UpdatedAt = change.CreatedAt
+
+	writeJSON(w, user, http.StatusOK)
+}
+
+// ListRoleChanges returns the role change history of a user
+func (h *AdminHandler) ListRoleChanges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	changes, err := h.roleChangeRepo.ListByUser(ctx, userID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list role changes")
+		writeError(w, "internal_error", "Failed to list role changes", http.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []*domain.RoleChange{}
+	}
+
+	writeJSON(w, changes, http.StatusOK)
+}
+
+// ListSecurityEvents returns the security events recorded for a user, newest first
+func (h *AdminHandler) ListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	events, err := h.securityRepo.ListByUser(ctx, userID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list security events")
+		writeError(w, "internal_error", "Failed to list security events", http.StatusInternalServerError)
+		return
+	}
+
+	if events == nil {
+		events = []*domain.SecurityEvent{}
+	}
+
+	writeJSON(w, events, http.StatusOK)
+}
+
+// ResetUserMFA removes the two-factor authentication of a user who lost both
+// their authenticator and recovery codes. If their role requires it, they
+// enroll again at their next login.
+func (h *AdminHandler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.mfaRepo.GetFactor(ctx, userID); err != nil {
+		writeError(w, "not_found", "Two-factor authentication is not set up for this user", http.StatusNotFound)
+		return
+	}
+
+	if err := h.mfaRepo.DeleteFactor(ctx, userID); err != nil {
+		h.logger.WithError(err).Error("Failed to reset MFA")
+		writeError(w, "internal_error", "Failed to reset two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, userID, domain.SecurityEventMFADisabled, map[string]string{
+		"admin_id": adminID.String(),
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser lifts a login lockout of a user's account and resets its failed
+// login count. Lockouts of client IPs are not affected.
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	accountKey := loginAccountKey(user.Email)
+	if _, err := h.loginFailureRepo.Get(ctx, domain.LoginFailureScopeAccount, accountKey); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "not_found", "No failed logins are recorded for this user", http.StatusNotFound)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get login failures")
+		writeError(w, "internal_error", "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.loginFailureRepo.Clear(ctx, domain.LoginFailureScopeAccount, accountKey); err != nil {
+		h.logger.WithError(err).Error("Failed to clear login failures")
+		writeError(w, "internal_error", "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, userID, domain.SecurityEventAccountUnlocked, map[string]string{
+		"admin_id":   adminID.String(),
+		"request_id": requestID(r),
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Impersonate issues a short-lived access token that lets an admin view the
+// app as another user, e.g. to reproduce a support report. The token names the
+// admin in its act claim; requests made with it are read-only and logged.
+func (h *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if userID == adminID {
+		writeError(w, "invalid_input", "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	var req impersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		writeError(w, "invalid_input", "reason is required", http.StatusBadRequest)
+		return
+	}
+	if len(reason) > maxImpersonationReasonLength {
+		writeError(w, "invalid_input", "reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Impersonating another admin would hand out their admin rights
+	if user.Role == domain.RoleAdmin {
+		writeError(w, "forbidden", "Admins cannot be impersonated", http.StatusForbidden)
+		return
+	}
+
+	adminEmail, _ := ctx.Value(middleware.UserEmailKey).(string)
+	expiresAt := time.Now().Add(h.cfg.Auth.ImpersonationExpiry)
+
+	accessToken, err := auth.SignAccessToken(&auth.Claims{
+		UserID:     user.ID.String(),
+		Email:      user.Email,
+		Role:       string(user.Role),
+		Unverified: !user.IsVerified(),
+		Actor:      &auth.Actor{UserID: adminID.String(), Email: adminEmail},
+	}, h.keys, h.cfg.Auth.ImpersonationExpiry)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate impersonation token")
+		writeError(w, "internal_error", "Failed to impersonate user", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventImpersonationStarted, map[string]string{
+		"admin_id":   adminID.String(),
+		"reason":     reason,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		"request_id": requestID(r),
+	}))
+
+	writeJSON(w, impersonationResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt,
+		User:        user,
+	}, http.StatusOK)
+}
+
+// SignOutUser ends every session of a user and revokes their access tokens at
+// once, e.g. when an account is compromised or a teacher leaves the school
+func (h *AdminHandler) SignOutUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.userRepo.GetByID(ctx, userID); err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	if err := h.tokenRepo.RevokeAllForUser(ctx, userID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke refresh tokens")
+		writeError(w, "internal_error", "Failed to sign out user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.sessionRepo.RevokeAllForUser(ctx, userID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke sessions")
+		writeError(w, "internal_error", "Failed to sign out user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.revocations.Revoke(ctx, userID); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke access tokens")
+		writeError(w, "internal_error", "Failed to sign out user", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, userID, domain.SecurityEventSignedOut, map[string]string{
+		"admin_id":   adminID.String(),
+		"request_id": requestID(r),
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
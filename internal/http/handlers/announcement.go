@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const maxAnnouncementTitleLength = 255
+
+// AnnouncementHandler handles class and school-wide announcement endpoints
+type AnnouncementHandler struct {
+	announcementRepo repository.AnnouncementRepository
+	memberRepo       repository.ClassMemberRepository
+	cfg              *config.Config
+	logger           *log.Logger
+}
+
+// NewAnnouncementHandler creates a new announcement handler
+func NewAnnouncementHandler(
+	announcementRepo repository.AnnouncementRepository,
+	memberRepo repository.ClassMemberRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *AnnouncementHandler {
+	return &AnnouncementHandler{
+		announcementRepo: announcementRepo,
+		memberRepo:       memberRepo,
+		cfg:              cfg,
+		logger:           logger,
+	}
+}
+
+type announcementRequest struct {
+	Title     *string    `json:"title"`
+	Body      *string    `json:"body"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+// validate checks the fields that are present. On create every field except
+// publish_at is required; on update any subset may be sent.
+func (req *announcementRequest) validate(create bool) string {
+	if create && (req.Title == nil || req.Body == nil) {
+		return "Title and body are required"
+	}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			return "Title must not be empty"
+		}
+		if utf8.RuneCountInString(title) > maxAnnouncementTitleLength {
+			return "Title is too long"
+		}
+	}
+	if req.Body != nil && strings.TrimSpace(*req.Body) == "" {
+		return "Body must not be empty"
+	}
+	return ""
+}
+
+// CreateForClass creates an announcement for a class (class teachers only)
+func (h *AnnouncementHandler) CreateForClass(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	isTeacher, err := h.memberRepo.IsTeacher(ctx, userID, classID)
+	if err != nil || !isTeacher {
+		writeError(w, "forbidden", "Must be a teacher to post announcements", http.StatusForbidden)
+		return
+	}
+
+	h.create(w, r, userID, &classID)
+}
+
+// CreateGlobal creates a school-wide announcement (admins only, enforced by the router)
+func (h *AnnouncementHandler) CreateGlobal(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.create(w, r, userID, nil)
+}
+
+func (h *AnnouncementHandler) create(w http.ResponseWriter, r *http.Request, authorID uuid.UUID, classID *uuid.UUID) {
+	var req announcementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if msg := req.validate(true); msg != "" {
+		writeError(w, "invalid_input", msg, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	publishAt := now
+	if req.PublishAt != nil && req.PublishAt.After(now) {
+		publishAt = *req.PublishAt
+	}
+
+	announcement := &domain.Announcement{
+		ID:        uuid.New(),
+		ClassID:   classID,
+		AuthorID:  authorID,
+		Title:     strings.TrimSpace(*req.Title),
+		Body:      strings.TrimSpace(*req.Body),
+		PublishAt: publishAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := h.announcementRepo.Create(r.Context(), announcement); err != nil {
+		h.logger.WithError(err).Error("Failed to create announcement")
+		writeError(w, "internal_error", "Failed to create announcement", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, announcement, http.StatusCreated)
+}
+
+// ListByClass lists published announcements for a class
+func (h *AnnouncementHandler) ListByClass(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := h.memberRepo.IsMember(ctx, userID, classID)
+	if err != nil || !isMember {
+		writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	announcements, err := h.announcementRepo.ListByClass(ctx, &classID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list announcements")
+		writeError(w, "internal_error", "Failed to list announcements", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, filterPublished(announcements), http.StatusOK)
+}
+
+// ListGlobal lists published school-wide announcements
+func (h *AnnouncementHandler) ListGlobal(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	announcements, err := h.announcementRepo.ListGlobal(r.Context(), limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list announcements")
+		writeError(w, "internal_error", "Failed to list announcements", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, filterPublished(announcements), http.StatusOK)
+}
+
+// filterPublished filters out anything scheduled in the future. The repository
+// already filters on publish_at, this guards against clock skew between the
+// database and the API so readers never see a draft early.
+func filterPublished(announcements []*domain.Announcement) []*domain.Announcement {
+	now := time.Now()
+	result := make([]*domain.Announcement, 0, len(announcements))
+	for _, announcement := range announcements {
+		if announcement.IsPublished(now) {
+			result = append(result, announcement)
+		}
+	}
+	return result
+}
+
+// ListScheduled lists the current user's announcements that are not yet live
+func (h *AnnouncementHandler) ListScheduled(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	announcements, err := h.announcementRepo.ListScheduledByAuthor(ctx, userID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list scheduled announcements")
+		writeError(w, "internal_error", "Failed to list announcements", http.StatusInternalServerError)
+		return
+	}
+
+	if announcements == nil {
+		announcements = []*domain.Announcement{}
+	}
+
+	writeJSON(w, announcements, http.StatusOK)
+}
+
+// GetByID returns a single announcement. Scheduled announcements are only
+// visible to the users allowed to manage them.
+func (h *AnnouncementHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	announcement, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if !announcement.IsPublished(time.Now()) {
+		if !h.canManage(r, userID, announcement) {
+			writeError(w, "not_found", "Announcement not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, announcement, http.StatusOK)
+		return
+	}
+
+	if !announcement.IsGlobal() {
+		isMember, err := h.memberRepo.IsMember(ctx, userID, *announcement.ClassID)
+		if err != nil || !isMember {
+			writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+			return
+		}
+	}
+
+	writeJSON(w, announcement, http.StatusOK)
+}
+
+// Update edits a scheduled announcement before it goes live
+func (h *AnnouncementHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	announcement, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.canManage(r, userID, announcement) {
+		writeError(w, "forbidden", "Only the author can edit this announcement", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	if announcement.IsPublished(now) {
+		writeError(w, "already_published", "Announcement is already published", http.StatusConflict)
+		return
+	}
+
+	var req announcementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if msg := req.validate(false); msg != "" {
+		writeError(w, "invalid_input", msg, http.StatusBadRequest)
+		return
+	}
+
+	if req.Title != nil {
+		announcement.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Body != nil {
+		announcement.Body = strings.TrimSpace(*req.Body)
+	}
+	if req.PublishAt != nil {
+		// Moving publish_at into the past publishes immediately
+		announcement.PublishAt = *req.PublishAt
+		if announcement.PublishAt.Before(now) {
+			announcement.PublishAt = now
+		}
+	}
+	announcement.UpdatedAt = now
+
+	if err := h.announcementRepo.Update(ctx, announcement); err != nil {
+		h.logger.WithError(err).Error("Failed to update announcement")
+		writeError(w, "internal_error", "Failed to update announcement", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, announcement, http.StatusOK)
+}
+
+// Delete cancels a scheduled announcement or takes down a published one
+func (h *AnnouncementHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	announcement, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.canManage(r, userID, announcement) {
+		writeError(w, "forbidden", "Only the author can delete this announcement", http.StatusForbidden)
+		return
+	}
+
+	if err := h.announcementRepo.Delete(ctx, announcement.ID); err != nil {
+		h.logger.WithError(err).Error("Failed to delete announcement")
+		writeError(w, "internal_error", "Failed to delete announcement", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AnnouncementHandler) load(w http.ResponseWriter, r *http.Request) (*domain.Announcement, bool) {
+	announcementID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid announcement ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	announcement, err := h.announcementRepo.GetByID(r.Context(), announcementID)
+	if err != nil {
+		writeError(w, "not_found", "Announcement not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return announcement, true
+}
+
+// canManage reports whether the user may edit or delete the announcement:
+// its author, or an admin for school-wide announcements.
+func (h *AnnouncementHandler) canManage(r *http.Request, userID uuid.UUID, announcement *domain.Announcement) bool {
+	if announcement.AuthorID == userID {
+		return true
+	}
+	role, _ := middleware.GetUserRole(r.Context())
+	return announcement.IsGlobal() && role == string(domain.RoleAdmin)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const maxAPIKeyNameLength = 100
+
+// APIKeyHandler handles the admin endpoints that manage API keys of school
+// information system integrations
+type APIKeyHandler struct {
+	apiKeyRepo   repository.APIKeyRepository
+	userRepo     repository.UserRepository
+	securityRepo repository.SecurityEventRepository
+	logger       *log.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(
+	apiKeyRepo repository.APIKeyRepository,
+	userRepo repository.UserRepository,
+	securityRepo repository.SecurityEventRepository,
+	logger *log.Logger,
+) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyRepo:   apiKeyRepo,
+		userRepo:     userRepo,
+		securityRepo: securityRepo,
+		logger:       logger,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name       string               `json:"name"`
+	UserID     uuid.UUID            `json:"user_id"`
+	Scopes     []domain.APIKeyScope `json:"scopes"`
+	ExpiresAt  *time.Time           `json:"expires_at"`
+	AllowedIPs []string             `json:"allowed_ips"`
+}
+
+// apiKeyResponse includes the plaintext key, which is only ever returned once
+// when the key is created
+type apiKeyResponse struct {
+	*domain.APIKey
+	Key string `json:"key"`
+}
+
+// Create issues an API key that acts as the given user, limited to the
+// requested scopes
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		writeError(w, "invalid_input", "name must be between 1 and 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		writeError(w, "invalid_input", "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			writeError(w, "invalid_input", "Invalid scope: "+string(scope), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		writeError(w, "invalid_input", "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	for _, allowed := range req.AllowedIPs {
+		if _, err := netip.ParsePrefix(allowed); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(allowed); err != nil {
+			writeError(w, "invalid_input", "Invalid IP address or CIDR range: "+allowed, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := h.userRepo.GetByID(ctx, req.UserID); err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate API key")
+		writeError(w, "internal_error", "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	apiKey := &domain.APIKey{
+		ID:         uuid.New(),
+		UserID:     req.UserID,
+		Name:       name,
+		Prefix:     prefix,
+		KeyHash:    auth.HashToken(key),
+		Scopes:     req.Scopes,
+		AllowedIPs: req.AllowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  adminID,
+		CreatedAt:  now,
+	}
+
+	if err := h.apiKeyRepo.Create(ctx, apiKey); err != nil {
+		h.logger.WithError(err).Error("Failed to create API key")
+		writeError(w, "internal_error", "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, apiKey.UserID, domain.SecurityEventAPIKeyCreated, map[string]string{
+		"admin_id":   adminID.String(),
+		"api_key_id": apiKey.ID.String(),
+		"prefix":     apiKey.Prefix,
+	}))
+
+	writeJSON(w, apiKeyResponse{
+		APIKey: apiKey,
+		Key:    key,
+	}, http.StatusCreated)
+}
+
+// List lists API keys that have not been revoked
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	keys, err := h.apiKeyRepo.List(r.Context(), limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list API keys")
+		writeError(w, "internal_error", "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	if keys == nil {
+		keys = []*domain.APIKey{}
+	}
+
+	writeJSON(w, keys, http.StatusOK)
+}
+
+// Revoke revokes an API key so it can no longer be used
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	apiKey, err := h.apiKeyRepo.GetByID(ctx, keyID)
+	if err != nil {
+		writeError(w, "not_found", "API key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.apiKeyRepo.Revoke(ctx, keyID, time.Now()); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "not_found", "API key not found", http.StatusNotFound)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke API key")
+		writeError(w, "internal_error", "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, apiKey.UserID, domain.SecurityEventAPIKeyRevoked, map[string]string{
+		"admin_id":   adminID.String(),
+		"api_key_id": apiKey.ID.String(),
+		"prefix":     apiKey.Prefix,
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,7 +3,10 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,17 +15,29 @@ import (
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/mail"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
 )
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
-	userRepo    repository.UserRepository
-	profileRepo repository.ProfileRepository
-	tokenRepo   repository.RefreshTokenRepository
-	cfg         *config.Config
-	logger      *log.Logger
+	userRepo         repository.UserRepository
+	profileRepo      repository.ProfileRepository
+	tokenRepo        repository.RefreshTokenRepository
+	sessionRepo      repository.SessionRepository
+	invitationRepo   repository.RoleInvitationRepository
+	roleChangeRepo   repository.RoleChangeRepository
+	securityRepo     repository.SecurityEventRepository
+	userTokenRepo    repository.UserTokenRepository
+	mfaRepo          repository.MFARepository
+	challengeRepo    repository.MFAChallengeRepository
+	loginFailureRepo repository.LoginFailureRepository
+	mailer           mail.Mailer
+	keys             *auth.KeySet
+	passwordPolicy   *auth.PasswordPolicy
+	cfg              *config.Config
+	logger           *log.Logger
 }
 
 // NewAuthHandler creates a new auth handler
@@ -30,23 +45,47 @@ func NewAuthHandler(
 	userRepo repository.UserRepository,
 	profileRepo repository.ProfileRepository,
 	tokenRepo repository.RefreshTokenRepository,
+	sessionRepo repository.SessionRepository,
+	invitationRepo repository.RoleInvitationRepository,
+	roleChangeRepo repository.RoleChangeRepository,
+	securityRepo repository.SecurityEventRepository,
+	userTokenRepo repository.UserTokenRepository,
+	mfaRepo repository.MFARepository,
+	challengeRepo repository.MFAChallengeRepository,
+	loginFailureRepo repository.LoginFailureRepository,
+	mailer mail.Mailer,
+	keys *auth.KeySet,
+	passwordPolicy *auth.PasswordPolicy,
 	cfg *config.Config,
 	logger *log.Logger,
 ) *AuthHandler {
 	return &AuthHandler{
-		userRepo:    userRepo,
-		profileRepo: profileRepo,
-		tokenRepo:   tokenRepo,
-		cfg:         cfg,
-		logger:      logger,
+		userRepo:         userRepo,
+		profileRepo:      profileRepo,
+		tokenRepo:        tokenRepo,
+		sessionRepo:      sessionRepo,
+		invitationRepo:   invitationRepo,
+		roleChangeRepo:   roleChangeRepo,
+		securityRepo:     securityRepo,
+		userTokenRepo:    userTokenRepo,
+		mfaRepo:          mfaRepo,
+		challengeRepo:    challengeRepo,
+		loginFailureRepo: loginFailureRepo,
+		mailer:           mailer,
+		keys:             keys,
+		passwordPolicy:   passwordPolicy,
+		cfg:              cfg,
+		logger:           logger,
 	}
 }
 
+// registerRequest deliberately has no role field: public registration always
+// creates a PARENT account unless an admin-issued invitation token is supplied.
 type registerRequest struct {
-	Email       string `json:"email"`
-	Password    string `json:"password"`
-	DisplayName string `json:"display_name"`
-	Role        string `json:"role"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	DisplayName     string `json:"display_name"`
+	InvitationToken string `json:"invitation_token,omitempty"`
 }
 
 type loginRequest struct {
@@ -80,10 +119,18 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default to PARENT role if not specified or invalid
-	role := domain.Role(req.Role)
-	if !role.IsValid() {
-		role = domain.RoleParent
+	if !checkPasswordPolicy(w, h.passwordPolicy, h.logger, req.Password, req.Email, req.DisplayName) {
+		return
+	}
+
+	var invitation *domain.RoleInvitation
+	if req.InvitationToken != "" {
+		inv, err := h.invitationRepo.GetByTokenHash(ctx, auth.HashToken(req.InvitationToken))
+		if err != nil || !inv.IsValid() || !strings.EqualFold(inv.Email, req.Email) {
+			writeError(w, "invalid_invitation", "Invalid or expired invitation", http.StatusBadRequest)
+			return
+		}
+		invitation = inv
 	}
 
 	// Check if user already exists
@@ -94,19 +141,20 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Hash password
-	passwordHash, err := auth.HashPassword(req.Password)
+	passwordHash, err := auth.HashPassword(req.Password, passwordParams(h.cfg))
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to hash password")
 		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
 		return
 	}
 
-	// Create user
+	// Create user. Every account starts as a parent; an invitation elevates it
+	// only after the invitation has been redeemed.
 	user := &domain.User{
 		ID:           uuid.New(),
 		Email:        req.Email,
 		PasswordHash: passwordHash,
-		Role:         role,
+		Role:         domain.RoleParent,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
@@ -117,6 +165,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if invitation != nil {
+		h.redeemInvitation(ctx, user, invitation)
+	}
+
 	// Create profile
 	profile := &domain.Profile{
 		UserID:      user.ID,
@@ -130,41 +182,48 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		// Don't fail registration if profile creation fails
 	}
 
-	// Generate tokens
-	accessToken, err := auth.GenerateAccessToken(user.ID.String(), user.Email, string(user.Role), h.cfg.JWT.Secret, h.cfg.JWT.AccessExpiry)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate access token")
-		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+	// New accounts can only use /v1/me until they verify their email address
+	sendInBackground(r, func(ctx context.Context) {
+		if err := sendVerificationEmail(ctx, h.userTokenRepo, h.mailer, h.cfg, user); err != nil {
+			h.logger.WithError(err).WithField("user_id", user.ID.String()).Error("Failed to send verification email")
+		}
+	})
+
+	// Invited roles may have to enroll in two-factor authentication first
+	h.completeLogin(w, r, user, http.StatusCreated)
+}
+
+// redeemInvitation marks the invitation as used and grants its role. Failures
+// leave the new account as a parent, which is always safe.
+func (h *AuthHandler) redeemInvitation(ctx context.Context, user *domain.User, invitation *domain.RoleInvitation) {
+	logger := h.logger.WithField("user_id", user.ID.String()).WithField("invitation_id", invitation.ID.String())
+
+	if err := h.invitationRepo.MarkUsed(ctx, invitation.ID, user.ID, time.Now()); err != nil {
+		logger.WithError(err).Warn("Failed to redeem invitation")
 		return
 	}
 
-	refreshToken, err := auth.GenerateRefreshToken()
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate refresh token")
-		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+	if invitation.Role == user.Role {
 		return
 	}
 
-	// Store refresh token
-	tokenHash := auth.HashRefreshToken(refreshToken)
-	refreshTokenModel := &domain.RefreshToken{
+	change := &domain.RoleChange{
 		ID:        uuid.New(),
 		UserID:    user.ID,
-		TokenHash: tokenHash,
-		ExpiresAt: time.Now().Add(h.cfg.JWT.RefreshExpiry),
+		OldRole:   user.Role,
+		NewRole:   invitation.Role,
+		ChangedBy: &invitation.CreatedBy,
+		Reason:    "invitation",
 		CreatedAt: time.Now(),
 	}
-
-	if err := h.tokenRepo.Create(ctx, refreshTokenModel); err != nil {
-		h.logger.WithError(err).Error("Failed to store refresh token")
-		// Don't fail if refresh token storage fails
+	if err := h.roleChangeRepo.Apply(ctx, change); err != nil {
+		logger.WithError(err).Error("Failed to apply invited role")
+		return
 	}
 
-	writeJSON(w, authResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User:         user,
-	}, http.StatusCreated)
+	user.Role = invitation.Role
+	user.UpdatedAt = change.CreatedAt
+	logger.WithField("role", string(user.Role)).Info("Invitation redeemed")
 }
 
 // Login handles user login
@@ -177,9 +236,19 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refuse attempts while the account or client is locked out, even with
+	// the right password
+	accountKey := loginAccountKey(req.Email)
+	attempts, remaining := h.beginLoginAttempt(r, accountKey)
+	if remaining > 0 {
+		h.writeLoginLockedOut(w, r, remaining)
+		return
+	}
+
 	// Get user by email
 	user, err := h.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
+		h.failLoginAttempt(r, attempts, nil)
 		writeError(w, "invalid_credentials", "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
@@ -187,44 +256,40 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// Verify password
 	valid, err := auth.VerifyPassword(req.Password, user.PasswordHash)
 	if err != nil || !valid {
+		h.failLoginAttempt(r, attempts, user)
 		writeError(w, "invalid_credentials", "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate tokens
-	accessToken, err := auth.GenerateAccessToken(user.ID.String(), user.Email, string(user.Role), h.cfg.JWT.Secret, h.cfg.JWT.AccessExpiry)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate access token")
-		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+	// The account's failures are cleared once the login completes, which may
+	// still need a second factor
+	h.releaseLoginAttempt(r, attempts)
+	h.rehashPassword(r, user, req.Password)
+	h.completeLogin(w, r, user, http.StatusOK)
+}
+
+// rehashPassword upgrades a stored hash with outdated parameters, or in the
+// legacy format, to the configured parameters. It never fails the login.
+func (h *AuthHandler) rehashPassword(r *http.Request, user *domain.User, password string) {
+	params := passwordParams(h.cfg)
+	if !auth.NeedsRehash(user.PasswordHash, params) {
 		return
 	}
 
-	refreshToken, err := auth.GenerateRefreshToken()
+	passwordHash, err := auth.HashPassword(password, params)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate refresh token")
-		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+		h.logger.WithError(err).Error("Failed to rehash password")
 		return
 	}
 
-	// Store refresh token
-	tokenHash := auth.HashRefreshToken(refreshToken)
-	refreshTokenModel := &domain.RefreshToken{
-		ID:        uuid.New(),
-		UserID:    user.ID,
-		TokenHash: tokenHash,
-		ExpiresAt: time.Now().Add(h.cfg.JWT.RefreshExpiry),
-		CreatedAt: time.Now(),
+	err = h.userRepo.ReplacePasswordHash(r.Context(), user.ID, user.PasswordHash, passwordHash)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).Error("Failed to store rehashed password")
+		return
 	}
-
-	if err := h.tokenRepo.Create(ctx, refreshTokenModel); err != nil {
-		h.logger.WithError(err).Error("Failed to store refresh token")
+	if err == nil {
+		user.PasswordHash = passwordHash
 	}
-
-	writeJSON(w, authResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User:         user,
-	}, http.StatusOK)
 }
 
 // Refresh handles token refresh
@@ -244,7 +309,13 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !storedToken.IsValid() {
+	if storedToken.IsRevoked() {
+		h.handleRevokedToken(r, storedToken)
+		writeError(w, "invalid_token", "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if storedToken.IsExpired() {
 		writeError(w, "invalid_token", "Invalid or expired refresh token", http.StatusUnauthorized)
 		return
 	}
@@ -256,38 +327,36 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Revoke old token
-	if err := h.tokenRepo.Revoke(ctx, tokenHash, time.Now()); err != nil {
-		h.logger.WithError(err).Error("Failed to revoke old token")
-	}
-
 	// Generate new tokens
-	accessToken, err := auth.GenerateAccessToken(user.ID.String(), user.Email, string(user.Role), h.cfg.JWT.Secret, h.cfg.JWT.AccessExpiry)
+	accessToken, err := h.newAccessToken(user, storedToken.FamilyID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to generate access token")
 		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
 		return
 	}
 
-	newRefreshToken, err := auth.GenerateRefreshToken()
+	newRefreshToken, newTokenModel, err := h.newRefreshToken(user.ID, storedToken.FamilyID, &storedToken.ID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to generate refresh token")
 		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
 		return
 	}
 
-	// Store new refresh token
-	newTokenHash := auth.HashRefreshToken(newRefreshToken)
-	newTokenModel := &domain.RefreshToken{
-		ID:        uuid.New(),
-		UserID:    user.ID,
-		TokenHash: newTokenHash,
-		ExpiresAt: time.Now().Add(h.cfg.JWT.RefreshExpiry),
-		CreatedAt: time.Now(),
+	// Revoke the old token and store the new one atomically
+	if err := h.tokenRepo.Rotate(ctx, tokenHash, newTokenModel); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			// The token was revoked concurrently by another request
+			h.handleRevokedToken(r, storedToken)
+			writeError(w, "invalid_token", "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to rotate refresh token")
+		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+		return
 	}
 
-	if err := h.tokenRepo.Create(ctx, newTokenModel); err != nil {
-		h.logger.WithError(err).Error("Failed to store refresh token")
+	if err := h.sessionRepo.Touch(ctx, storedToken.FamilyID, clientIP(r), userAgent(r), newTokenModel.CreatedAt, newTokenModel.ExpiresAt); err != nil {
+		h.logger.WithError(err).Warn("Failed to update session")
 	}
 
 	writeJSON(w, authResponse{
@@ -297,6 +366,104 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusOK)
 }
 
+// startSession records a new login session for user and issues its first
+// pair of tokens
+func (h *AuthHandler) startSession(r *http.Request, user *domain.User) (*authResponse, error) {
+	ctx := r.Context()
+	now := time.Now()
+
+	session := &domain.Session{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		UserAgent:  userAgent(r),
+		IPAddress:  clientIP(r),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(h.cfg.JWT.RefreshExpiry),
+	}
+	if err := h.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	// The session ID doubles as the family ID of its refresh tokens
+	refreshToken, refreshTokenModel, err := h.newRefreshToken(user.ID, session.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.tokenRepo.Create(ctx, refreshTokenModel); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	accessToken, err := h.newAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// newAccessToken issues an access token for user bound to sessionID
+func (h *AuthHandler) newAccessToken(user *domain.User, sessionID uuid.UUID) (string, error) {
+	return auth.SignAccessToken(&auth.Claims{
+		UserID:     user.ID.String(),
+		Email:      user.Email,
+		Role:       string(user.Role),
+		SessionID:  sessionID.String(),
+		Unverified: !user.IsVerified(),
+	}, h.keys, h.cfg.JWT.AccessExpiry)
+}
+
+// newRefreshToken generates a refresh token in the given family. parentID is
+// the token it replaces, if any.
+func (h *AuthHandler) newRefreshToken(userID, familyID uuid.UUID, parentID *uuid.UUID) (string, *domain.RefreshToken, error) {
+	token, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	return token, &domain.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		ParentID:  parentID,
+		TokenHash: auth.HashRefreshToken(token),
+		ExpiresAt: now.Add(h.cfg.JWT.RefreshExpiry),
+		CreatedAt: now,
+	}, nil
+}
+
+// handleRevokedToken reacts to a revoked refresh token being presented. A token
+// revoked by rotation is only presented again if it was copied, so its whole
+// family is treated as compromised. Tokens of a session that was logged out or
+// revoked are simply rejected.
+func (h *AuthHandler) handleRevokedToken(r *http.Request, token *domain.RefreshToken) {
+	session, err := h.sessionRepo.GetByID(r.Context(), token.FamilyID)
+	if err == nil && session.RevokedAt != nil {
+		return
+	}
+	h.revokeReusedFamily(r, token)
+}
+
+// revokeReusedFamily revokes the session of a reused refresh token together
+// with every token in its family and records a security event
+func (h *AuthHandler) revokeReusedFamily(r *http.Request, token *domain.RefreshToken) {
+	ctx := r.Context()
+
+	if err := revokeSession(ctx, h.sessionRepo, h.tokenRepo, token.FamilyID); err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).WithField("family_id", token.FamilyID.String()).Error("Failed to revoke token family")
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, token.UserID, domain.SecurityEventRefreshTokenReuse, map[string]string{
+		"family_id": token.FamilyID.String(),
+		"token_id":  token.ID.String(),
+	}))
+}
+
 // Logout handles user logout
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -307,9 +474,12 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenHash := auth.HashRefreshToken(req.RefreshToken)
-	if err := h.tokenRepo.Revoke(ctx, tokenHash, time.Now()); err != nil {
-		h.logger.WithError(err).Error("Failed to revoke token")
+	// Logging out ends the whole session, not just the presented token
+	storedToken, err := h.tokenRepo.GetByTokenHash(ctx, auth.HashRefreshToken(req.RefreshToken))
+	if err == nil {
+		if err := revokeSession(ctx, h.sessionRepo, h.tokenRepo, storedToken.FamilyID); err != nil && !errors.Is(err, domain.ErrNotFound) {
+			h.logger.WithError(err).Error("Failed to revoke session")
+		}
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -334,6 +504,20 @@ func writeError(w http.ResponseWriter, code, message string, status int) {
 	})
 }
 
+// writeErrorDetails writes an error response with machine readable details
+// next to the code and message
+func writeErrorDetails(w http.ResponseWriter, code, message string, details map[string]interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"details": details,
+		},
+	})
+}
+
 func getUserIDFromContext(ctx context.Context) (uuid.UUID, error) {
 	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -13,6 +15,7 @@ import (
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/storage"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/worker"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
 )
 
@@ -163,11 +166,61 @@ func (h *ClassHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, members, http.StatusOK)
 }
 
+// RemoveMember removes a member from a class. Teachers cannot remove
+// themselves so a class is never left without its teacher by accident.
+func (h *ClassHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := uuid.Parse(chi.URLParam(r, "memberId"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	isTeacher, err := h.memberRepo.IsTeacher(ctx, userID, classID)
+	if err != nil || !isTeacher {
+		writeError(w, "forbidden", "Must be a teacher to remove members", http.StatusForbidden)
+		return
+	}
+
+	member, err := h.memberRepo.GetByID(ctx, memberID)
+	if err != nil || member.ClassID != classID {
+		writeError(w, "not_found", "Member not found", http.StatusNotFound)
+		return
+	}
+
+	if member.UserID == userID {
+		writeError(w, "forbidden", "You cannot remove yourself from the class", http.StatusForbidden)
+		return
+	}
+
+	if err := h.memberRepo.Delete(ctx, memberID); err != nil {
+		h.logger.WithError(err).Error("Failed to remove member")
+		writeError(w, "internal_error", "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // PhotoHandler handles photo endpoints
 type PhotoHandler struct {
 	photoRepo  repository.PhotoRepository
 	memberRepo repository.ClassMemberRepository
 	storage    *storage.Client
+	cleaner    *worker.StorageCleaner
+	processor  *worker.PhotoProcessor
 	cfg        *config.Config
 	logger     *log.Logger
 }
@@ -176,10 +229,20 @@ func NewPhotoHandler(
 	photoRepo repository.PhotoRepository,
 	memberRepo repository.ClassMemberRepository,
 	storage *storage.Client,
+	cleaner *worker.StorageCleaner,
+	processor *worker.PhotoProcessor,
 	cfg *config.Config,
 	logger *log.Logger,
 ) *PhotoHandler {
-	return &PhotoHandler{photoRepo: photoRepo, memberRepo: memberRepo, storage: storage, cfg: cfg, logger: logger}
+	return &PhotoHandler{
+		photoRepo:  photoRepo,
+		memberRepo: memberRepo,
+		storage:    storage,
+		cleaner:    cleaner,
+		processor:  processor,
+		cfg:        cfg,
+		logger:     logger,
+	}
 }
 
 type createPhotoRequest struct {
@@ -252,6 +315,7 @@ func (h *PhotoHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
 		MediaKey:      mediaKey,
 		ContentType:   req.ContentType,
 		FileSizeBytes: req.FileSize,
+		Status:        domain.PhotoStatusPending,
 		CreatedAt:     time.Now(),
 	}
 
@@ -268,9 +332,195 @@ func (h *PhotoHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusCreated)
 }
 
+// Complete confirms that the client finished uploading a photo. The stored
+// object must match the size and content type declared in CreateUpload. The
+// photo then moves to PROCESSING and only becomes visible to the class once
+// its metadata has been stripped.
+func (h *PhotoHandler) Complete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "photoId"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid photo ID", http.StatusBadRequest)
+		return
+	}
+
+	photo, err := h.photoRepo.GetByID(ctx, photoID)
+	if err != nil || photo.ClassID != classID {
+		writeError(w, "not_found", "Photo not found", http.StatusNotFound)
+		return
+	}
+
+	if photo.UploaderID != userID {
+		writeError(w, "forbidden", "Only the uploader can complete an upload", http.StatusForbidden)
+		return
+	}
+
+	if photo.Status == domain.PhotoStatusPending {
+		info, err := h.storage.StatObject(ctx, photo.MediaKey)
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "upload_missing", "Photo has not been uploaded yet", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to stat photo upload")
+			writeError(w, "internal_error", "Failed to complete upload", http.StatusInternalServerError)
+			return
+		}
+
+		if !uploadMatches(photo, info) {
+			h.discardUpload(r, photo)
+			writeError(w, "upload_mismatch", "Uploaded file does not match the declared size or content type", http.StatusUnprocessableEntity)
+			return
+		}
+
+		err = h.photoRepo.ConfirmUpload(ctx, photo.ID)
+		switch {
+		case err == nil:
+			photo.Status = domain.PhotoStatusProcessing
+			h.processor.Notify()
+		case errors.Is(err, domain.ErrNotFound):
+			// Swept or already confirmed by a concurrent request; report
+			// the photo as it is now
+			photo, err = h.photoRepo.GetByID(ctx, photoID)
+			if err != nil {
+				writeError(w, "not_found", "Photo not found", http.StatusNotFound)
+				return
+			}
+		default:
+			h.logger.WithError(err).Error("Failed to confirm photo")
+			writeError(w, "internal_error", "Failed to complete upload", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, h.buildPhotoResponse(r, photo), http.StatusOK)
+}
+
+// uploadMatches compares the stored object against what the uploader declared
+func uploadMatches(photo *domain.Photo, info *storage.ObjectInfo) bool {
+	if info.Size != int64(photo.FileSizeBytes) {
+		return false
+	}
+	contentType, _, err := mime.ParseMediaType(info.ContentType)
+	return err == nil && contentType == photo.ContentType
+}
+
+// discardUpload removes an upload that failed verification. The client has to
+// request a new upload URL and start over.
+func (h *PhotoHandler) discardUpload(r *http.Request, photo *domain.Photo) {
+	if err := h.deletePhoto(r, photo); err != nil {
+		h.logger.WithError(err).WithField("photo_id", photo.ID.String()).Warn("Failed to discard mismatched upload")
+	}
+}
+
+// Delete removes a photo and its stored objects. The uploader and the class
+// teachers may delete a photo.
+func (h *PhotoHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "photoId"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid photo ID", http.StatusBadRequest)
+		return
+	}
+
+	photo, err := h.photoRepo.GetByID(ctx, photoID)
+	if err != nil || photo.ClassID != classID {
+		writeError(w, "not_found", "Photo not found", http.StatusNotFound)
+		return
+	}
+
+	if photo.UploaderID != userID {
+		isTeacher, err := h.memberRepo.IsTeacher(ctx, userID, classID)
+		if err != nil || !isTeacher {
+			writeError(w, "forbidden", "Only the uploader or a class teacher can delete this photo", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := h.deletePhoto(r, photo); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "not_found", "Photo not found", http.StatusNotFound)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete photo")
+		writeError(w, "internal_error", "Failed to delete photo", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithFields(map[string]interface{}{
+		"photo_id": photo.ID.String(),
+		"user_id":  userID.String(),
+	}).Info("Photo deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePhoto deletes the photo row together with a record of every object to
+// remove, then tries to remove the objects right away. Objects that cannot be
+// deleted now are retried by the storage cleaner.
+func (h *PhotoHandler) deletePhoto(r *http.Request, photo *domain.Photo) error {
+	deletions := worker.NewStorageDeletions(photo.ObjectKeys())
+	if err := h.photoRepo.DeleteWithObjects(r.Context(), photo.ID, deletions); err != nil {
+		return err
+	}
+
+	// The row is gone, so finish the object deletion even if the client disconnects
+	h.cleaner.Purge(context.WithoutCancel(r.Context()), deletions)
+	return nil
+}
+
 type photoResponse struct {
 	*domain.Photo
-	ViewURL string `json:"view_url"`
+	ViewURL      string  `json:"view_url,omitempty"`
+	ThumbnailURL *string `json:"thumbnail_url,omitempty"`
+	MediumURL    *string `json:"medium_url,omitempty"`
+}
+
+// buildPhotoResponse presigns the sanitized original and the resized
+// variants. Nothing is presigned before the photo has been sanitized.
+func (h *PhotoHandler) buildPhotoResponse(r *http.Request, photo *domain.Photo) photoResponse {
+	ctx := r.Context()
+	response := photoResponse{Photo: photo}
+	if !photo.Sanitized {
+		return response
+	}
+
+	response.ViewURL, _ = h.storage.GeneratePresignedGetURL(ctx, photo.SanitizedKey())
+	if !photo.VariantsReady {
+		return response
+	}
+
+	if thumbnailURL, err := h.storage.GeneratePresignedGetURL(ctx, photo.VariantKey(domain.PhotoVariantThumbnail)); err == nil {
+		response.ThumbnailURL = &thumbnailURL
+	}
+	if mediumURL, err := h.storage.GeneratePresignedGetURL(ctx, photo.VariantKey(domain.PhotoVariantMedium)); err == nil {
+		response.MediumURL = &mediumURL
+	}
+	return response
 }
 
 func (h *PhotoHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -294,11 +544,7 @@ func (h *PhotoHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit == 0 {
-		limit = 20
-	}
-	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, offset := parsePagination(r)
 
 	photos, err := h.photoRepo.ListByClass(ctx, classID, limit, offset)
 	if err != nil {
@@ -310,11 +556,7 @@ func (h *PhotoHandler) List(w http.ResponseWriter, r *http.Request) {
 	// Add presigned URLs
 	response := make([]photoResponse, len(photos))
 	for i, photo := range photos {
-		viewURL, _ := h.storage.GeneratePresignedGetURL(ctx, photo.MediaKey)
-		response[i] = photoResponse{
-			Photo:   photo,
-			ViewURL: viewURL,
-		}
+		response[i] = h.buildPhotoResponse(r, photo)
 	}
 
 	writeJSON(w, response, http.StatusOK)
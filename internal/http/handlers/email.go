@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+)
+
+// emailSendTimeout bounds background work that sends email, which outlives
+// the request that triggered it
+const emailSendTimeout = time.Minute
+
+// sendInBackground runs fn after the response has been sent, with a context
+// that keeps the request's values but is not canceled when the request ends
+func sendInBackground(r *http.Request, fn func(ctx context.Context)) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), emailSendTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// issueUserToken creates a single-use token for userID and returns it in
+// plaintext. Earlier unused tokens with the same purpose are invalidated so
+// only the latest emailed link works.
+func issueUserToken(
+	ctx context.Context, repo repository.UserTokenRepository, userID uuid.UUID, purpose domain.UserTokenPurpose, expiry time.Duration,
+) (string, error) {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := repo.InvalidateForUser(ctx, userID, purpose, now); err != nil {
+		return "", fmt.Errorf("failed to invalidate previous tokens: %w", err)
+	}
+
+	if err := repo.Create(ctx, &domain.UserToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(expiry),
+		CreatedAt: now,
+	}); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const (
+	inviteCodeLength     = 8
+	defaultInviteExpiry  = 7 * 24 * time.Hour
+	maxInviteExpiryHours = 30 * 24
+)
+
+// inviteCodeAlphabet leaves out characters that are easily confused when a
+// code is read aloud or copied from paper (0/O, 1/I/L)
+const inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// InviteHandler handles class invite codes and the join request workflow
+type InviteHandler struct {
+	inviteRepo      repository.ClassInviteRepository
+	joinRequestRepo repository.ClassJoinRequestRepository
+	memberRepo      repository.ClassMemberRepository
+	cfg             *config.Config
+	logger          *log.Logger
+}
+
+// NewInviteHandler creates a new invite handler
+func NewInviteHandler(
+	inviteRepo repository.ClassInviteRepository,
+	joinRequestRepo repository.ClassJoinRequestRepository,
+	memberRepo repository.ClassMemberRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *InviteHandler {
+	return &InviteHandler{
+		inviteRepo:      inviteRepo,
+		joinRequestRepo: joinRequestRepo,
+		memberRepo:      memberRepo,
+		cfg:             cfg,
+		logger:          logger,
+	}
+}
+
+type createInviteRequest struct {
+	ExpiresInHours int `json:"expires_in_hours,omitempty"`
+}
+
+type redeemInviteRequest struct {
+	Code string `json:"code"`
+}
+
+type decideJoinRequestRequest struct {
+	Status domain.JoinRequestStatus `json:"status"`
+}
+
+// CreateInvite generates a new invite code for a class
+func (h *InviteHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, classID, ok := h.requireTeacher(w, r)
+	if !ok {
+		return
+	}
+
+	var req createInviteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	expiry := defaultInviteExpiry
+	if req.ExpiresInHours != 0 {
+		if req.ExpiresInHours < 1 || req.ExpiresInHours > maxInviteExpiryHours {
+			writeError(w, "invalid_input", fmt.Sprintf("expires_in_hours must be between 1 and %d", maxInviteExpiryHours), http.StatusBadRequest)
+			return
+		}
+		expiry = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate invite code")
+		writeError(w, "internal_error", "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+
+	invite := &domain.ClassInvite{
+		ID:        uuid.New(),
+		ClassID:   classID,
+		Code:      code,
+		CreatedBy: userID,
+		ExpiresAt: time.Now().Add(expiry),
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.inviteRepo.Create(ctx, invite); err != nil {
+		h.logger.WithError(err).Error("Failed to create invite")
+		writeError(w, "internal_error", "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, invite, http.StatusCreated)
+}
+
+// ListInvites lists the active invite codes of a class
+func (h *InviteHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	_, classID, ok := h.requireTeacher(w, r)
+	if !ok {
+		return
+	}
+
+	invites, err := h.inviteRepo.ListActiveByClass(r.Context(), classID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list invites")
+		writeError(w, "internal_error", "Failed to list invites", http.StatusInternalServerError)
+		return
+	}
+
+	if invites == nil {
+		invites = []*domain.ClassInvite{}
+	}
+
+	writeJSON(w, invites, http.StatusOK)
+}
+
+// RevokeInvite revokes an invite code so it can no longer be redeemed
+func (h *InviteHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	_, classID, ok := h.requireTeacher(w, r)
+	if !ok {
+		return
+	}
+
+	inviteID, err := uuid.Parse(chi.URLParam(r, "inviteId"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.inviteRepo.GetByID(ctx, inviteID)
+	if err != nil || invite.ClassID != classID {
+		writeError(w, "not_found", "Invite not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.inviteRepo.Revoke(ctx, inviteID, time.Now()); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke invite")
+		writeError(w, "internal_error", "Failed to revoke invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Redeem turns an invite code into a pending join request for its class
+func (h *InviteHandler) Redeem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req redeemInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	code := normalizeInviteCode(req.Code)
+	if code == "" {
+		writeError(w, "invalid_input", "Invite code is required", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.inviteRepo.GetByCode(ctx, code)
+	if err != nil || !invite.IsValid() {
+		writeError(w, "invalid_invite", "Invalid or expired invite code", http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := h.memberRepo.IsMember(ctx, userID, invite.ClassID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check membership")
+		writeError(w, "internal_error", "Failed to redeem invite", http.StatusInternalServerError)
+		return
+	}
+	if isMember {
+		writeError(w, "already_exists", "Already a member of this class", http.StatusConflict)
+		return
+	}
+
+	hasPending, err := h.joinRequestRepo.HasPending(ctx, userID, invite.ClassID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check join requests")
+		writeError(w, "internal_error", "Failed to redeem invite", http.StatusInternalServerError)
+		return
+	}
+	if hasPending {
+		writeError(w, "already_exists", "A join request for this class is already pending", http.StatusConflict)
+		return
+	}
+
+	joinRequest := &domain.ClassJoinRequest{
+		ID:        uuid.New(),
+		ClassID:   invite.ClassID,
+		UserID:    userID,
+		InviteID:  &invite.ID,
+		Status:    domain.JoinRequestStatusPending,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.joinRequestRepo.Create(ctx, joinRequest); err != nil {
+		h.logger.WithError(err).Error("Failed to create join request")
+		writeError(w, "internal_error", "Failed to redeem invite", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, joinRequest, http.StatusCreated)
+}
+
+// ListMyJoinRequests lists the current user's join requests
+func (h *InviteHandler) ListMyJoinRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	requests, err := h.joinRequestRepo.ListByUser(ctx, userID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list join requests")
+		writeError(w, "internal_error", "Failed to list join requests", http.StatusInternalServerError)
+		return
+	}
+
+	if requests == nil {
+		requests = []*domain.ClassJoinRequest{}
+	}
+
+	writeJSON(w, requests, http.StatusOK)
+}
+
+// ListJoinRequests lists a class's join requests, pending ones by default
+func (h *InviteHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	_, classID, ok := h.requireTeacher(w, r)
+	if !ok {
+		return
+	}
+
+	status := domain.JoinRequestStatusPending
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = domain.JoinRequestStatus(strings.ToUpper(s))
+		if !status.IsValid() {
+			writeError(w, "invalid_input", "Invalid status", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit, offset := parsePagination(r)
+
+	requests, err := h.joinRequestRepo.ListByClass(r.Context(), classID, status, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list join requests")
+		writeError(w, "internal_error", "Failed to list join requests", http.StatusInternalServerError)
+		return
+	}
+
+	if requests == nil {
+		requests = []*domain.ClassJoinRequest{}
+	}
+
+	writeJSON(w, requests, http.StatusOK)
+}
+
+// DecideJoinRequest approves or rejects a pending join request. Approving
+// adds the requester to the class as a parent.
+func (h *InviteHandler) DecideJoinRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, classID, ok := h.requireTeacher(w, r)
+	if !ok {
+		return
+	}
+
+	requestID, err := uuid.Parse(chi.URLParam(r, "requestId"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid join request ID", http.StatusBadRequest)
+		return
+	}
+
+	var req decideJoinRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Status != domain.JoinRequestStatusApproved && req.Status != domain.JoinRequestStatusRejected {
+		writeError(w, "invalid_input", "status must be APPROVED or REJECTED", http.StatusBadRequest)
+		return
+	}
+
+	joinRequest, err := h.joinRequestRepo.GetByID(ctx, requestID)
+	if err != nil || joinRequest.ClassID != classID {
+		writeError(w, "not_found", "Join request not found", http.StatusNotFound)
+		return
+	}
+
+	decidedAt := time.Now()
+	if err := h.joinRequestRepo.Decide(ctx, requestID, req.Status, userID, decidedAt); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "conflict", "Join request has already been decided", http.StatusConflict)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to update join request")
+		writeError(w, "internal_error", "Failed to update join request", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Status == domain.JoinRequestStatusApproved {
+		member := &domain.ClassMember{
+			ID:          uuid.New(),
+			UserID:      joinRequest.UserID,
+			ClassID:     classID,
+			RoleInClass: domain.ClassRoleParent,
+			CreatedAt:   decidedAt,
+		}
+		if err := h.memberRepo.Create(ctx, member); err != nil {
+			h.logger.WithError(err).Error("Failed to add class member")
+			// Leave the request open so the teacher can retry
+			if err := h.joinRequestRepo.Reopen(ctx, requestID); err != nil {
+				h.logger.WithError(err).Error("Failed to reopen join request")
+			}
+			writeError(w, "internal_error", "Failed to add class member", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	joinRequest.Status = req.Status
+	joinRequest.DecidedBy = &userID
+	joinRequest.DecidedAt = &decidedAt
+
+	writeJSON(w, joinRequest, http.StatusOK)
+}
+
+// requireTeacher parses the class ID and checks that the current user teaches
+// the class. It writes the error response itself and returns false otherwise.
+func (h *InviteHandler) requireTeacher(w http.ResponseWriter, r *http.Request) (userID, classID uuid.UUID, ok bool) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	classID, err = uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	isTeacher, err := h.memberRepo.IsTeacher(r.Context(), userID, classID)
+	if err != nil || !isTeacher {
+		writeError(w, "forbidden", "Must be a teacher of this class", http.StatusForbidden)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, classID, true
+}
+
+func generateInviteCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(inviteCodeAlphabet)))
+	code := make([]byte, inviteCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = inviteCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeInviteCode accepts codes typed in lower case or with separators
+func normalizeInviteCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+)
+
+// loginThrottle is one of the counters a login attempt is recorded against
+type loginThrottle struct {
+	scope       domain.LoginFailureScope
+	key         string
+	maxAttempts int
+}
+
+// loginAccountKey normalizes an email address for counting failed logins
+func loginAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginThrottles returns the enabled counters for a login attempt. Failures
+// are counted per email address whether or not an account exists for it, so
+// lockouts do not reveal which addresses are registered.
+func (h *AuthHandler) loginThrottles(r *http.Request, accountKey string) []loginThrottle {
+	var throttles []loginThrottle
+	if h.cfg.Login.MaxAccountAttempts > 0 {
+		throttles = append(throttles, loginThrottle{domain.LoginFailureScopeAccount, accountKey, h.cfg.Login.MaxAccountAttempts})
+	}
+	if h.cfg.Login.MaxIPAttempts > 0 {
+		throttles = append(throttles, loginThrottle{domain.LoginFailureScopeIP, clientIP(r), h.cfg.Login.MaxIPAttempts})
+	}
+	return throttles
+}
+
+// loginAttemptHold is how long the attempt that reaches the limit locks out
+// other attempts while its credentials are checked. It is replaced by the
+// lockout if the attempt fails, and only lasts this long if the request dies.
+const loginAttemptHold = time.Minute
+
+// loginAttempt is a login attempt counted against one of the throttles
+type loginAttempt struct {
+	throttle loginThrottle
+	failure  *domain.LoginFailure
+}
+
+// held reports whether the attempt locked out others while it is checked
+func (a *loginAttempt) held() bool {
+	return a.failure.Failures >= a.throttle.maxAttempts
+}
+
+// beginLoginAttempt counts a login attempt against the account and the client
+// before the credentials are checked, so concurrent attempts cannot get past
+// the limit. If either is locked out it counts nothing and returns how long
+// the lockout lasts. Counting errors do not lock anyone out.
+func (h *AuthHandler) beginLoginAttempt(r *http.Request, accountKey string) ([]loginAttempt, time.Duration) {
+	ctx := r.Context()
+	now := time.Now()
+	windowStart := now.Add(-h.cfg.Login.FailureWindow)
+
+	var attempts []loginAttempt
+	for _, throttle := range h.loginThrottles(r, accountKey) {
+		failure, err := h.loginFailureRepo.CountAttempt(ctx, throttle.scope, throttle.key, now, windowStart,
+			throttle.maxAttempts, now.Add(loginAttemptHold))
+		if errors.Is(err, domain.ErrLockedOut) {
+			h.releaseLoginAttempt(r, attempts)
+			return nil, h.loginLockout(r, throttle, now)
+		}
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to count login attempt")
+			continue
+		}
+		attempts = append(attempts, loginAttempt{throttle: throttle, failure: failure})
+	}
+	return attempts, 0
+}
+
+// loginLockout returns how long logins are still locked out for the throttle
+func (h *AuthHandler) loginLockout(r *http.Request, throttle loginThrottle, now time.Time) time.Duration {
+	failure, err := h.loginFailureRepo.Get(r.Context(), throttle.scope, throttle.key)
+	if err != nil || !failure.IsLocked(now) {
+		if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			h.logger.WithError(err).Error("Failed to get login failures")
+		}
+		// The lockout ended in the meantime
+		return time.Second
+	}
+	return failure.LockedUntil.Sub(now)
+}
+
+// failLoginAttempt keeps a failed attempt counted and locks out the account or
+// the client once it reaches its limit. Every failure after that doubles the
+// lockout. user is nil if no account exists for the email address.
+func (h *AuthHandler) failLoginAttempt(r *http.Request, attempts []loginAttempt, user *domain.User) {
+	ctx := r.Context()
+	now := time.Now()
+
+	for _, attempt := range attempts {
+		throttle, failure := attempt.throttle, attempt.failure
+		lockout := h.cfg.Login.LockoutDuration(failure.Failures, throttle.maxAttempts)
+		if lockout == 0 {
+			continue
+		}
+
+		lockedUntil := now.Add(lockout)
+		if err := h.loginFailureRepo.Lock(ctx, throttle.scope, throttle.key, lockedUntil); err != nil {
+			h.logger.WithError(err).Error("Failed to lock out login")
+			continue
+		}
+
+		fields := map[string]interface{}{
+			"request_id":   requestID(r),
+			"scope":        string(throttle.scope),
+			"ip_address":   clientIP(r),
+			"failures":     failure.Failures,
+			"locked_until": lockedUntil.Format(time.RFC3339),
+		}
+		if user != nil {
+			fields["user_id"] = user.ID.String()
+		}
+		h.logger.WithFields(fields).Warn("Login locked out after repeated failures")
+
+		if throttle.scope == domain.LoginFailureScopeAccount && user != nil {
+			recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventAccountLocked, map[string]string{
+				"failures":     strconv.Itoa(failure.Failures),
+				"locked_until": lockedUntil.Format(time.RFC3339),
+			}))
+		}
+	}
+}
+
+// releaseLoginAttempt uncounts attempts that succeeded, or that could not be
+// checked, and lifts the lock they held
+func (h *AuthHandler) releaseLoginAttempt(r *http.Request, attempts []loginAttempt) {
+	for _, attempt := range attempts {
+		if err := h.loginFailureRepo.Release(r.Context(), attempt.throttle.scope, attempt.throttle.key, attempt.held()); err != nil {
+			h.logger.WithError(err).Error("Failed to release login attempt")
+		}
+	}
+}
+
+// clearLoginFailures resets the account's failure count after a completed
+// login. The client IP keeps its count, so one valid account cannot be used to
+// reset the limit while guessing others.
+func (h *AuthHandler) clearLoginFailures(r *http.Request, accountKey string) {
+	if err := h.loginFailureRepo.Clear(r.Context(), domain.LoginFailureScopeAccount, accountKey); err != nil {
+		h.logger.WithError(err).Error("Failed to clear login failures")
+	}
+}
+
+// writeLoginLockedOut rejects a login attempt during a lockout
+func (h *AuthHandler) writeLoginLockedOut(w http.ResponseWriter, r *http.Request, remaining time.Duration) {
+	h.logger.WithFields(map[string]interface{}{
+		"request_id": requestID(r),
+		"ip_address": clientIP(r),
+	}).Warn("Login attempt rejected during lockout")
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+	writeError(w, "too_many_attempts", "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
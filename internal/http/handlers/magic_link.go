@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/mail"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// MagicLinkHandler handles passwordless login with single-use links sent by
+// email
+type MagicLinkHandler struct {
+	authHandler   *AuthHandler
+	userRepo      repository.UserRepository
+	userTokenRepo repository.UserTokenRepository
+	rateLimitRepo repository.RateLimitRepository
+	mailer        mail.Mailer
+	cfg           *config.Config
+	logger        *log.Logger
+}
+
+// NewMagicLinkHandler creates a new magic link handler. Logins are completed
+// by authHandler, including two-factor authentication.
+func NewMagicLinkHandler(
+	authHandler *AuthHandler,
+	userRepo repository.UserRepository,
+	userTokenRepo repository.UserTokenRepository,
+	rateLimitRepo repository.RateLimitRepository,
+	mailer mail.Mailer,
+	cfg *config.Config,
+	logger *log.Logger,
+) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		authHandler:   authHandler,
+		userRepo:      userRepo,
+		userTokenRepo: userTokenRepo,
+		rateLimitRepo: rateLimitRepo,
+		mailer:        mailer,
+		cfg:           cfg,
+		logger:        logger,
+	}
+}
+
+type magicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type magicLinkLoginRequest struct {
+	Token string `json:"token"`
+}
+
+// Request emails a magic link to the given address. Like a password reset,
+// the response is the same whether or not an account exists, and only
+// accounts with a role allowed to use magic links get an email.
+func (h *MagicLinkHandler) Request(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.MagicLink.Enabled {
+		writeError(w, "magic_link_disabled", "Magic link login is disabled", http.StatusForbidden)
+		return
+	}
+
+	var req magicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		writeError(w, "invalid_input", "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	if retryAfter := h.rateLimited(r, email); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(w, "too_many_requests", "Too many sign-in links requested, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	sendInBackground(r, func(ctx context.Context) {
+		h.sendMagicLink(ctx, email)
+	})
+
+	writeJSON(w, map[string]string{
+		"message": "If you can sign in with a link, one has been sent to this email address",
+	}, http.StatusAccepted)
+}
+
+// rateLimited counts the request per email address and per client IP and
+// returns how long until another request is allowed, or 0 if this one is.
+// The client IP only comes from forwarding headers set by trusted proxies, so
+// it cannot be changed per request. Errors do not block requests.
+func (h *MagicLinkHandler) rateLimited(r *http.Request, email string) time.Duration {
+	now := time.Now()
+	window := h.cfg.MagicLink.RequestWindow
+
+	limits := []struct {
+		scope domain.RateLimitScope
+		key   string
+		max   int
+	}{
+		{domain.RateLimitScopeMagicLinkEmail, loginAccountKey(email), h.cfg.MagicLink.MaxPerEmail},
+		{domain.RateLimitScopeMagicLinkIP, clientIP(r), h.cfg.MagicLink.MaxPerIP},
+	}
+
+	var retryAfter time.Duration
+	for _, limit := range limits {
+		if limit.max <= 0 {
+			continue
+		}
+		hits, startedAt, err := h.rateLimitRepo.Hit(r.Context(), limit.scope, limit.key, now, now.Add(-window))
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to count magic link request")
+			continue
+		}
+		if hits > limit.max {
+			retryAfter = max(retryAfter, startedAt.Add(window).Sub(now))
+		}
+	}
+
+	if retryAfter > 0 {
+		h.logger.WithFields(map[string]interface{}{
+			"request_id": requestID(r),
+			"ip_address": clientIP(r),
+		}).Warn("Magic link request rate limited")
+	}
+	return retryAfter
+}
+
+// sendMagicLink issues a new login token for the account, if it may use magic
+// links, and emails it
+func (h *MagicLinkHandler) sendMagicLink(ctx context.Context, email string) {
+	user, err := h.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			h.logger.WithError(err).Error("Failed to look up user for magic link")
+		}
+		return
+	}
+	if !h.cfg.MagicLink.AllowsRole(string(user.Role)) {
+		return
+	}
+
+	token, err := issueUserToken(ctx, h.userTokenRepo, user.ID, domain.UserTokenMagicLink, h.cfg.MagicLink.Expiry)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to issue magic link token")
+		return
+	}
+
+	link := h.cfg.Mail.AppBaseURL + "/magic-link?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Your TinySchoolHub sign-in link",
+		Body: fmt.Sprintf("Someone asked to sign in to your TinySchoolHub account.\n\n"+
+			"Open this link to sign in:\n%s\n\n"+
+			"The link expires in %s and can only be used once. "+
+			"If you did not ask for this, you can ignore this email.\n", link, h.cfg.MagicLink.Expiry),
+	}
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		h.logger.WithError(err).WithField("user_id", user.ID.String()).Error("Failed to send magic link email")
+	}
+}
+
+// Login redeems a magic link token and logs the user in, with the same
+// response as a password login
+func (h *MagicLinkHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !h.cfg.MagicLink.Enabled {
+		writeError(w, "magic_link_disabled", "Magic link login is disabled", http.StatusForbidden)
+		return
+	}
+
+	var req magicLinkLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		writeError(w, "invalid_input", "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.userTokenRepo.GetByTokenHash(ctx, domain.UserTokenMagicLink, auth.HashToken(req.Token))
+	if err != nil || !token.IsValid(time.Now()) {
+		writeError(w, "invalid_token", "Invalid or expired sign-in link", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	// The role may have changed since the link was sent
+	if err != nil || !h.cfg.MagicLink.AllowsRole(string(user.Role)) {
+		writeError(w, "invalid_token", "Invalid or expired sign-in link", http.StatusUnauthorized)
+		return
+	}
+
+	// Claiming the token first makes it single-use even under concurrent requests
+	now := time.Now()
+	if err := h.userTokenRepo.MarkUsed(ctx, token.ID, now); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "invalid_token", "Invalid or expired sign-in link", http.StatusUnauthorized)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to use magic link token")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	// The link was delivered to the user's inbox, which proves they own it
+	if !user.IsVerified() {
+		if err := h.userRepo.MarkVerified(ctx, user.ID, now); err != nil {
+			h.logger.WithError(err).Warn("Failed to mark user verified after magic link login")
+		} else {
+			user.VerifiedAt = &now
+		}
+	}
+
+	h.authHandler.completeLogin(w, r, user, http.StatusOK)
+}
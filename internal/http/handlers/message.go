@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const maxMessageLength = 5000
+
+// MessageHandler handles direct and class-wide messaging endpoints
+type MessageHandler struct {
+	messageRepo repository.MessageRepository
+	memberRepo  repository.ClassMemberRepository
+	userRepo    repository.UserRepository
+	cfg         *config.Config
+	logger      *log.Logger
+}
+
+// NewMessageHandler creates a new message handler
+func NewMessageHandler(
+	messageRepo repository.MessageRepository,
+	memberRepo repository.ClassMemberRepository,
+	userRepo repository.UserRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *MessageHandler {
+	return &MessageHandler{
+		messageRepo: messageRepo,
+		memberRepo:  memberRepo,
+		userRepo:    userRepo,
+		cfg:         cfg,
+		logger:      logger,
+	}
+}
+
+type sendMessageRequest struct {
+	RecipientID *uuid.UUID `json:"recipient_id,omitempty"`
+	ClassID     *uuid.UUID `json:"class_id,omitempty"`
+	Body        string     `json:"body"`
+}
+
+// Send posts a direct message to a user or a broadcast to a class
+func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req sendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		writeError(w, "invalid_input", "Message body is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		writeError(w, "invalid_input", "Message body is too long", http.StatusBadRequest)
+		return
+	}
+
+	if (req.RecipientID == nil) == (req.ClassID == nil) {
+		writeError(w, "invalid_input", "Exactly one of recipient_id or class_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.ClassID != nil {
+		isMember, err := h.memberRepo.IsMember(ctx, userID, *req.ClassID)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to check class membership")
+			writeError(w, "internal_error", "Failed to send message", http.StatusInternalServerError)
+			return
+		}
+		if !isMember {
+			writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+			return
+		}
+	} else {
+		if *req.RecipientID == userID {
+			writeError(w, "invalid_input", "Cannot send a message to yourself", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.userRepo.GetByID(ctx, *req.RecipientID); err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				writeError(w, "not_found", "Recipient not found", http.StatusNotFound)
+				return
+			}
+			h.logger.WithError(err).Error("Failed to get recipient")
+			writeError(w, "internal_error", "Failed to send message", http.StatusInternalServerError)
+			return
+		}
+		allowed, err := h.canMessage(r, userID, *req.RecipientID)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to check messaging permissions")
+			writeError(w, "internal_error", "Failed to send message", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			writeError(w, "forbidden", "You can only message teachers and parents of classes you share", http.StatusForbidden)
+			return
+		}
+	}
+
+	message := &domain.Message{
+		ID:          uuid.New(),
+		SenderID:    userID,
+		RecipientID: req.RecipientID,
+		ClassID:     req.ClassID,
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := h.messageRepo.Create(ctx, message); err != nil {
+		h.logger.WithError(err).Error("Failed to create message")
+		writeError(w, "internal_error", "Failed to send message", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, message, http.StatusCreated)
+}
+
+// canMessage reports whether sender may send a direct message to recipient.
+// Admins may message anyone. Everyone else needs a shared class in which at
+// least one side is a teacher, so parents can reach their teachers and
+// teachers their parents, but parents cannot message each other.
+func (h *MessageHandler) canMessage(r *http.Request, senderID, recipientID uuid.UUID) (bool, error) {
+	ctx := r.Context()
+	if role, _ := middleware.GetUserRole(ctx); role == string(domain.RoleAdmin) {
+		return true, nil
+	}
+
+	memberships, err := h.memberRepo.ListByUser(ctx, senderID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, membership := range memberships {
+		if membership.RoleInClass == domain.ClassRoleTeacher {
+			isMember, err := h.memberRepo.IsMember(ctx, recipientID, membership.ClassID)
+			if err != nil {
+				return false, err
+			}
+			if isMember {
+				return true, nil
+			}
+			continue
+		}
+
+		isTeacher, err := h.memberRepo.IsTeacher(ctx, recipientID, membership.ClassID)
+		if err != nil {
+			return false, err
+		}
+		if isTeacher {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Inbox lists direct messages sent or received by the current user
+func (h *MessageHandler) Inbox(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	messages, err := h.messageRepo.ListByUser(ctx, userID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list messages")
+		writeError(w, "internal_error", "Failed to list messages", http.StatusInternalServerError)
+		return
+	}
+
+	if messages == nil {
+		messages = []*domain.Message{}
+	}
+
+	writeJSON(w, messages, http.StatusOK)
+}
+
+// ListByClass lists class-wide messages for members of the class
+func (h *MessageHandler) ListByClass(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	classID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := h.memberRepo.IsMember(ctx, userID, classID)
+	if err != nil || !isMember {
+		writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	messages, err := h.messageRepo.ListByClass(ctx, classID, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list class messages")
+		writeError(w, "internal_error", "Failed to list messages", http.StatusInternalServerError)
+		return
+	}
+
+	if messages == nil {
+		messages = []*domain.Message{}
+	}
+
+	writeJSON(w, messages, http.StatusOK)
+}
+
+// MarkAsRead marks a direct message as read by its recipient
+func (h *MessageHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		writeError(w, "not_found", "Message not found", http.StatusNotFound)
+		return
+	}
+
+	// Class messages have a single read_at column, so only direct messages
+	// carry a meaningful per-recipient read state.
+	if !message.IsDirect() || *message.RecipientID != userID {
+		writeError(w, "forbidden", "Only the recipient can mark a message as read", http.StatusForbidden)
+		return
+	}
+
+	if message.ReadAt == nil {
+		readAt := time.Now()
+		if err := h.messageRepo.MarkAsRead(ctx, messageID, readAt); err != nil {
+			h.logger.WithError(err).Error("Failed to mark message as read")
+			writeError(w, "internal_error", "Failed to update message", http.StatusInternalServerError)
+			return
+		}
+		message.ReadAt = &readAt
+	}
+
+	writeJSON(w, message, http.StatusOK)
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// errInvalidMFACode is returned when a TOTP or recovery code is wrong, expired
+// or was already used
+var errInvalidMFACode = errors.New("invalid two-factor code")
+
+// MFAHandler handles two-factor authentication management for the current user
+type MFAHandler struct {
+	userRepo     repository.UserRepository
+	mfaRepo      repository.MFARepository
+	securityRepo repository.SecurityEventRepository
+	cfg          *config.Config
+	logger       *log.Logger
+}
+
+// NewMFAHandler creates a new MFA handler
+func NewMFAHandler(
+	userRepo repository.UserRepository,
+	mfaRepo repository.MFARepository,
+	securityRepo repository.SecurityEventRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *MFAHandler {
+	return &MFAHandler{
+		userRepo:     userRepo,
+		mfaRepo:      mfaRepo,
+		securityRepo: securityRepo,
+		cfg:          cfg,
+		logger:       logger,
+	}
+}
+
+// mfaCodeRequest carries a second factor. RecoveryCode is used instead of
+// Code when the authenticator is not available.
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type mfaStatusResponse struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	Required               bool       `json:"required"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// mfaSetupResponse contains the secret of a pending factor. It is only ever
+// returned when enrollment starts.
+type mfaSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Status returns whether two-factor authentication is enabled for the current user
+func (h *MFAHandler) Status(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	response := mfaStatusResponse{Required: h.cfg.MFA.IsRequired(string(user.Role))}
+
+	factor, err := h.mfaRepo.GetFactor(ctx, user.ID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).Error("Failed to get MFA factor")
+		writeError(w, "internal_error", "Failed to load two-factor status", http.StatusInternalServerError)
+		return
+	}
+	if factor != nil && factor.IsEnabled() {
+		response.Enabled = true
+		response.EnabledAt = factor.EnabledAt
+
+		response.RecoveryCodesRemaining, err = h.mfaRepo.CountUnusedRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to count recovery codes")
+			writeError(w, "internal_error", "Failed to load two-factor status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, response, http.StatusOK)
+}
+
+// Setup starts enrollment by creating a pending factor. It is enabled once a
+// first code is confirmed; calling Setup again replaces the pending secret.
+func (h *MFAHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	setup, err := savePendingMFAFactor(r.Context(), h.mfaRepo, h.cfg, user)
+	if err != nil {
+		if errors.Is(err, domain.ErrAlreadyExists) {
+			writeError(w, "already_enabled", "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to start MFA enrollment")
+		writeError(w, "internal_error", "Failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, setup, http.StatusCreated)
+}
+
+// Confirm enables the pending factor with a first code from the authenticator
+// and returns the recovery codes, which are not shown again
+func (h *MFAHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	factor, err := h.mfaRepo.GetFactor(ctx, user.ID)
+	if err != nil || factor.IsEnabled() {
+		writeError(w, "not_found", "No pending two-factor setup", http.StatusNotFound)
+		return
+	}
+
+	step, err := validatePendingMFACode(factor, req.Code)
+	if err != nil {
+		writeError(w, "invalid_code", "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := enableMFAFactor(ctx, h.mfaRepo, user.ID, step)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "not_found", "No pending two-factor setup", http.StatusNotFound)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to enable MFA")
+		writeError(w, "internal_error", "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventMFAEnabled, nil))
+
+	writeJSON(w, recoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// Disable turns two-factor authentication off after checking a current code.
+// Users whose role requires it cannot turn it off.
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if h.cfg.MFA.IsRequired(string(user.Role)) {
+		writeError(w, "forbidden", "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+
+	factor, ok := h.verifyCurrentFactor(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaRepo.DeleteFactor(ctx, factor.UserID); err != nil {
+		h.logger.WithError(err).Error("Failed to disable MFA")
+		writeError(w, "internal_error", "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventMFADisabled, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current
+// code. The previous codes stop working.
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.verifyCurrentFactor(w, r, user); !ok {
+		return
+	}
+
+	codes, records, err := newRecoveryCodes(user.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate recovery codes")
+		writeError(w, "internal_error", "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.mfaRepo.ReplaceRecoveryCodes(ctx, user.ID, records); err != nil {
+		h.logger.WithError(err).Error("Failed to store recovery codes")
+		writeError(w, "internal_error", "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, recoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// currentUser loads the authenticated user. It writes the error response
+// itself and returns false on failure.
+func (h *MFAHandler) currentUser(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+// verifyCurrentFactor checks the code in the request body against the user's
+// enabled factor. It writes the error response itself and returns false on
+// failure.
+func (h *MFAHandler) verifyCurrentFactor(w http.ResponseWriter, r *http.Request, user *domain.User) (*domain.MFAFactor, bool) {
+	ctx := r.Context()
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	factor, err := h.mfaRepo.GetFactor(ctx, user.ID)
+	if err != nil || !factor.IsEnabled() {
+		writeError(w, "not_found", "Two-factor authentication is not enabled", http.StatusNotFound)
+		return nil, false
+	}
+
+	if _, err := verifyMFACode(ctx, h.mfaRepo, factor, req); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			writeError(w, "invalid_code", "Invalid two-factor code", http.StatusBadRequest)
+			return nil, false
+		}
+		h.logger.WithError(err).Error("Failed to verify MFA code")
+		writeError(w, "internal_error", "Failed to verify two-factor code", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return factor, true
+}
+
+// savePendingMFAFactor creates or replaces the pending factor of user and
+// returns what the authenticator app needs to enroll
+func savePendingMFAFactor(ctx context.Context, repo repository.MFARepository, cfg *config.Config, user *domain.User) (*mfaSetupResponse, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.SavePendingFactor(ctx, &domain.MFAFactor{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &mfaSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(cfg.MFA.Issuer, user.Email, secret),
+	}, nil
+}
+
+// validatePendingMFACode checks the first code of a pending factor and returns
+// its time step
+func validatePendingMFACode(factor *domain.MFAFactor, code string) (int64, error) {
+	step, ok := auth.ValidateTOTPCode(factor.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return 0, errInvalidMFACode
+	}
+	return step, nil
+}
+
+// enableMFAFactor enables the pending factor of userID, whose first code was
+// accepted at step, and returns freshly generated recovery codes
+func enableMFAFactor(ctx context.Context, repo repository.MFARepository, userID uuid.UUID, step int64) ([]string, error) {
+	codes, records, err := newRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.EnableFactor(ctx, userID, step, time.Now(), records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifyMFACode checks a TOTP or recovery code against an enabled factor and
+// consumes it, so it cannot be used again. It reports whether a recovery code
+// was used.
+func verifyMFACode(ctx context.Context, repo repository.MFARepository, factor *domain.MFAFactor, req mfaCodeRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		err := repo.UseRecoveryCode(ctx, factor.UserID, auth.HashRecoveryCode(req.RecoveryCode), time.Now())
+		if errors.Is(err, domain.ErrNotFound) {
+			return false, errInvalidMFACode
+		}
+		return err == nil, err
+	}
+
+	step, ok := auth.ValidateTOTPCode(factor.Secret, strings.TrimSpace(req.Code), time.Now())
+	if !ok || step <= factor.LastUsedStep {
+		return false, errInvalidMFACode
+	}
+
+	// Claiming the step rejects a code replayed concurrently
+	if err := repo.UseStep(ctx, factor.UserID, step); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return false, errInvalidMFACode
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// newRecoveryCodes generates a set of recovery codes for userID, returning the
+// plaintext codes and the hashed records to store
+func newRecoveryCodes(userID uuid.UUID) ([]string, []*domain.MFARecoveryCode, error) {
+	codes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+
+	now := time.Now()
+	records := make([]*domain.MFARecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = &domain.MFARecoveryCode{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CodeHash:  auth.HashRecoveryCode(code),
+			CreatedAt: now,
+		}
+	}
+	return codes, records, nil
+}
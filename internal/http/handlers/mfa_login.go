@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+)
+
+// mfaChallengeResponse is returned by login instead of tokens while the second
+// factor is outstanding. EnrollmentRequired is set for users whose role
+// requires two-factor authentication but who have not enrolled yet.
+type mfaChallengeResponse struct {
+	MFARequired        bool      `json:"mfa_required"`
+	MFAToken           string    `json:"mfa_token"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+type mfaChallengeRequest struct {
+	MFAToken string `json:"mfa_token"`
+	mfaCodeRequest
+}
+
+// mfaLoginResponse includes the recovery codes when completing the challenge
+// also completed enrollment
+type mfaLoginResponse struct {
+	*authResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// completeLogin starts a session for a user whose password was checked. Users
+// with two-factor authentication enabled, or required for their role, get an
+// MFA challenge instead.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *domain.User, status int) {
+	ctx := r.Context()
+
+	factor, err := h.mfaRepo.GetFactor(ctx, user.ID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).Error("Failed to get MFA factor")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+	enrolled := factor != nil && factor.IsEnabled()
+
+	if enrolled || h.cfg.MFA.IsRequired(string(user.Role)) {
+		challenge, err := h.newMFAChallenge(r, user, !enrolled)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to create MFA challenge")
+			writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, challenge, status)
+		return
+	}
+
+	// Failed attempts are only forgotten once the whole login succeeded
+	h.clearLoginFailures(r, loginAccountKey(user.Email))
+
+	response, err := h.startSession(r, user)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to start session")
+		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, response, status)
+}
+
+func (h *AuthHandler) newMFAChallenge(r *http.Request, user *domain.User, enrollmentRequired bool) (*mfaChallengeResponse, error) {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	challenge := &domain.MFAChallenge{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(h.cfg.MFA.ChallengeExpiry),
+		CreatedAt: now,
+	}
+	if err := h.challengeRepo.Create(r.Context(), challenge); err != nil {
+		return nil, fmt.Errorf("failed to store challenge: %w", err)
+	}
+
+	return &mfaChallengeResponse{
+		MFARequired:        true,
+		MFAToken:           token,
+		EnrollmentRequired: enrollmentRequired,
+		ExpiresAt:          challenge.ExpiresAt,
+	}, nil
+}
+
+// SetupMFA starts enrollment for a user who has to enroll before their login
+// can complete. It does not use up the challenge.
+func (h *AuthHandler) SetupMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req mfaChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challenge, user, ok := h.loadMFAChallenge(w, r, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	setup, err := savePendingMFAFactor(ctx, h.mfaRepo, h.cfg, user)
+	if err != nil {
+		if errors.Is(err, domain.ErrAlreadyExists) {
+			writeError(w, "already_enabled", "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		h.logger.WithError(err).WithField("challenge_id", challenge.ID.String()).Error("Failed to start MFA enrollment")
+		writeError(w, "internal_error", "Failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, setup, http.StatusCreated)
+}
+
+// VerifyMFA completes a login challenge with a TOTP or recovery code and
+// starts the session. For users enrolling during login, the first code also
+// enables the factor and the recovery codes are returned once. Wrong codes
+// count as failed logins of the account, so new challenges cannot be used to
+// keep guessing.
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req mfaChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challenge, user, ok := h.loadMFAChallenge(w, r, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	factor, err := h.mfaRepo.GetFactor(ctx, user.ID)
+	if errors.Is(err, domain.ErrNotFound) {
+		writeError(w, "mfa_enrollment_required", "Set up two-factor authentication first", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get MFA factor")
+		writeError(w, "internal_error", "Failed to verify two-factor code", http.StatusInternalServerError)
+		return
+	}
+
+	accountKey := loginAccountKey(user.Email)
+	attempts, remaining := h.beginLoginAttempt(r, accountKey)
+	if remaining > 0 {
+		h.writeLoginLockedOut(w, r, remaining)
+		return
+	}
+
+	// The attempt is counted before the code is checked, so concurrent
+	// requests cannot get more guesses than the challenge allows
+	challenge, err = h.challengeRepo.CountAttempt(ctx, challenge.ID, time.Now())
+	if err != nil {
+		h.releaseLoginAttempt(r, attempts)
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "invalid_token", "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to count MFA attempt")
+		writeError(w, "internal_error", "Failed to verify two-factor code", http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		usedRecoveryCode bool
+		enrollmentStep   int64
+	)
+	if factor.IsEnabled() {
+		usedRecoveryCode, err = verifyMFACode(ctx, h.mfaRepo, factor, req.mfaCodeRequest)
+	} else {
+		enrollmentStep, err = validatePendingMFACode(factor, req.Code)
+	}
+	if errors.Is(err, errInvalidMFACode) {
+		h.failLoginAttempt(r, attempts, user)
+		h.rejectMFACode(r, challenge)
+		writeError(w, "invalid_code", "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+	h.releaseLoginAttempt(r, attempts)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to verify MFA code")
+		writeError(w, "internal_error", "Failed to verify two-factor code", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.challengeRepo.MarkUsed(ctx, challenge.ID, time.Now()); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "invalid_token", "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to use MFA challenge")
+		writeError(w, "internal_error", "Failed to verify two-factor code", http.StatusInternalServerError)
+		return
+	}
+
+	var recoveryCodes []string
+	if !factor.IsEnabled() {
+		recoveryCodes, err = enableMFAFactor(ctx, h.mfaRepo, user.ID, enrollmentStep)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to enable MFA")
+			writeError(w, "internal_error", "Failed to enable two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventMFAEnabled, nil))
+	}
+
+	if usedRecoveryCode {
+		recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventMFARecoveryCodeUsed, nil))
+	}
+
+	h.clearLoginFailures(r, accountKey)
+
+	response, err := h.startSession(r, user)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to start session")
+		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, mfaLoginResponse{
+		authResponse:  response,
+		RecoveryCodes: recoveryCodes,
+	}, http.StatusOK)
+}
+
+// loadMFAChallenge looks up a valid challenge and its user. It writes the
+// error response itself and returns false on failure.
+func (h *AuthHandler) loadMFAChallenge(w http.ResponseWriter, r *http.Request, token string) (*domain.MFAChallenge, *domain.User, bool) {
+	ctx := r.Context()
+
+	challenge, err := h.challengeRepo.GetByTokenHash(ctx, auth.HashToken(token))
+	if err != nil || !challenge.IsValid(time.Now()) {
+		writeError(w, "invalid_token", "Invalid or expired MFA token", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	user, err := h.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		writeError(w, "invalid_token", "Invalid or expired MFA token", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	return challenge, user, true
+}
+
+// rejectMFACode records a wrong code. The attempt was already counted against
+// the challenge, which is discarded after domain.MaxMFAChallengeAttempts codes.
+func (h *AuthHandler) rejectMFACode(r *http.Request, challenge *domain.MFAChallenge) {
+	recordSecurityEvent(r.Context(), h.securityRepo, h.logger, newSecurityEvent(r, challenge.UserID, domain.SecurityEventMFAChallengeFailed, map[string]string{
+		"challenge_id": challenge.ID.String(),
+		"attempt":      fmt.Sprint(challenge.Attempts),
+	}))
+}
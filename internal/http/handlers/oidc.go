@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/oidc"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// errOIDCLoginRejected is returned when a verified provider identity may not
+// log in; the message is safe to show to the user
+type errOIDCLoginRejected struct {
+	code    string
+	message string
+}
+
+func (e *errOIDCLoginRejected) Error() string {
+	return e.message
+}
+
+// OIDCHandler handles login through the OpenID Connect providers of schools
+type OIDCHandler struct {
+	authHandler    *AuthHandler
+	userRepo       repository.UserRepository
+	profileRepo    repository.ProfileRepository
+	roleChangeRepo repository.RoleChangeRepository
+	securityRepo   repository.SecurityEventRepository
+	identityRepo   repository.UserIdentityRepository
+	stateRepo      repository.OIDCLoginStateRepository
+	providers      *oidc.Registry
+	cfg            *config.Config
+	logger         *log.Logger
+}
+
+// NewOIDCHandler creates a new OpenID Connect handler. Logins that pass the
+// provider check are completed by authHandler, including two-factor
+// authentication.
+func NewOIDCHandler(
+	authHandler *AuthHandler,
+	userRepo repository.UserRepository,
+	profileRepo repository.ProfileRepository,
+	roleChangeRepo repository.RoleChangeRepository,
+	securityRepo repository.SecurityEventRepository,
+	identityRepo repository.UserIdentityRepository,
+	stateRepo repository.OIDCLoginStateRepository,
+	providers *oidc.Registry,
+	cfg *config.Config,
+	logger *log.Logger,
+) *OIDCHandler {
+	return &OIDCHandler{
+		authHandler:    authHandler,
+		userRepo:       userRepo,
+		profileRepo:    profileRepo,
+		roleChangeRepo: roleChangeRepo,
+		securityRepo:   securityRepo,
+		identityRepo:   identityRepo,
+		stateRepo:      stateRepo,
+		providers:      providers,
+		cfg:            cfg,
+		logger:         logger,
+	}
+}
+
+type oidcProviderResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// oidcAuthorizeResponse holds the provider URL to send the user to. The app
+// keeps State and checks that the provider sends the same value back.
+type oidcAuthorizeResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// ListProviders returns the identity providers users can log in with
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, _ *http.Request) {
+	clients := h.providers.List()
+	response := make([]oidcProviderResponse, len(clients))
+	for i, client := range clients {
+		response[i] = oidcProviderResponse{ID: client.Config.ID, Name: client.Config.Name}
+	}
+	writeJSON(w, response, http.StatusOK)
+}
+
+// Authorize starts a login with a provider. The state, nonce and PKCE code
+// verifier are kept server-side until the callback.
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	client, err := h.providers.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		writeError(w, "not_found", "Identity provider not found", http.StatusNotFound)
+		return
+	}
+
+	state, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate OIDC state")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate OIDC nonce")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate PKCE verifier")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	authorizationURL, err := client.AuthorizationURL(ctx, state, nonce, verifier)
+	if err != nil {
+		h.logger.WithError(err).WithField("provider", client.Config.ID).Error("Failed to reach identity provider")
+		writeError(w, "provider_unavailable", "The identity provider is not available", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	loginState := &domain.OIDCLoginState{
+		ID:           uuid.New(),
+		Provider:     client.Config.ID,
+		StateHash:    auth.HashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(h.cfg.OIDC.StateExpiry),
+		CreatedAt:    now,
+	}
+	if err := h.stateRepo.Create(ctx, loginState); err != nil {
+		h.logger.WithError(err).Error("Failed to store OIDC login state")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, oidcAuthorizeResponse{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+		ExpiresAt:        loginState.ExpiresAt,
+	}, http.StatusOK)
+}
+
+// Callback completes a login with the code and state the provider sent the
+// user back with
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	client, err := h.providers.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		writeError(w, "not_found", "Identity provider not found", http.StatusNotFound)
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" || req.State == "" {
+		writeError(w, "validation_error", "Code and state are required", http.StatusBadRequest)
+		return
+	}
+
+	// The state is used up even if the rest of the login fails, so a code can
+	// only ever be tried once
+	loginState, err := h.stateRepo.Consume(ctx, auth.HashToken(req.State), time.Now())
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).Error("Failed to load OIDC login state")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || loginState.Provider != client.Config.ID {
+		writeError(w, "invalid_state", "Invalid or expired login, please start again", http.StatusBadRequest)
+		return
+	}
+
+	logger := h.logger.WithField("provider", client.Config.ID).WithField("request_id", requestID(r))
+
+	identity, err := client.Exchange(ctx, req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if errors.Is(err, oidc.ErrExchangeFailed) || errors.Is(err, oidc.ErrInvalidIDToken) {
+		logger.WithError(err).Warn("OIDC login rejected")
+		writeError(w, "invalid_credentials", "The identity provider login could not be verified", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to reach identity provider")
+		writeError(w, "provider_unavailable", "The identity provider is not available", http.StatusBadGateway)
+		return
+	}
+
+	user, err := h.resolveUser(r, client.Config, identity)
+	var rejected *errOIDCLoginRejected
+	if errors.As(err, &rejected) {
+		logger.WithField("subject", identity.Subject).WithField("reason", rejected.code).Warn("OIDC login refused")
+		writeError(w, rejected.code, rejected.message, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to resolve OIDC user")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	h.authHandler.completeLogin(w, r, user, http.StatusOK)
+}
+
+// resolveUser finds the user for a provider identity. An identity that is not
+// linked yet is linked to the account with the same verified email address,
+// or a new account is created for it.
+func (h *OIDCHandler) resolveUser(r *http.Request, provider oidc.ProviderConfig, identity *oidc.Identity) (*domain.User, error) {
+	ctx := r.Context()
+	now := time.Now()
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, &errOIDCLoginRejected{code: "email_not_verified", message: "The identity provider did not confirm your email address"}
+	}
+	if !provider.AllowsEmail(identity.Email) {
+		return nil, &errOIDCLoginRejected{code: "email_not_allowed", message: "This email address cannot log in with this identity provider"}
+	}
+	mappedRole, mapped := provider.MappedRole(identity.Groups)
+
+	linked, err := h.identityRepo.GetByProviderSubject(ctx, provider.ID, identity.Subject)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	var user *domain.User
+	switch {
+	case linked != nil:
+		user, err = h.userRepo.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.identityRepo.RecordLogin(ctx, linked.ID, identity.Email, now); err != nil {
+			h.logger.WithError(err).Warn("Failed to record OIDC login")
+		}
+
+	default:
+		user, err = h.userRepo.GetByEmail(ctx, identity.Email)
+		if errors.Is(err, domain.ErrNotFound) {
+			role := provider.DefaultRole
+			if mapped {
+				role = mappedRole
+			}
+			if role == "" {
+				return nil, &errOIDCLoginRejected{code: "signup_not_allowed", message: "Your account is not in a group that may use this app"}
+			}
+			return h.createUser(ctx, provider, identity, role)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Only accounts within the provider's domains are linked to it
+		if !provider.AllowsEmail(user.Email) {
+			return nil, &errOIDCLoginRejected{code: "email_not_allowed", message: "This email address cannot log in with this identity provider"}
+		}
+		if err := h.link(ctx, provider, identity, user.ID); err != nil {
+			return nil, err
+		}
+		recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventIdentityLinked, map[string]string{
+			"provider": provider.ID,
+		}))
+	}
+
+	// The provider has confirmed the email address
+	if !user.IsVerified() {
+		if err := h.userRepo.MarkVerified(ctx, user.ID, now); err != nil {
+			return nil, err
+		}
+		user.VerifiedAt = &now
+	}
+
+	// Only mapped groups change the role of an existing account; the default
+	// role never demotes anyone
+	if mapped && mappedRole != user.Role {
+		h.syncRole(ctx, provider, user, mappedRole)
+	}
+	return user, nil
+}
+
+// createUser signs up a new user from a provider identity. The account has
+// no password; the user can set one through a password reset.
+func (h *OIDCHandler) createUser(ctx context.Context, provider oidc.ProviderConfig, identity *oidc.Identity, role domain.Role) (*domain.User, error) {
+	now := time.Now()
+	user := &domain.User{
+		ID:         uuid.New(),
+		Email:      identity.Email,
+		Role:       role,
+		VerifiedAt: &now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := h.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := h.link(ctx, provider, identity, user.ID); err != nil {
+		return nil, err
+	}
+
+	displayName := strings.TrimSpace(identity.Name)
+	if displayName == "" {
+		displayName, _, _ = strings.Cut(identity.Email, "@")
+	}
+	profile := &domain.Profile{
+		UserID:      user.ID,
+		DisplayName: displayName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.profileRepo.Create(ctx, profile); err != nil {
+		h.logger.WithError(err).Error("Failed to create profile")
+		// Don't fail the login if profile creation fails
+	}
+
+	return user, nil
+}
+
+func (h *OIDCHandler) link(ctx context.Context, provider oidc.ProviderConfig, identity *oidc.Identity, userID uuid.UUID) error {
+	now := time.Now()
+	return h.identityRepo.Create(ctx, &domain.UserIdentity{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Provider:    provider.ID,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	})
+}
+
+// syncRole applies the role mapped from the user's provider groups. Failures
+// keep the current role and do not block the login.
+func (h *OIDCHandler) syncRole(ctx context.Context, provider oidc.ProviderConfig, user *domain.User, role domain.Role) {
+	change := &domain.RoleChange{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		OldRole:   user.Role,
+		NewRole:   role,
+		Reason:    "identity provider groups (" + provider.ID + ")",
+		CreatedAt: time.Now(),
+	}
+	if err := h.roleChangeRepo.Apply(ctx, change); err != nil {
+		h.logger.WithError(err).WithField("user_id", user.ID.String()).Warn("Failed to apply mapped role")
+		return
+	}
+
+	user.Role = role
+	user.UpdatedAt = change.CreatedAt
+}
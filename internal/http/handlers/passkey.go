@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/webauthn"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// maxPasskeyNameLength matches the name column of webauthn_credentials
+const maxPasskeyNameLength = 100
+
+// PasskeyHandler handles WebAuthn passkey registration for the current user
+// and passkey login
+type PasskeyHandler struct {
+	authHandler    *AuthHandler
+	userRepo       repository.UserRepository
+	profileRepo    repository.ProfileRepository
+	credentialRepo repository.WebAuthnCredentialRepository
+	challengeRepo  repository.WebAuthnChallengeRepository
+	securityRepo   repository.SecurityEventRepository
+	rp             *webauthn.RelyingParty
+	cfg            *config.Config
+	logger         *log.Logger
+}
+
+// NewPasskeyHandler creates a new passkey handler. Logins are completed by
+// authHandler.
+func NewPasskeyHandler(
+	authHandler *AuthHandler,
+	userRepo repository.UserRepository,
+	profileRepo repository.ProfileRepository,
+	credentialRepo repository.WebAuthnCredentialRepository,
+	challengeRepo repository.WebAuthnChallengeRepository,
+	securityRepo repository.SecurityEventRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *PasskeyHandler {
+	return &PasskeyHandler{
+		authHandler:    authHandler,
+		userRepo:       userRepo,
+		profileRepo:    profileRepo,
+		credentialRepo: credentialRepo,
+		challengeRepo:  challengeRepo,
+		securityRepo:   securityRepo,
+		rp: &webauthn.RelyingParty{
+			ID:      cfg.WebAuthn.RPID,
+			Name:    cfg.WebAuthn.RPName,
+			Origins: cfg.WebAuthn.Origins,
+		},
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// passkeyRegistrationRequest carries the authenticator response to
+// navigator.credentials.create, with binary values base64url encoded
+type passkeyRegistrationRequest struct {
+	Name              string `json:"name"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+// passkeyLoginRequest carries the authenticator response to
+// navigator.credentials.get, with binary values base64url encoded
+type passkeyLoginRequest struct {
+	CredentialID      string `json:"credential_id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+}
+
+// RegistrationOptions starts adding a passkey and returns the options for
+// navigator.credentials.create
+func (h *PasskeyHandler) RegistrationOptions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	credentials, err := h.credentialRepo.ListByUser(ctx, userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list passkeys")
+		writeError(w, "internal_error", "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+	exclude := make([][]byte, len(credentials))
+	for i, credential := range credentials {
+		exclude[i] = credential.CredentialID
+	}
+
+	displayName := user.Email
+	if profile, err := h.profileRepo.GetByUserID(ctx, userID); err == nil && profile.DisplayName != "" {
+		displayName = profile.DisplayName
+	}
+
+	challenge, err := h.newChallenge(ctx, &userID, domain.WebAuthnCeremonyRegistration)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create WebAuthn challenge")
+		writeError(w, "internal_error", "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+
+	// The user handle is the user ID, which identifies the account without
+	// revealing the email address to the authenticator's storage
+	options := h.rp.CreationOptions(challenge, userID[:], user.Email, displayName, exclude, h.cfg.WebAuthn.ChallengeExpiry)
+	writeJSON(w, options, http.StatusOK)
+}
+
+// Register verifies the authenticator response and stores the new passkey
+func (h *PasskeyHandler) Register(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req passkeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxPasskeyNameLength {
+		writeError(w, "invalid_input", "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	clientDataJSON, errClientData := decodeBase64URL(req.ClientDataJSON)
+	attestationObject, errAttestation := decodeBase64URL(req.AttestationObject)
+	if errClientData != nil || errAttestation != nil {
+		writeError(w, "invalid_input", "client_data_json and attestation_object must be base64url encoded", http.StatusBadRequest)
+		return
+	}
+
+	challenge, ok := h.consumeChallenge(ctx, clientDataJSON, domain.WebAuthnCeremonyRegistration)
+	if !ok || challenge.UserID == nil || *challenge.UserID != userID {
+		writeError(w, "invalid_passkey", "Invalid or expired passkey registration", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := h.rp.VerifyRegistration(clientDataJSON, attestationObject, challenge.raw)
+	if err != nil {
+		h.logger.WithError(err).WithField("user_id", userID.String()).Warn("Passkey registration rejected")
+		writeError(w, "invalid_passkey", "Invalid or expired passkey registration", http.StatusBadRequest)
+		return
+	}
+
+	passkey := &domain.WebAuthnCredential{
+		ID:           uuid.New(),
+		UserID:       userID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		AAGUID:       credential.AAGUID,
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+	if err := h.credentialRepo.Create(ctx, passkey); err != nil {
+		if errors.Is(err, domain.ErrAlreadyExists) {
+			writeError(w, "already_registered", "This passkey is already registered", http.StatusConflict)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to store passkey")
+		writeError(w, "internal_error", "Failed to register passkey", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, userID, domain.SecurityEventPasskeyAdded, map[string]string{
+		"passkey_id": passkey.ID.String(),
+		"name":       passkey.Name,
+	}))
+
+	writeJSON(w, passkey, http.StatusCreated)
+}
+
+// List returns the current user's passkeys
+func (h *PasskeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	credentials, err := h.credentialRepo.ListByUser(ctx, userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list passkeys")
+		writeError(w, "internal_error", "Failed to list passkeys", http.StatusInternalServerError)
+		return
+	}
+	if credentials == nil {
+		credentials = []*domain.WebAuthnCredential{}
+	}
+
+	writeJSON(w, credentials, http.StatusOK)
+}
+
+// Delete removes one of the current user's passkeys
+func (h *PasskeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid passkey ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.credentialRepo.Delete(ctx, userID, id); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "not_found", "Passkey not found", http.StatusNotFound)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete passkey")
+		writeError(w, "internal_error", "Failed to delete passkey", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, userID, domain.SecurityEventPasskeyRemoved, map[string]string{
+		"passkey_id": id.String(),
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginOptions starts a passkey login and returns the options for
+// navigator.credentials.get. Passkeys are discoverable, so no email is needed
+// and the response does not reveal whether an account exists.
+func (h *PasskeyHandler) LoginOptions(w http.ResponseWriter, r *http.Request) {
+	challenge, err := h.newChallenge(r.Context(), nil, domain.WebAuthnCeremonyLogin)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create WebAuthn challenge")
+		writeError(w, "internal_error", "Failed to start passkey login", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.rp.RequestOptions(challenge, nil, h.cfg.WebAuthn.ChallengeExpiry), http.StatusOK)
+}
+
+// Login verifies a passkey assertion and starts a session. Passkeys always
+// require user verification, so they count as both factors and the login
+// never asks for a TOTP code.
+func (h *PasskeyHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req passkeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	credentialID, errID := decodeBase64URL(req.CredentialID)
+	clientDataJSON, errClientData := decodeBase64URL(req.ClientDataJSON)
+	authenticatorData, errAuthData := decodeBase64URL(req.AuthenticatorData)
+	signature, errSignature := decodeBase64URL(req.Signature)
+	if errors.Join(errID, errClientData, errAuthData, errSignature) != nil || len(credentialID) == 0 {
+		writeError(w, "invalid_input", "credential_id, client_data_json, authenticator_data and signature must be base64url encoded", http.StatusBadRequest)
+		return
+	}
+
+	challenge, ok := h.consumeChallenge(ctx, clientDataJSON, domain.WebAuthnCeremonyLogin)
+	if !ok {
+		writeError(w, "invalid_passkey", "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	passkey, err := h.credentialRepo.GetByCredentialID(ctx, credentialID)
+	if err != nil {
+		writeError(w, "invalid_passkey", "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	signCount, err := h.rp.VerifyAssertion(&webauthn.Credential{
+		ID:        passkey.CredentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: passkey.SignCount,
+	}, clientDataJSON, authenticatorData, signature, challenge.raw)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			h.logger.WithFields(map[string]interface{}{
+				"user_id":    passkey.UserID.String(),
+				"passkey_id": passkey.ID.String(),
+			}).Warn("Passkey signature counter went backwards, possible cloned authenticator")
+			recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, passkey.UserID, domain.SecurityEventPasskeyCloneDetected, map[string]string{
+				"passkey_id": passkey.ID.String(),
+			}))
+		}
+		writeError(w, "invalid_passkey", "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	// A concurrent login with the same counter lost the race; its assertion
+	// may be a replay from a cloned authenticator
+	if err := h.credentialRepo.UpdateSignCount(ctx, passkey.ID, passkey.SignCount, signCount, time.Now()); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "invalid_passkey", "Invalid passkey", http.StatusUnauthorized)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to update passkey signature counter")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, passkey.UserID)
+	if err != nil {
+		writeError(w, "invalid_passkey", "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	response, err := h.authHandler.startSession(r, user)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to start session")
+		writeError(w, "internal_error", "Failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, response, http.StatusOK)
+}
+
+// pendingChallenge is a consumed challenge with the raw value it was issued as
+type pendingChallenge struct {
+	*domain.WebAuthnChallenge
+	raw []byte
+}
+
+// newChallenge generates and stores a challenge for a ceremony
+func (h *PasskeyHandler) newChallenge(ctx context.Context, userID *uuid.UUID, ceremony domain.WebAuthnCeremony) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = h.challengeRepo.Create(ctx, &domain.WebAuthnChallenge{
+		ID:            uuid.New(),
+		UserID:        userID,
+		Ceremony:      ceremony,
+		ChallengeHash: hashWebAuthnChallenge(challenge),
+		ExpiresAt:     now.Add(h.cfg.WebAuthn.ChallengeExpiry),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeChallenge claims the stored challenge the client data was signed
+// for, so every challenge is answered at most once. The response itself is
+// verified afterwards.
+func (h *PasskeyHandler) consumeChallenge(ctx context.Context, clientDataJSON []byte, ceremony domain.WebAuthnCeremony) (*pendingChallenge, bool) {
+	raw, err := webauthn.ChallengeFromClientData(clientDataJSON)
+	if err != nil {
+		return nil, false
+	}
+
+	challenge, err := h.challengeRepo.Consume(ctx, hashWebAuthnChallenge(raw), ceremony, time.Now())
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			h.logger.WithError(err).Error("Failed to consume WebAuthn challenge")
+		}
+		return nil, false
+	}
+	return &pendingChallenge{WebAuthnChallenge: challenge, raw: raw}, true
+}
+
+func hashWebAuthnChallenge(challenge []byte) string {
+	return auth.HashToken(base64.RawURLEncoding.EncodeToString(challenge))
+}
+
+// decodeBase64URL decodes base64url with or without padding, as browsers
+// and WebAuthn libraries differ
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/mail"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// PasswordHandler handles the forgot and reset password endpoints
+type PasswordHandler struct {
+	userRepo       repository.UserRepository
+	profileRepo    repository.ProfileRepository
+	userTokenRepo  repository.UserTokenRepository
+	tokenRepo      repository.RefreshTokenRepository
+	sessionRepo    repository.SessionRepository
+	securityRepo   repository.SecurityEventRepository
+	mailer         mail.Mailer
+	passwordPolicy *auth.PasswordPolicy
+	cfg            *config.Config
+	logger         *log.Logger
+}
+
+// NewPasswordHandler creates a new password handler
+func NewPasswordHandler(
+	userRepo repository.UserRepository,
+	profileRepo repository.ProfileRepository,
+	userTokenRepo repository.UserTokenRepository,
+	tokenRepo repository.RefreshTokenRepository,
+	sessionRepo repository.SessionRepository,
+	securityRepo repository.SecurityEventRepository,
+	mailer mail.Mailer,
+	passwordPolicy *auth.PasswordPolicy,
+	cfg *config.Config,
+	logger *log.Logger,
+) *PasswordHandler {
+	return &PasswordHandler{
+		userRepo:       userRepo,
+		profileRepo:    profileRepo,
+		userTokenRepo:  userTokenRepo,
+		tokenRepo:      tokenRepo,
+		sessionRepo:    sessionRepo,
+		securityRepo:   securityRepo,
+		mailer:         mailer,
+		passwordPolicy: passwordPolicy,
+		cfg:            cfg,
+		logger:         logger,
+	}
+}
+
+// passwordParams returns the configured argon2id parameters for new hashes
+func passwordParams(cfg *config.Config) auth.Argon2Params {
+	return auth.Argon2Params{
+		Memory:  uint32(cfg.Password.Argon2Memory), //nolint:gosec // validated by config.Validate
+		Time:    uint32(cfg.Password.Argon2Time),   //nolint:gosec // validated by config.Validate
+		Threads: uint8(cfg.Password.Argon2Threads), //nolint:gosec // validated by config.Validate
+	}
+}
+
+// checkPasswordPolicy checks a new password against the policy. If it fails,
+// it writes a weak_password error listing the failed rules and returns false.
+func checkPasswordPolicy(
+	w http.ResponseWriter, policy *auth.PasswordPolicy, logger *log.Logger, password string, personalInfo ...string,
+) bool {
+	failed, err := policy.Check(password, personalInfo...)
+	if err != nil {
+		// An unreadable breached password list must not block sign-ups
+		logger.WithError(err).Warn("Failed to check breached passwords")
+	}
+	if len(failed) == 0 {
+		return true
+	}
+
+	writeErrorDetails(w, "weak_password", "Password does not meet the password policy", map[string]interface{}{
+		"failed_rules": failed,
+	}, http.StatusBadRequest)
+	return false
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Forgot emails a password reset link to the given address. The response is
+// the same whether or not an account exists, and the lookup and delivery run
+// after the response is sent so its timing does not reveal it either.
+func (h *PasswordHandler) Forgot(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		writeError(w, "invalid_input", "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	sendInBackground(r, func(ctx context.Context) {
+		h.sendResetLink(ctx, email)
+	})
+
+	writeJSON(w, map[string]string{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	}, http.StatusAccepted)
+}
+
+// sendResetLink issues a new reset token for the account, if any, and emails it
+func (h *PasswordHandler) sendResetLink(ctx context.Context, email string) {
+	user, err := h.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			h.logger.WithError(err).Error("Failed to look up user for password reset")
+		}
+		return
+	}
+
+	token, err := issueUserToken(ctx, h.userTokenRepo, user.ID, domain.UserTokenPasswordReset, h.cfg.Auth.PasswordResetExpiry)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to issue password reset token")
+		return
+	}
+
+	link := h.cfg.Mail.AppBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your TinySchoolHub password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your TinySchoolHub account.\n\n"+
+			"Open this link to choose a new password:\n%s\n\n"+
+			"The link expires in %s and can only be used once. "+
+			"If you did not ask for this, you can ignore this email.\n", link, h.cfg.Auth.PasswordResetExpiry),
+	}
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		h.logger.WithError(err).WithField("user_id", user.ID.String()).Error("Failed to send password reset email")
+	}
+}
+
+// Reset sets a new password using a token from a reset email. Every session
+// of the user is revoked, so all devices have to log in again.
+func (h *PasswordHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		writeError(w, "invalid_input", "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.userTokenRepo.GetByTokenHash(ctx, domain.UserTokenPasswordReset, auth.HashToken(req.Token))
+	if err != nil || !token.IsValid(time.Now()) {
+		writeError(w, "invalid_token", "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		writeError(w, "invalid_token", "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	personalInfo := []string{user.Email}
+	if profile, err := h.profileRepo.GetByUserID(ctx, user.ID); err == nil {
+		personalInfo = append(personalInfo, profile.DisplayName)
+	}
+	if !checkPasswordPolicy(w, h.passwordPolicy, h.logger, req.Password, personalInfo...) {
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password, passwordParams(h.cfg))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to hash password")
+		writeError(w, "internal_error", "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	// Claiming the token first makes it single-use even under concurrent requests
+	now := time.Now()
+	if err := h.userTokenRepo.MarkUsed(ctx, token.ID, now); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "invalid_token", "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to use password reset token")
+		writeError(w, "internal_error", "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	user.PasswordHash = passwordHash
+	user.UpdatedAt = now
+	if err := h.userRepo.Update(ctx, user); err != nil {
+		h.logger.WithError(err).Error("Failed to update password")
+		writeError(w, "internal_error", "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	// The reset link was delivered to the user's inbox, which proves they own it
+	if !user.IsVerified() {
+		if err := h.userRepo.MarkVerified(ctx, user.ID, now); err != nil {
+			h.logger.WithError(err).Warn("Failed to mark user verified after password reset")
+		}
+	}
+
+	if err := h.tokenRepo.RevokeAllForUser(ctx, user.ID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke refresh tokens after password reset")
+	}
+	if err := h.sessionRepo.RevokeAllForUser(ctx, user.ID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke sessions after password reset")
+	}
+
+	recordSecurityEvent(ctx, h.securityRepo, h.logger, newSecurityEvent(r, user.ID, domain.SecurityEventPasswordReset, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
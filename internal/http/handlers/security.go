@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// newSecurityEvent builds an event for userID carrying the client address and
+// user agent of r
+func newSecurityEvent(r *http.Request, userID uuid.UUID, eventType domain.SecurityEventType, details map[string]string) *domain.SecurityEvent {
+	return &domain.SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Type:      eventType,
+		IPAddress: clientIP(r),
+		UserAgent: userAgent(r),
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+}
+
+// recordSecurityEvent logs the event and stores it for auditing. A failure to
+// store the event never fails the request that triggered it.
+func recordSecurityEvent(ctx context.Context, repo repository.SecurityEventRepository, logger *log.Logger, event *domain.SecurityEvent) {
+	fields := map[string]interface{}{
+		"user_id":    event.UserID.String(),
+		"event_type": string(event.Type),
+		"ip_address": event.IPAddress,
+	}
+	for key, value := range event.Details {
+		fields[key] = value
+	}
+	logger.WithFields(fields).Warn("Security event")
+
+	if err := repo.Create(ctx, event); err != nil {
+		logger.WithError(err).WithField("event_type", string(event.Type)).Error("Failed to store security event")
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// SessionHandler lets users see and revoke the devices they are logged in on
+type SessionHandler struct {
+	sessionRepo repository.SessionRepository
+	tokenRepo   repository.RefreshTokenRepository
+	cfg         *config.Config
+	logger      *log.Logger
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(
+	sessionRepo repository.SessionRepository,
+	tokenRepo repository.RefreshTokenRepository,
+	cfg *config.Config,
+	logger *log.Logger,
+) *SessionHandler {
+	return &SessionHandler{
+		sessionRepo: sessionRepo,
+		tokenRepo:   tokenRepo,
+		cfg:         cfg,
+		logger:      logger,
+	}
+}
+
+type sessionResponse struct {
+	*domain.Session
+	// Current marks the session the request was made from
+	Current bool `json:"current"`
+}
+
+// List returns the current user's active sessions, most recently used first
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.sessionRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list sessions")
+		writeError(w, "internal_error", "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	currentID, _ := middleware.GetSessionID(ctx)
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{
+			Session: session,
+			Current: session.ID == currentID,
+		}
+	}
+
+	writeJSON(w, response, http.StatusOK)
+}
+
+// Revoke logs one of the current user's sessions out. Access tokens already
+// issued to it stay valid until they expire.
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid_request", "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		writeError(w, "not_found", "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeSession(ctx, h.sessionRepo, h.tokenRepo, session.ID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "not_found", "Session not found", http.StatusNotFound)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke session")
+		writeError(w, "internal_error", "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithFields(map[string]interface{}{
+		"user_id":    userID.String(),
+		"session_id": session.ID.String(),
+	}).Info("Session revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAll logs the current user out on every device, including this one
+func (h *SessionHandler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	if err := h.tokenRepo.RevokeAllForUser(ctx, userID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke refresh tokens")
+		writeError(w, "internal_error", "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.sessionRepo.RevokeAllForUser(ctx, userID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to revoke sessions")
+		writeError(w, "internal_error", "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithField("user_id", userID.String()).Info("All sessions revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSession revokes every refresh token of a session and then the session
+// itself. It returns domain.ErrNotFound if the session was already revoked.
+func revokeSession(ctx context.Context, sessionRepo repository.SessionRepository, tokenRepo repository.RefreshTokenRepository, sessionID uuid.UUID) error {
+	now := time.Now()
+	if err := tokenRepo.RevokeFamily(ctx, sessionID, now); err != nil {
+		return err
+	}
+	return sessionRepo.Revoke(ctx, sessionID, now)
+}
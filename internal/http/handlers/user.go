@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/storage"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/worker"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const maxDisplayNameLength = 255
+
+// UserHandler handles endpoints for the authenticated user's own account
+type UserHandler struct {
+	userRepo    repository.UserRepository
+	profileRepo repository.ProfileRepository
+	memberRepo  repository.ClassMemberRepository
+	storage     *storage.Client
+	cleaner     *worker.StorageCleaner
+	cfg         *config.Config
+	logger      *log.Logger
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(
+	userRepo repository.UserRepository,
+	profileRepo repository.ProfileRepository,
+	memberRepo repository.ClassMemberRepository,
+	storage *storage.Client,
+	cleaner *worker.StorageCleaner,
+	cfg *config.Config,
+	logger *log.Logger,
+) *UserHandler {
+	return &UserHandler{
+		userRepo:    userRepo,
+		profileRepo: profileRepo,
+		memberRepo:  memberRepo,
+		storage:     storage,
+		cleaner:     cleaner,
+		cfg:         cfg,
+		logger:      logger,
+	}
+}
+
+type meResponse struct {
+	*domain.User
+	DisplayName string     `json:"display_name"`
+	AvatarURL   *string    `json:"avatar_url,omitempty"`
+	ChildName   *string    `json:"child_name,omitempty"`
+	ClassID     *uuid.UUID `json:"class_id,omitempty"`
+}
+
+// updateMeRequest uses pointers so omitted fields are left untouched. An empty
+// string clears child_name, class_id and avatar_key.
+type updateMeRequest struct {
+	DisplayName *string `json:"display_name"`
+	ChildName   *string `json:"child_name"`
+	ClassID     *string `json:"class_id"`
+	AvatarKey   *string `json:"avatar_key"`
+}
+
+type avatarUploadRequest struct {
+	ContentType string `json:"content_type"`
+	FileSize    int    `json:"file_size"`
+}
+
+type avatarUploadResponse struct {
+	UploadURL string `json:"upload_url"`
+	AvatarKey string `json:"avatar_key"`
+}
+
+// GetMe returns the current user together with their profile
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	profile, err := h.profileRepo.GetByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		h.logger.WithError(err).Error("Failed to get profile")
+		writeError(w, "internal_error", "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.buildMeResponse(r, user, profile), http.StatusOK)
+}
+
+// UpdateMe updates the current user's profile
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	var req updateMeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.profileRepo.GetByUserID(ctx, userID)
+	isNew := errors.Is(err, domain.ErrNotFound)
+	if err != nil && !isNew {
+		h.logger.WithError(err).Error("Failed to get profile")
+		writeError(w, "internal_error", "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+	if isNew {
+		profile = &domain.Profile{
+			UserID:    userID,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	oldAvatarKey := profile.AvatarURL
+	if !h.applyProfileUpdate(w, r, userID, profile, &req) {
+		return
+	}
+
+	profile.UpdatedAt = time.Now()
+	if isNew {
+		err = h.profileRepo.Create(ctx, profile)
+	} else {
+		err = h.profileRepo.Update(ctx, profile)
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to save profile")
+		if avatarChanged(oldAvatarKey, profile.AvatarURL) && profile.AvatarURL != nil {
+			// The upload was claimed before saving; hand it back to the sweep
+			h.scheduleAvatarSweep(context.WithoutCancel(ctx), *profile.AvatarURL)
+		}
+		writeError(w, "internal_error", "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	if avatarChanged(oldAvatarKey, profile.AvatarURL) && oldAvatarKey != nil {
+		h.removeAvatar(context.WithoutCancel(ctx), *oldAvatarKey)
+	}
+
+	writeJSON(w, h.buildMeResponse(r, user, profile), http.StatusOK)
+}
+
+// applyProfileUpdate validates the request and copies it onto profile. It
+// writes the error response itself and returns false on invalid input.
+func (h *UserHandler) applyProfileUpdate(
+	w http.ResponseWriter, r *http.Request, userID uuid.UUID, profile *domain.Profile, req *updateMeRequest,
+) bool {
+	ctx := r.Context()
+
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if displayName == "" || len(displayName) > maxDisplayNameLength {
+			writeError(w, "invalid_input", "display_name must be between 1 and 255 characters", http.StatusBadRequest)
+			return false
+		}
+		profile.DisplayName = displayName
+	}
+
+	if req.ChildName != nil {
+		profile.ChildName = nil
+		if childName := strings.TrimSpace(*req.ChildName); childName != "" {
+			profile.ChildName = &childName
+		}
+	}
+
+	if req.ClassID != nil {
+		profile.ClassID = nil
+		if *req.ClassID != "" {
+			classID, err := uuid.Parse(*req.ClassID)
+			if err != nil {
+				writeError(w, "invalid_input", "Invalid class ID", http.StatusBadRequest)
+				return false
+			}
+			isMember, err := h.memberRepo.IsMember(ctx, userID, classID)
+			if err != nil || !isMember {
+				writeError(w, "forbidden", "Not a member of this class", http.StatusForbidden)
+				return false
+			}
+			profile.ClassID = &classID
+		}
+	}
+
+	if strings.TrimSpace(profile.DisplayName) == "" {
+		writeError(w, "invalid_input", "display_name is required", http.StatusBadRequest)
+		return false
+	}
+
+	// Claiming the avatar upload comes last, so no validation can fail after it
+	if req.AvatarKey != nil && avatarChanged(profile.AvatarURL, req.AvatarKey) {
+		profile.AvatarURL = nil
+		if *req.AvatarKey != "" {
+			if !h.claimAvatarUpload(w, r, userID, *req.AvatarKey) {
+				return false
+			}
+			avatarKey := *req.AvatarKey
+			profile.AvatarURL = &avatarKey
+		}
+	}
+
+	return true
+}
+
+// claimAvatarUpload checks that key is a completed avatar upload of the user
+// within the upload limits and cancels its scheduled sweep. It writes the error
+// response itself and returns false if the upload cannot be used.
+func (h *UserHandler) claimAvatarUpload(w http.ResponseWriter, r *http.Request, userID uuid.UUID, key string) bool {
+	ctx := r.Context()
+
+	if !strings.HasPrefix(key, avatarKeyPrefix(userID)) {
+		writeError(w, "invalid_input", "Invalid avatar key", http.StatusBadRequest)
+		return false
+	}
+
+	info, err := h.storage.StatObject(ctx, key)
+	if errors.Is(err, domain.ErrNotFound) {
+		writeError(w, "invalid_input", "Avatar has not been uploaded yet", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check avatar upload")
+		writeError(w, "internal_error", "Failed to update profile", http.StatusInternalServerError)
+		return false
+	}
+
+	if !avatarUploadValid(info) {
+		h.removeAvatar(context.WithoutCancel(ctx), key)
+		writeError(w, "upload_mismatch", "Uploaded avatar must be a JPEG, PNG or WebP image of at most 5MB", http.StatusUnprocessableEntity)
+		return false
+	}
+
+	// Once cancelled the upload is no longer swept, so this has to succeed
+	// before the avatar is set
+	err = h.cleaner.Cancel(ctx, key)
+	if errors.Is(err, domain.ErrNotFound) {
+		writeError(w, "invalid_input", "Avatar upload has expired", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to claim avatar upload")
+		writeError(w, "internal_error", "Failed to update profile", http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// avatarUploadValid reports whether an uploaded avatar is within the same
+// limits that are checked before issuing the upload URL
+func avatarUploadValid(info *storage.ObjectInfo) bool {
+	if info.Size <= 0 || info.Size > storage.MaxFileSize {
+		return false
+	}
+	contentType, _, err := mime.ParseMediaType(info.ContentType)
+	return err == nil && storage.ValidateContentType(contentType) == nil
+}
+
+// scheduleAvatarSweep schedules the deletion of an unclaimed avatar upload
+func (h *UserHandler) scheduleAvatarSweep(ctx context.Context, key string) {
+	if err := h.cleaner.Schedule(ctx, []string{key}, time.Now().Add(h.cfg.Photos.PendingTTL)); err != nil {
+		h.logger.WithError(err).WithField("object_key", key).Error("Failed to schedule avatar upload sweep")
+	}
+}
+
+// removeAvatar deletes an avatar that is no longer used. Deletions that fail
+// are retried by the storage cleaner.
+func (h *UserHandler) removeAvatar(ctx context.Context, key string) {
+	if err := h.cleaner.Remove(ctx, []string{key}); err != nil {
+		h.logger.WithError(err).WithField("object_key", key).Error("Failed to record avatar deletion")
+	}
+}
+
+// CreateAvatarUpload returns a presigned URL for uploading a new avatar. The
+// returned key is then set on the profile through PATCH /v1/me.
+func (h *UserHandler) CreateAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req avatarUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := storage.ValidateContentType(req.ContentType); err != nil {
+		writeError(w, "invalid_file_type", "Invalid file type", http.StatusBadRequest)
+		return
+	}
+
+	if err := storage.ValidateFileSize(req.FileSize); err != nil {
+		writeError(w, "file_too_large", "File too large (max 5MB)", http.StatusBadRequest)
+		return
+	}
+
+	avatarKey := avatarKeyPrefix(userID) + uuid.New().String()
+
+	// The upload is swept unless it is set on the profile before the TTL
+	if err := h.cleaner.Schedule(ctx, []string{avatarKey}, time.Now().Add(h.cfg.Photos.PendingTTL)); err != nil {
+		h.logger.WithError(err).Error("Failed to schedule avatar upload sweep")
+		writeError(w, "internal_error", "Failed to generate upload URL", http.StatusInternalServerError)
+		return
+	}
+
+	uploadURL, err := h.storage.GeneratePresignedPutURL(ctx, avatarKey, req.ContentType)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate presigned URL")
+		writeError(w, "internal_error", "Failed to generate upload URL", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, avatarUploadResponse{
+		UploadURL: uploadURL,
+		AvatarKey: avatarKey,
+	}, http.StatusCreated)
+}
+
+func (h *UserHandler) buildMeResponse(r *http.Request, user *domain.User, profile *domain.Profile) meResponse {
+	response := meResponse{User: user}
+	if profile == nil {
+		return response
+	}
+
+	response.DisplayName = profile.DisplayName
+	response.ChildName = profile.ChildName
+	response.ClassID = profile.ClassID
+
+	if profile.AvatarURL != nil {
+		viewURL, err := h.storage.GeneratePresignedGetURL(r.Context(), *profile.AvatarURL)
+		if err != nil {
+			h.logger.WithError(err).Warn("Failed to presign avatar URL")
+		} else {
+			response.AvatarURL = &viewURL
+		}
+	}
+
+	return response
+}
+
+// avatarChanged reports whether two optional avatar keys differ. A nil or
+// empty key means no avatar.
+func avatarChanged(a, b *string) bool {
+	keyA, keyB := "", ""
+	if a != nil {
+		keyA = *a
+	}
+	if b != nil {
+		keyB = *b
+	}
+	return keyA != keyB
+}
+
+func avatarKeyPrefix(userID uuid.UUID) string {
+	return "avatars/" + userID.String() + "/"
+}
@@ -1,6 +1,17 @@
 package handlers
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/http/middleware"
+)
+
+const (
+	defaultPageSize    = 20
+	maxPageSize        = 100
+	maxUserAgentLength = 512
+)
 
 // NotImplemented is a placeholder handler for routes not yet implemented
 func NotImplemented(w http.ResponseWriter, _ *http.Request) {
@@ -8,3 +19,40 @@ func NotImplemented(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusNotImplemented)
 	_, _ = w.Write([]byte(`{"error":{"code":"not_implemented","message":"This endpoint is not yet implemented"}}`))
 }
+
+// parsePagination reads limit and offset query parameters with sane bounds
+func parsePagination(r *http.Request) (limit, offset int) {
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// clientIP returns the address of the client without the port. Forwarding
+// headers are only trusted from the proxies configured for RealIP.
+func clientIP(r *http.Request) string {
+	return middleware.ClientIP(r)
+}
+
+// userAgent returns the client's user agent, truncated for storage
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ua
+}
+
+// requestID returns the ID assigned to the request by the RequestID middleware
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(middleware.RequestIDKey).(string)
+	return id
+}
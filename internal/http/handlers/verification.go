@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/mail"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// VerificationHandler handles email address verification endpoints
+type VerificationHandler struct {
+	userRepo      repository.UserRepository
+	userTokenRepo repository.UserTokenRepository
+	mailer        mail.Mailer
+	cfg           *config.Config
+	logger        *log.Logger
+}
+
+// NewVerificationHandler creates a new verification handler
+func NewVerificationHandler(
+	userRepo repository.UserRepository,
+	userTokenRepo repository.UserTokenRepository,
+	mailer mail.Mailer,
+	cfg *config.Config,
+	logger *log.Logger,
+) *VerificationHandler {
+	return &VerificationHandler{
+		userRepo:      userRepo,
+		userTokenRepo: userTokenRepo,
+		mailer:        mailer,
+		cfg:           cfg,
+		logger:        logger,
+	}
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// Verify marks the email address of the token's user as verified. Access
+// tokens issued before verification still carry the unverified claim, so
+// clients should refresh their token afterwards.
+func (h *VerificationHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid_request", "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		writeError(w, "invalid_input", "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.userTokenRepo.GetByTokenHash(ctx, domain.UserTokenEmailVerification, auth.HashToken(req.Token))
+	if err != nil || !token.IsValid(time.Now()) {
+		writeError(w, "invalid_token", "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if err := h.userTokenRepo.MarkUsed(ctx, token.ID, now); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, "invalid_token", "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		h.logger.WithError(err).Error("Failed to use verification token")
+		writeError(w, "internal_error", "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.userRepo.MarkVerified(ctx, token.UserID, now); err != nil {
+		h.logger.WithError(err).Error("Failed to mark user verified")
+		writeError(w, "internal_error", "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithField("user_id", token.UserID.String()).Info("Email address verified")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Resend emails a new verification link to the current user. Earlier links
+// stop working.
+func (h *VerificationHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		writeError(w, "unauthorized", "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	if user.IsVerified() {
+		writeError(w, "already_verified", "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	sendInBackground(r, func(ctx context.Context) {
+		if err := sendVerificationEmail(ctx, h.userTokenRepo, h.mailer, h.cfg, user); err != nil {
+			h.logger.WithError(err).WithField("user_id", user.ID.String()).Error("Failed to send verification email")
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendVerificationEmail issues a verification token for user and emails the
+// link to their address
+func sendVerificationEmail(
+	ctx context.Context, repo repository.UserTokenRepository, mailer mail.Mailer, cfg *config.Config, user *domain.User,
+) error {
+	token, err := issueUserToken(ctx, repo, user.ID, domain.UserTokenEmailVerification, cfg.Auth.EmailVerificationExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to issue verification token: %w", err)
+	}
+
+	link := cfg.Mail.AppBaseURL + "/verify-email?token=" + url.QueryEscape(token)
+	return mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your TinySchoolHub email address",
+		Body: fmt.Sprintf("Welcome to TinySchoolHub!\n\n"+
+			"Open this link to verify your email address:\n%s\n\n"+
+			"The link expires in %s. You can request a new one from the app.\n", link, cfg.Auth.EmailVerificationExpiry),
+	})
+}
@@ -2,26 +2,98 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
-	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
 )
 
 type contextKey string
 
 const (
-	UserIDKey    contextKey = "user_id"
-	UserEmailKey contextKey = "user_email"
-	UserRoleKey  contextKey = "user_role"
-	RequestIDKey contextKey = "request_id"
+	UserIDKey         contextKey = "user_id"
+	UserEmailKey      contextKey = "user_email"
+	UserRoleKey       contextKey = "user_role"
+	SessionIDKey      contextKey = "session_id"
+	VerifiedKey       contextKey = "email_verified"
+	RequestIDKey      contextKey = "request_id"
+	APIKeyIDKey       contextKey = "api_key_id"
+	ScopesKey         contextKey = "api_key_scopes"
+	ImpersonatorIDKey contextKey = "impersonator_id"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+// apiKeyUsageInterval limits how often the last use of a busy API key is written
+const apiKeyUsageInterval = time.Minute
+
+// errInvalidAPIKey is returned for unknown, revoked or expired API keys and
+// keys used from an address they are not allowed from
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyAuthenticator authenticates requests made with an API key instead of
+// an access token. The request acts as the user the key belongs to.
+type APIKeyAuthenticator struct {
+	apiKeyRepo repository.APIKeyRepository
+	userRepo   repository.UserRepository
+}
+
+// NewAPIKeyAuthenticator creates a new API key authenticator
+func NewAPIKeyAuthenticator(apiKeyRepo repository.APIKeyRepository, userRepo repository.UserRepository) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// authenticate looks up the key and returns the request context for its user
+func (a *APIKeyAuthenticator) authenticate(r *http.Request, token string) (context.Context, error) {
+	ctx := r.Context()
+	now := time.Now()
+
+	key, err := a.apiKeyRepo.GetByKeyHash(ctx, auth.HashToken(token))
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.IsActive(now) || !key.AllowsIP(ClientIP(r)) {
+		return nil, errInvalidAPIKey
+	}
+
+	user, err := a.userRepo.GetByID(ctx, key.UserID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to record the use does not fail the request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUsageInterval {
+		_ = a.apiKeyRepo.MarkUsed(ctx, key.ID, now)
+	}
+
+	ctx = context.WithValue(ctx, UserIDKey, user.ID.String())
+	ctx = context.WithValue(ctx, UserEmailKey, user.Email)
+	ctx = context.WithValue(ctx, UserRoleKey, string(user.Role))
+	ctx = context.WithValue(ctx, VerifiedKey, user.IsVerified())
+	ctx = context.WithValue(ctx, APIKeyIDKey, key.ID.String())
+	ctx = context.WithValue(ctx, ScopesKey, key.Scopes)
+	return ctx, nil
+}
+
+// AuthMiddleware validates JWT tokens against the signing key set and rejects
+// tokens issued before a revocation of their user, when revocations is set.
+// Bearer tokens with the API key prefix are checked by apiKeys instead; they
+// are rejected when apiKeys is nil.
+func AuthMiddleware(keys *auth.KeySet, apiKeys *APIKeyAuthenticator, revocations *TokenRevocations) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -36,21 +108,71 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 				return
 			}
 
-			claims, err := auth.ValidateAccessToken(parts[1], cfg.JWT.Secret)
+			if auth.IsAPIKey(parts[1]) {
+				if apiKeys == nil {
+					http.Error(w, `{"error":{"code":"unauthorized","message":"invalid or expired token"}}`, http.StatusUnauthorized)
+					return
+				}
+				ctx, err := apiKeys.authenticate(r, parts[1])
+				if errors.Is(err, errInvalidAPIKey) {
+					http.Error(w, `{"error":{"code":"unauthorized","message":"invalid or expired API key"}}`, http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					http.Error(w, `{"error":{"code":"internal_error","message":"failed to check API key"}}`, http.StatusInternalServerError)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			claims, err := auth.ValidateAccessToken(parts[1], keys)
 			if err != nil {
 				http.Error(w, `{"error":{"code":"unauthorized","message":"invalid or expired token"}}`, http.StatusUnauthorized)
 				return
 			}
 
+			if revocations != nil && isRevoked(revocations, claims) {
+				http.Error(w, `{"error":{"code":"unauthorized","message":"token has been revoked"}}`, http.StatusUnauthorized)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 			ctx = context.WithValue(ctx, UserEmailKey, claims.Email)
 			ctx = context.WithValue(ctx, UserRoleKey, claims.Role)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, VerifiedKey, !claims.Unverified)
+			if claims.Actor != nil {
+				ctx = context.WithValue(ctx, ImpersonatorIDKey, claims.Actor.UserID)
+			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// isRevoked reports whether the token was issued before a revocation of its
+// user or, for impersonation tokens, of the admin acting as them. Tokens
+// without a valid user or issue time count as revoked.
+func isRevoked(revocations *TokenRevocations, claims *auth.Claims) bool {
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil || claims.IssuedAt == nil {
+		return true
+	}
+	if revocations.IsRevoked(userID, claims.IssuedAt.Time) {
+		return true
+	}
+
+	if claims.Actor == nil {
+		return false
+	}
+	actorID, err := uuid.Parse(claims.Actor.UserID)
+	if err != nil {
+		return true
+	}
+	return revocations.IsRevoked(actorID, claims.IssuedAt.Time)
+}
+
 // RequireRole middleware ensures the user has one of the required roles
 func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -79,6 +201,53 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireScope middleware ensures a request made with an API key was granted
+// scope. Requests made with an access token have every scope their user's
+// role allows.
+func RequireScope(scope domain.APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, ok := r.Context().Value(ScopesKey).([]domain.APIKeyScope); ok {
+				key := &domain.APIKey{Scopes: scopes}
+				if !key.HasScope(scope) {
+					http.Error(w, `{"error":{"code":"insufficient_scope","message":"API key lacks the `+string(scope)+` scope"}}`, http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectAPIKeys middleware keeps requests made with an API key out of routes
+// that are only meant for users, such as account and admin management
+func RejectAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(APIKeyIDKey).(string); ok {
+			http.Error(w, `{"error":{"code":"forbidden","message":"API keys cannot be used for this endpoint"}}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireVerified middleware ensures the user has verified their email address.
+// Verification is read from the access token, so a user who just verified has
+// to refresh their token first.
+func RequireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified, _ := r.Context().Value(VerifiedKey).(bool)
+		if !verified {
+			http.Error(w, `{"error":{"code":"email_not_verified","message":"email address is not verified"}}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // RequestID middleware adds a unique request ID
 func RequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -109,6 +278,52 @@ func GetUserID(ctx context.Context) (uuid.UUID, bool) {
 	return userID, true
 }
 
+// GetSessionID retrieves the session the access token was issued for. Tokens
+// issued outside a login session have none.
+func GetSessionID(ctx context.Context) (uuid.UUID, bool) {
+	sessionIDStr, ok := ctx.Value(SessionIDKey).(string)
+	if !ok || sessionIDStr == "" {
+		return uuid.Nil, false
+	}
+
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return sessionID, true
+}
+
+// GetAPIKeyID retrieves the API key the request was made with, if any
+func GetAPIKeyID(ctx context.Context) (uuid.UUID, bool) {
+	keyIDStr, ok := ctx.Value(APIKeyIDKey).(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	keyID, err := uuid.Parse(keyIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return keyID, true
+}
+
+// GetImpersonatorID retrieves the admin impersonating the user, if any
+func GetImpersonatorID(ctx context.Context) (uuid.UUID, bool) {
+	impersonatorIDStr, ok := ctx.Value(ImpersonatorIDKey).(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	impersonatorID, err := uuid.Parse(impersonatorIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return impersonatorID, true
+}
+
 // GetUserRole retrieves the user role from context
 func GetUserRole(ctx context.Context) (string, bool) {
 	role, ok := ctx.Value(UserRoleKey).(string)
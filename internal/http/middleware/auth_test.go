@@ -9,23 +9,37 @@ import (
 
 	"github.com/google/uuid"
 
-	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
 	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
 )
 
+func newTestKeySet(tb testing.TB) *auth.KeySet {
+	tb.Helper()
+
+	key, err := auth.GenerateSigningKey("test-key")
+	if err != nil {
+		tb.Fatalf("Failed to generate signing key: %v", err)
+	}
+	keys, err := auth.NewKeySet(key)
+	if err != nil {
+		tb.Fatalf("Failed to create key set: %v", err)
+	}
+	return keys
+}
+
 func TestAuthMiddleware(t *testing.T) {
-	secret := "test-secret-key"
+	keys := newTestKeySet(t)
 	userID := uuid.New().String()
 	email := "test@example.com"
 	role := string(domain.RoleTeacher)
 
-	validToken, err := auth.GenerateAccessToken(userID, email, role, secret, 15*time.Minute)
+	validToken, err := auth.GenerateAccessToken(userID, email, role, keys, 15*time.Minute)
 	if err != nil {
 		t.Fatalf("Failed to generate token: %v", err)
 	}
 
-	expiredToken, err := auth.GenerateAccessToken(userID, email, role, secret, -1*time.Hour)
+	expiredToken, err := auth.GenerateAccessToken(userID, email, role, keys, -1*time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to generate expired token: %v", err)
 	}
@@ -61,7 +75,7 @@ func TestAuthMiddleware(t *testing.T) {
 			expectNext:     false,
 		},
 		{
-			name:           "wrong secret",
+			name:           "signed by another key",
 			token:          "Bearer " + validToken,
 			expectedStatus: http.StatusUnauthorized,
 			expectNext:     false,
@@ -70,19 +84,13 @@ func TestAuthMiddleware(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Setup test secret
-			testSecret := secret
-			if tt.name == "wrong secret" {
-				testSecret = "wrong-secret"
+			// Setup test key set
+			testKeys := keys
+			if tt.name == "signed by another key" {
+				testKeys = newTestKeySet(t)
 			}
 
-			// Create middleware with config
-			cfg := &config.Config{
-				JWT: config.JWTConfig{
-					Secret: testSecret,
-				},
-			}
-			middleware := AuthMiddleware(cfg)
+			middleware := AuthMiddleware(testKeys, nil, nil)
 
 			// Create test handler
 			nextCalled := false
@@ -132,7 +140,7 @@ func TestAuthMiddleware(t *testing.T) {
 }
 
 func TestRequireRole(t *testing.T) {
-	secret := "test-secret-key"
+	keys := newTestKeySet(t)
 
 	tests := []struct {
 		name           string
@@ -183,18 +191,13 @@ func TestRequireRole(t *testing.T) {
 			// Generate token with user role
 			userID := uuid.New().String()
 			email := "test@example.com"
-			token, err := auth.GenerateAccessToken(userID, email, string(tt.userRole), secret, 15*time.Minute)
+			token, err := auth.GenerateAccessToken(userID, email, string(tt.userRole), keys, 15*time.Minute)
 			if err != nil {
 				t.Fatalf("Failed to generate token: %v", err)
 			}
 
 			// Create middleware chain
-			cfg := &config.Config{
-				JWT: config.JWTConfig{
-					Secret: secret,
-				},
-			}
-			authMW := AuthMiddleware(cfg)
+			authMW := AuthMiddleware(keys, nil, nil)
 			roleMW := RequireRole(string(tt.requiredRole))
 
 			// Create test handler
@@ -247,6 +250,62 @@ func TestRequireRole_NoAuth(t *testing.T) {
 	}
 }
 
+func TestRequireVerified(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	verifiedToken, err := auth.GenerateAccessToken(uuid.New().String(), "test@example.com", "PARENT", keys, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	unverifiedToken, err := auth.SignAccessToken(&auth.Claims{
+		UserID:     uuid.New().String(),
+		Role:       "PARENT",
+		Unverified: true,
+	}, keys, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"verified user", verifiedToken, http.StatusOK},
+		{"unverified user", unverifiedToken, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AuthMiddleware(keys, nil, nil)(RequireVerified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %v, want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestRequireVerified_NoAuth(t *testing.T) {
+	handler := RequireVerified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Next handler should not be called")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("status = %v, want %v", rr.Code, http.StatusForbidden)
+	}
+}
+
 func TestGetUserID(t *testing.T) {
 	userID := uuid.New()
 
@@ -279,6 +338,22 @@ func TestGetUserID(t *testing.T) {
 	}
 }
 
+func TestGetSessionID(t *testing.T) {
+	sessionID := uuid.New()
+
+	ctx := context.WithValue(context.Background(), SessionIDKey, sessionID.String())
+	gotID, ok := GetSessionID(ctx)
+	if !ok || gotID != sessionID {
+		t.Errorf("GetSessionID() = %v, %v, want %v, true", gotID, ok, sessionID)
+	}
+
+	// Tokens without a session carry an empty claim
+	ctx = context.WithValue(context.Background(), SessionIDKey, "")
+	if _, ok := GetSessionID(ctx); ok {
+		t.Error("GetSessionID() should return false for an empty session ID")
+	}
+}
+
 func TestGetUserRole(t *testing.T) {
 	role := string(domain.RoleTeacher)
 
@@ -352,15 +427,251 @@ func TestRequestID(t *testing.T) {
 	}
 }
 
-func BenchmarkAuthMiddleware(b *testing.B) {
-	secret := "test-secret"
-	token, _ := auth.GenerateAccessToken(uuid.New().String(), "test@example.com", "TEACHER", secret, 15*time.Minute)
-	cfg := &config.Config{
-		JWT: config.JWTConfig{
-			Secret: secret,
+// fakeAPIKeyRepo serves API keys from memory
+type fakeAPIKeyRepo struct {
+	repository.APIKeyRepository
+	keys map[string]*domain.APIKey
+	used int
+}
+
+func (f *fakeAPIKeyRepo) GetByKeyHash(_ context.Context, keyHash string) (*domain.APIKey, error) {
+	if key, ok := f.keys[keyHash]; ok {
+		return key, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (f *fakeAPIKeyRepo) MarkUsed(_ context.Context, _ uuid.UUID, usedAt time.Time) error {
+	f.used++
+	for _, key := range f.keys {
+		key.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+// fakeUserRepo serves users from memory
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[uuid.UUID]*domain.User
+}
+
+func (f *fakeUserRepo) GetByID(_ context.Context, id uuid.UUID) (*domain.User, error) {
+	if user, ok := f.users[id]; ok {
+		return user, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func TestAuthMiddleware_APIKey(t *testing.T) {
+	keys := newTestKeySet(t)
+	now := time.Now()
+	past := now.Add(-time.Hour)
+
+	user := &domain.User{ID: uuid.New(), Email: "office@example.com", Role: domain.RoleTeacher, VerifiedAt: &past}
+
+	newKey := func(t *testing.T, apiKeys map[string]*domain.APIKey, modify func(*domain.APIKey)) string {
+		t.Helper()
+		token, prefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("Failed to generate API key: %v", err)
+		}
+		key := &domain.APIKey{
+			ID:     uuid.New(),
+			UserID: user.ID,
+			Prefix: prefix,
+			Scopes: []domain.APIKeyScope{domain.APIKeyScopeClassesRead},
+		}
+		if modify != nil {
+			modify(key)
+		}
+		apiKeys[auth.HashToken(token)] = key
+		return token
+	}
+
+	apiKeys := map[string]*domain.APIKey{}
+	valid := newKey(t, apiKeys, nil)
+	revoked := newKey(t, apiKeys, func(k *domain.APIKey) { k.RevokedAt = &past })
+	expired := newKey(t, apiKeys, func(k *domain.APIKey) { k.ExpiresAt = &past })
+	allowlisted := newKey(t, apiKeys, func(k *domain.APIKey) { k.AllowedIPs = []string{"192.0.2.0/24"} })
+	otherNetwork := newKey(t, apiKeys, func(k *domain.APIKey) { k.AllowedIPs = []string{"10.0.0.0/8"} })
+	orphaned := newKey(t, apiKeys, func(k *domain.APIKey) { k.UserID = uuid.New() })
+	unknown, _, _ := auth.GenerateAPIKey()
+
+	repo := &fakeAPIKeyRepo{keys: apiKeys}
+	authenticator := NewAPIKeyAuthenticator(repo, &fakeUserRepo{users: map[uuid.UUID]*domain.User{user.ID: user}})
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"valid key", valid, http.StatusOK},
+		{"allowed address", allowlisted, http.StatusOK},
+		{"other address", otherNetwork, http.StatusUnauthorized},
+		{"revoked key", revoked, http.StatusUnauthorized},
+		{"expired key", expired, http.StatusUnauthorized},
+		{"key of deleted user", orphaned, http.StatusUnauthorized},
+		{"unknown key", unknown, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx context.Context
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx = r.Context()
+				w.WriteHeader(http.StatusOK)
+			})
+
+			// httptest requests come from 192.0.2.1
+			req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			AuthMiddleware(keys, authenticator, nil)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Status code = %v, want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if userID, ok := GetUserID(ctx); !ok || userID != user.ID {
+				t.Errorf("GetUserID() = %v, %v, want %v", userID, ok, user.ID)
+			}
+			if role, ok := GetUserRole(ctx); !ok || role != string(domain.RoleTeacher) {
+				t.Errorf("GetUserRole() = %v, %v, want TEACHER", role, ok)
+			}
+			if _, ok := GetAPIKeyID(ctx); !ok {
+				t.Error("GetAPIKeyID() should find the key")
+			}
+			if _, ok := GetSessionID(ctx); ok {
+				t.Error("GetSessionID() should find no session for an API key")
+			}
+			if verified, _ := ctx.Value(VerifiedKey).(bool); !verified {
+				t.Error("API key of a verified user should count as verified")
+			}
+		})
+	}
+
+	t.Run("last use is recorded at most once a minute", func(t *testing.T) {
+		used := repo.used
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+valid)
+			AuthMiddleware(keys, authenticator, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+		}
+		if repo.used != used {
+			t.Errorf("MarkUsed() called %d times, want 0 after a recent use", repo.used-used)
+		}
+	})
+
+	t.Run("forged forwarding headers do not pass the allowlist", func(t *testing.T) {
+		// The key only allows 10.0.0.0/8 and the peer is not a trusted proxy
+		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+		req.RemoteAddr = "198.51.100.1:1234"
+		req.Header.Set("Authorization", "Bearer "+otherNetwork)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		rr := httptest.NewRecorder()
+		RealIP(nil)(AuthMiddleware(keys, authenticator, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			t.Error("Next handler should not be called")
+		}))).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Status code = %v, want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("API keys are rejected without an authenticator", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+valid)
+		rr := httptest.NewRecorder()
+		AuthMiddleware(keys, nil, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			t.Error("Next handler should not be called")
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Status code = %v, want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		ctx            func(context.Context) context.Context
+		expectedStatus int
+	}{
+		{
+			name:           "access token",
+			ctx:            func(ctx context.Context) context.Context { return ctx },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "API key with scope",
+			ctx: func(ctx context.Context) context.Context {
+				return context.WithValue(ctx, ScopesKey, []domain.APIKeyScope{domain.APIKeyScopeMembersRead, domain.APIKeyScopeClassesRead})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "API key without scope",
+			ctx: func(ctx context.Context) context.Context {
+				return context.WithValue(ctx, ScopesKey, []domain.APIKeyScope{domain.APIKeyScopeClassesWrite})
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "API key without scopes",
+			ctx: func(ctx context.Context) context.Context {
+				return context.WithValue(ctx, ScopesKey, []domain.APIKeyScope(nil))
+			},
+			expectedStatus: http.StatusForbidden,
 		},
 	}
-	middleware := AuthMiddleware(cfg)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+			req = req.WithContext(tt.ctx(req.Context()))
+			rr := httptest.NewRecorder()
+			RequireScope(domain.APIKeyScopeClassesRead)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Status code = %v, want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestRejectAPIKeys(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+	rr := httptest.NewRecorder()
+	RejectAPIKeys(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Status code = %v, want %v for an access token", rr.Code, http.StatusOK)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), APIKeyIDKey, uuid.New().String()))
+	rr = httptest.NewRecorder()
+	RejectAPIKeys(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Status code = %v, want %v for an API key", rr.Code, http.StatusForbidden)
+	}
+}
+
+func BenchmarkAuthMiddleware(b *testing.B) {
+	keys := newTestKeySet(b)
+	token, _ := auth.GenerateAccessToken(uuid.New().String(), "test@example.com", "TEACHER", keys, 15*time.Minute)
+	middleware := AuthMiddleware(keys, nil, nil)
 	next := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
 
 	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// Impersonation middleware logs every request made with an impersonation
+// token with both the user and the admin acting as them. Impersonation is
+// read-only: requests that change data are rejected unless their route is
+// listed in allowedWrites as "METHOD /pattern", e.g. "POST /v1/messages".
+// It has to run after AuthMiddleware, inside a route group so the route is
+// already known.
+func Impersonation(logger *log.Logger, allowedWrites ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(allowedWrites))
+	for _, route := range allowedWrites {
+		allowed[route] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			impersonatorID, ok := r.Context().Value(ImpersonatorIDKey).(string)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, _ := r.Context().Value(UserIDKey).(string)
+			requestID, _ := r.Context().Value(RequestIDKey).(string)
+			route := r.Method + " " + routePattern(r)
+
+			fields := map[string]interface{}{
+				"user_id":         userID,
+				"impersonator_id": impersonatorID,
+				"method":          r.Method,
+				"path":            r.URL.Path,
+				"request_id":      requestID,
+			}
+
+			if !isSafeMethod(r.Method) && !allowed[route] {
+				fields["status"] = http.StatusForbidden
+				logger.WithFields(fields).Warn("Impersonated write blocked")
+				http.Error(w, `{"error":{"code":"impersonation_read_only","message":"this action is not allowed while impersonating a user"}}`, http.StatusForbidden)
+				return
+			}
+
+			ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			fields["status"] = ww.Status()
+			logger.WithFields(fields).Info("Impersonated request")
+		})
+	}
+}
+
+// routePattern returns the pattern of the route the request matched, or its
+// path if it has not been routed yet
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
+
+// isSafeMethod reports whether method only reads data
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+func TestAuthMiddleware_Impersonation(t *testing.T) {
+	keys := newTestKeySet(t)
+	userID := uuid.New()
+	adminID := uuid.New()
+
+	token, err := auth.SignAccessToken(&auth.Claims{
+		UserID: userID.String(),
+		Role:   "PARENT",
+		Actor:  &auth.Actor{UserID: adminID.String()},
+	}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	var gotUser, gotImpersonator uuid.UUID
+	var impersonated bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = GetUserID(r.Context())
+		gotImpersonator, impersonated = GetImpersonatorID(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	AuthMiddleware(keys, nil, nil)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotUser != userID {
+		t.Errorf("GetUserID() = %v, want %v", gotUser, userID)
+	}
+	if !impersonated || gotImpersonator != adminID {
+		t.Errorf("GetImpersonatorID() = %v, %v, want %v", gotImpersonator, impersonated, adminID)
+	}
+
+	token, err = auth.GenerateAccessToken(userID.String(), "user@example.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	AuthMiddleware(keys, nil, nil)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	if impersonated {
+		t.Error("GetImpersonatorID() should find no impersonator on a regular token")
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	keys := newTestKeySet(t)
+	userID := uuid.New()
+
+	impersonationToken, err := auth.SignAccessToken(&auth.Claims{
+		UserID: userID.String(),
+		Role:   "PARENT",
+		Actor:  &auth.Actor{UserID: uuid.New().String()},
+	}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	userToken, err := auth.GenerateAccessToken(userID.String(), "user@example.com", "PARENT", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	ok := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(AuthMiddleware(keys, nil, nil))
+		r.Use(Impersonation(log.New("error", "json"), "POST /classes/{id}/notes"))
+		r.Get("/classes/{id}", ok)
+		r.Patch("/classes/{id}", ok)
+		r.Post("/classes/{id}/notes", ok)
+	})
+
+	tests := []struct {
+		name           string
+		token          string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"impersonated read", impersonationToken, http.MethodGet, "/classes/1", http.StatusOK},
+		{"impersonated write", impersonationToken, http.MethodPatch, "/classes/1", http.StatusForbidden},
+		{"allowed impersonated write", impersonationToken, http.MethodPost, "/classes/1/notes", http.StatusOK},
+		{"user write", userToken, http.MethodPatch, "/classes/1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Status code = %v, want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
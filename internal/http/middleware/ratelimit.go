@@ -58,19 +58,13 @@ func (rl *RateLimiter) cleanupVisitors() {
 	}
 }
 
-// RateLimit middleware limits requests per IP
+// RateLimit middleware limits requests per client IP. It has to run after
+// RealIP to limit clients behind a trusted proxy separately.
 func (rl *RateLimiter) RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		// Try to get real IP from headers
-		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-			ip = realIP
-		} else if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-			// Take first IP
-			ip = forwarded
-		}
-
-		limiter := rl.getVisitor(ip)
+		// Forwarding headers are only trusted through RealIP, and the port is
+		// dropped so every connection of a client shares one bucket
+		limiter := rl.getVisitor(ClientIP(r))
 		if !limiter.Allow() {
 			http.Error(w, `{"error":{"code":"rate_limit_exceeded","message":"too many requests"}}`, http.StatusTooManyRequests)
 			return
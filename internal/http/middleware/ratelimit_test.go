@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -118,51 +119,72 @@ func TestRateLimit_XRealIP(t *testing.T) {
 
 	middleware := rl.RateLimit(handler)
 
-	realIP := "10.0.0.1"
-
-	// Use X-Real-IP header
-	for i := 0; i < 2; i++ {
+	// A client that is not a trusted proxy cannot pick a new bucket with a
+	// forged X-Real-IP header or a new connection
+	for i := 0; i < 3; i++ {
 		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
-		req.RemoteAddr = "192.168.1.1" // Different from X-Real-IP
-		req.Header.Set("X-Real-IP", realIP)
+		req.RemoteAddr = fmt.Sprintf("192.168.1.1:%d", 40000+i)
+		req.Header.Set("X-Real-IP", fmt.Sprintf("10.0.0.%d", i+1))
 		rr := httptest.NewRecorder()
 
 		middleware.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusOK {
-			t.Errorf("Request %d: Status code = %v, want %v", i+1, rr.Code, http.StatusOK)
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if rr.Code != want {
+			t.Errorf("Request %d: Status code = %v, want %v", i+1, rr.Code, want)
 		}
 	}
+}
 
-	// Third request should be rate limited
-	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
-	req.RemoteAddr = "192.168.1.1"
-	req.Header.Set("X-Real-IP", realIP)
-	rr := httptest.NewRecorder()
+func TestRateLimit_XForwardedFor(t *testing.T) {
+	rl := NewRateLimiter(1) // 1 request per second, burst of 2
 
-	middleware.ServeHTTP(rr, req)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
 
-	if rr.Code != http.StatusTooManyRequests {
-		t.Errorf("Status code = %v, want %v", rr.Code, http.StatusTooManyRequests)
+	// RealIP trusts no proxy, as without TRUSTED_PROXIES
+	middleware := RealIP(nil)(rl.RateLimit(handler))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+		req.RemoteAddr = fmt.Sprintf("192.168.1.1:%d", 40000+i)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		rr := httptest.NewRecorder()
+
+		middleware.ServeHTTP(rr, req)
+
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if rr.Code != want {
+			t.Errorf("Request %d: Status code = %v, want %v", i+1, rr.Code, want)
+		}
 	}
 }
 
-func TestRateLimit_XForwardedFor(t *testing.T) {
+func TestRateLimit_TrustedProxy(t *testing.T) {
 	rl := NewRateLimiter(1) // 1 request per second, burst of 2
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	middleware := rl.RateLimit(handler)
-
-	forwardedIP := "203.0.113.1"
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware := RealIP(trusted)(rl.RateLimit(handler))
 
-	// Use X-Forwarded-For header
-	for i := 0; i < 2; i++ {
+	// Clients behind a trusted proxy get a bucket each
+	for i := 0; i < 3; i++ {
 		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
-		req.RemoteAddr = "192.168.1.1"
-		req.Header.Set("X-Forwarded-For", forwardedIP+", 192.168.1.1")
+		req.RemoteAddr = "10.0.0.1:40000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
 		rr := httptest.NewRecorder()
 
 		middleware.ServeHTTP(rr, req)
@@ -171,18 +193,6 @@ func TestRateLimit_XForwardedFor(t *testing.T) {
 			t.Errorf("Request %d: Status code = %v, want %v", i+1, rr.Code, http.StatusOK)
 		}
 	}
-
-	// Third request should be rate limited
-	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
-	req.RemoteAddr = "192.168.1.1"
-	req.Header.Set("X-Forwarded-For", forwardedIP+", 192.168.1.1")
-	rr := httptest.NewRecorder()
-
-	middleware.ServeHTTP(rr, req)
-
-	if rr.Code != http.StatusTooManyRequests {
-		t.Errorf("Status code = %v, want %v", rr.Code, http.StatusTooManyRequests)
-	}
 }
 
 func TestRateLimit_Recovery(t *testing.T) {
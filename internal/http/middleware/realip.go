@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses the addresses and CIDR ranges of the reverse
+// proxies whose forwarding headers are trusted
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: not an address or CIDR range", entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// RealIP middleware replaces RemoteAddr with the client address forwarded in
+// X-Forwarded-For or X-Real-IP, but only when the request comes from a trusted
+// proxy. Clients can set these headers to anything, so they are ignored from
+// any other peer. X-Forwarded-For is read from the right, skipping trusted
+// proxies, so addresses prepended by the client are never used.
+func RealIP(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddr(ClientIP(r))
+			if err != nil || !isTrusted(peer.Unmap()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := peer.Unmap()
+			if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+				hops := strings.Split(strings.Join(forwarded, ","), ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+					if err != nil {
+						break
+					}
+					client = addr.Unmap()
+					if !isTrusted(client) {
+						break
+					}
+				}
+			} else if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+				client = addr.Unmap()
+			}
+
+			r.RemoteAddr = client.String()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address of the client without the port. Behind RealIP
+// it is the address forwarded by a trusted proxy, otherwise the TCP peer.
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
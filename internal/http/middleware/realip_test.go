@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	if len(prefixes) != 3 || prefixes[1].String() != "192.0.2.1/32" {
+		t.Errorf("ParseTrustedProxies() = %v", prefixes)
+	}
+
+	if _, err := ParseTrustedProxies([]string{"ingress"}); err == nil {
+		t.Error("ParseTrustedProxies() should reject entries that are not addresses")
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "198.51.100.7:4321", nil, "", "198.51.100.7"},
+		{"forged header from untrusted peer", "198.51.100.7:4321", []string{"203.0.113.1"}, "", "198.51.100.7"},
+		{"forged X-Real-IP from untrusted peer", "198.51.100.7:4321", nil, "203.0.113.1", "198.51.100.7"},
+		{"forwarded by trusted proxy", "10.1.2.3:80", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"client prepends forged address", "10.1.2.3:80", []string{"203.0.113.1, 198.51.100.7"}, "", "198.51.100.7"},
+		{"chain of trusted proxies", "10.1.2.3:80", []string{"198.51.100.7, 10.4.5.6", "10.7.8.9"}, "", "198.51.100.7"},
+		{"X-Real-IP from trusted proxy", "10.1.2.3:80", nil, "198.51.100.7", "198.51.100.7"},
+		{"garbage from trusted proxy", "10.1.2.3:80", []string{"unknown"}, "", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			RealIP(trusted)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
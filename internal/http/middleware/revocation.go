@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// TokenRevocations keeps the access token revocations that can still affect
+// unexpired tokens in memory, so checking a token never queries the database.
+// The list is reloaded every interval to pick up revocations made by other
+// instances; revocations made through Revoke apply at once.
+type TokenRevocations struct {
+	revocationRepo repository.AccessTokenRevocationRepository
+	// tokenLifetime is the longest an access token is valid; older
+	// revocations cannot affect any token and are not loaded
+	tokenLifetime time.Duration
+	interval      time.Duration
+	logger        *log.Logger
+
+	mu         sync.RWMutex
+	validAfter map[uuid.UUID]time.Time
+}
+
+// NewTokenRevocations creates a revocation list reloaded every interval
+func NewTokenRevocations(
+	revocationRepo repository.AccessTokenRevocationRepository,
+	tokenLifetime time.Duration,
+	interval time.Duration,
+	logger *log.Logger,
+) *TokenRevocations {
+	return &TokenRevocations{
+		revocationRepo: revocationRepo,
+		tokenLifetime:  tokenLifetime,
+		interval:       interval,
+		logger:         logger,
+		validAfter:     make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Load replaces the list with the revocations stored in the database
+func (t *TokenRevocations) Load(ctx context.Context) error {
+	since := time.Now().Add(-t.tokenLifetime)
+	revocations, err := t.revocationRepo.ListSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	validAfter := make(map[uuid.UUID]time.Time, len(revocations))
+	for _, revocation := range revocations {
+		validAfter[revocation.UserID] = revocation.ValidAfter
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Keeps revocations made while the list was loading
+	for userID, at := range t.validAfter {
+		if at.After(since) && at.After(validAfter[userID]) {
+			validAfter[userID] = at
+		}
+	}
+	t.validAfter = validAfter
+	return nil
+}
+
+// Run reloads the list periodically until ctx is cancelled
+func (t *TokenRevocations) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Load(ctx); err != nil {
+				t.logger.WithError(err).Error("Failed to load access token revocations")
+			}
+		}
+	}
+}
+
+// Revoke invalidates the user's access tokens issued until now
+func (t *TokenRevocations) Revoke(ctx context.Context, userID uuid.UUID) error {
+	now := time.Now()
+	if err := t.revocationRepo.Revoke(ctx, userID, now); err != nil {
+		return err
+	}
+
+	t.Add(userID, now)
+	return nil
+}
+
+// Add records a revocation that is already stored, such as one made as part
+// of a role change, so it applies before the next reload
+func (t *TokenRevocations) Add(userID uuid.UUID, validAfter time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if validAfter.After(t.validAfter[userID]) {
+		t.validAfter[userID] = validAfter
+	}
+}
+
+// IsRevoked reports whether a token of the user issued at issuedAt is revoked
+func (t *TokenRevocations) IsRevoked(userID uuid.UUID, issuedAt time.Time) bool {
+	t.mu.RLock()
+	validAfter, ok := t.validAfter[userID]
+	t.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+	revocation := &domain.AccessTokenRevocation{UserID: userID, ValidAfter: validAfter}
+	return revocation.Revokes(issuedAt)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// fakeRevocationRepo stores revocations in memory and counts lookups
+type fakeRevocationRepo struct {
+	validAfter map[uuid.UUID]time.Time
+	lists      int
+}
+
+func (f *fakeRevocationRepo) Revoke(_ context.Context, userID uuid.UUID, validAfter time.Time) error {
+	if validAfter.After(f.validAfter[userID]) {
+		f.validAfter[userID] = validAfter
+	}
+	return nil
+}
+
+func (f *fakeRevocationRepo) ListSince(_ context.Context, since time.Time) ([]*domain.AccessTokenRevocation, error) {
+	f.lists++
+	var revocations []*domain.AccessTokenRevocation
+	for userID, validAfter := range f.validAfter {
+		if validAfter.After(since) {
+			revocations = append(revocations, &domain.AccessTokenRevocation{UserID: userID, ValidAfter: validAfter})
+		}
+	}
+	return revocations, nil
+}
+
+func TestTokenRevocations(t *testing.T) {
+	now := time.Now()
+	revokedUser := uuid.New()
+	staleUser := uuid.New()
+	otherUser := uuid.New()
+
+	repo := &fakeRevocationRepo{validAfter: map[uuid.UUID]time.Time{
+		revokedUser: now,
+		// Older than any token that is still valid
+		staleUser: now.Add(-time.Hour),
+	}}
+	revocations := NewTokenRevocations(repo, 15*time.Minute, time.Minute, log.New("error", "json"))
+	if err := revocations.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !revocations.IsRevoked(revokedUser, now.Add(-time.Minute)) {
+		t.Error("Token issued before the revocation should be revoked")
+	}
+	if revocations.IsRevoked(revokedUser, now.Add(time.Minute)) {
+		t.Error("Token issued after the revocation should be valid")
+	}
+	if revocations.IsRevoked(otherUser, now.Add(-time.Minute)) {
+		t.Error("Tokens of other users should be valid")
+	}
+	if _, ok := revocations.validAfter[staleUser]; ok {
+		t.Error("Load() should skip revocations older than the token lifetime")
+	}
+
+	if err := revocations.Revoke(context.Background(), otherUser); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if !revocations.IsRevoked(otherUser, now.Add(-time.Minute)) {
+		t.Error("Revoke() should apply without a reload")
+	}
+	if _, ok := repo.validAfter[otherUser]; !ok {
+		t.Error("Revoke() should store the revocation")
+	}
+
+	// An earlier revocation never undoes a later one
+	revocations.Add(revokedUser, now.Add(-time.Hour))
+	if !revocations.IsRevoked(revokedUser, now.Add(-time.Minute)) {
+		t.Error("Add() should keep the later revocation")
+	}
+}
+
+func TestAuthMiddleware_Revocation(t *testing.T) {
+	keys := newTestKeySet(t)
+	userID := uuid.New()
+
+	token, err := auth.GenerateAccessToken(userID.String(), "teacher@example.com", "TEACHER", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	repo := &fakeRevocationRepo{validAfter: map[uuid.UUID]time.Time{}}
+	revocations := NewTokenRevocations(repo, 15*time.Minute, time.Minute, log.New("error", "json"))
+	if err := revocations.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	handler := AuthMiddleware(keys, nil, revocations)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("Status code = %v, want %v before the revocation", code, http.StatusOK)
+	}
+
+	revocations.Add(userID, time.Now())
+	if code := serve(); code != http.StatusUnauthorized {
+		t.Errorf("Status code = %v, want %v after the revocation", code, http.StatusUnauthorized)
+	}
+
+	if repo.lists != 1 {
+		t.Errorf("ListSince() called %d times, want 1: requests should not query the database", repo.lists)
+	}
+}
+
+func TestAuthMiddleware_RevokedImpersonator(t *testing.T) {
+	keys := newTestKeySet(t)
+	adminID := uuid.New()
+
+	token, err := auth.SignAccessToken(&auth.Claims{
+		UserID: uuid.NewString(),
+		Role:   "PARENT",
+		Actor:  &auth.Actor{UserID: adminID.String()},
+	}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	repo := &fakeRevocationRepo{validAfter: map[uuid.UUID]time.Time{}}
+	revocations := NewTokenRevocations(repo, 15*time.Minute, time.Minute, log.New("error", "json"))
+	revocations.Add(adminID, time.Now())
+
+	handler := AuthMiddleware(keys, nil, revocations)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Status code = %v, want %v once the impersonating admin is revoked", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,102 @@
+// Package imaging decodes uploaded photos, strips their metadata and renders
+// resized variants.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // register PNG decoder
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+const (
+	// MaxPixels bounds the decoded size of an image so a small, highly
+	// compressed upload cannot exhaust memory. 24 MP covers phone and most
+	// camera photos. The photo processor works on one photo at a time and
+	// peaks at about 200 MB for it: two RGBA copies of 4 bytes per pixel while
+	// a JPEG is rotated upright, or a 16-bit PNG decoded at 8 bytes per pixel.
+	MaxPixels = 24_000_000
+
+	// VariantContentType is the content type of every generated variant
+	VariantContentType = "image/jpeg"
+
+	variantQuality = 82
+)
+
+// ErrTooLarge is returned for images whose dimensions exceed MaxPixels
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// Variant describes a resized rendition of a photo. Name matches the
+// domain.PhotoVariant the rendition is stored as.
+type Variant struct {
+	Name         string
+	MaxDimension int
+}
+
+var (
+	// Thumbnail is used for gallery grids
+	Thumbnail = Variant{Name: "thumbnail", MaxDimension: 320}
+	// Medium is used for full-screen viewing on phones
+	Medium = Variant{Name: "medium", MaxDimension: 1280}
+)
+
+// Variants lists every variant generated for a photo
+var Variants = []Variant{Thumbnail, Medium}
+
+// Decode decodes a JPEG, PNG or WebP image after checking its dimensions
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s image: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// Resize scales img down so that neither side exceeds maxDimension, keeping
+// the aspect ratio. Images that already fit are returned unchanged.
+func Resize(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxDimension && height <= maxDimension {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*maxDimension/width)
+		width = maxDimension
+	} else {
+		width = max(1, width*maxDimension/height)
+		height = maxDimension
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// EncodeVariant renders img as a variant. Transparent areas are flattened
+// onto white because variants are always JPEG.
+func EncodeVariant(w io.Writer, img image.Image, variant Variant) error {
+	resized := Resize(img, variant.MaxDimension)
+
+	flat := image.NewRGBA(resized.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), resized, resized.Bounds().Min, draw.Over)
+
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: variantQuality})
+}
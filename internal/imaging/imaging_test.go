@@ -0,0 +1,100 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name                  string
+		width, height         int
+		maxDimension          int
+		wantWidth, wantHeight int
+	}{
+		{"landscape", 2000, 1000, 320, 320, 160},
+		{"portrait", 1000, 2000, 320, 160, 320},
+		{"square", 800, 800, 320, 320, 320},
+		{"already small", 200, 100, 320, 200, 100},
+		{"extreme aspect ratio", 4000, 2, 320, 320, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resize(testImage(tt.width, tt.height), tt.maxDimension).Bounds()
+			if got.Dx() != tt.wantWidth || got.Dy() != tt.wantHeight {
+				t.Errorf("Resize() = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestDecodeAndEncodeVariant(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, testImage(1600, 900)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	img, format, err := Decode(pngData.Bytes())
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if format != "png" {
+		t.Errorf("Decode() format = %q, want png", format)
+	}
+
+	var out bytes.Buffer
+	if err := EncodeVariant(&out, img, Thumbnail); err != nil {
+		t.Fatalf("EncodeVariant() error = %v", err)
+	}
+
+	variant, err := jpeg.Decode(&out)
+	if err != nil {
+		t.Fatalf("variant is not a valid JPEG: %v", err)
+	}
+	if b := variant.Bounds(); b.Dx() != 320 || b.Dy() != 180 {
+		t.Errorf("variant size = %dx%d, want 320x180", b.Dx(), b.Dy())
+	}
+}
+
+func TestDecode_RejectsTooLarge(t *testing.T) {
+	// Only the header is read before the size check, so a PNG header claiming
+	// huge dimensions is enough
+	ihdr := make([]byte, 0, 17)
+	ihdr = append(ihdr, "IHDR"...)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 6000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 4001)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, 13)
+	data = append(data, ihdr...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+
+	if _, _, err := Decode(data); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode() error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecode_RejectsGarbage(t *testing.T) {
+	if _, _, err := Decode([]byte("definitely not an image")); err == nil {
+		t.Error("Decode() should fail for non-image data")
+	}
+}
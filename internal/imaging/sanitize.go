@@ -0,0 +1,226 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+const sanitizedJPEGQuality = 90
+
+// ErrMalformedWebP is returned when a WebP container cannot be parsed
+var ErrMalformedWebP = errors.New("malformed webp container")
+
+// Sanitized is an image with all embedded metadata removed
+type Sanitized struct {
+	Data        []byte
+	ContentType string
+	// Image is the decoded picture, already rotated upright for JPEGs
+	Image image.Image
+}
+
+// Sanitize removes EXIF, XMP and other metadata (including GPS coordinates)
+// from a JPEG, PNG or WebP image. JPEG and PNG are re-encoded from the decoded
+// pixels, which drops every metadata segment. The JPEG EXIF orientation is
+// applied to the pixels first so photos stay upright without it. WebP cannot
+// be encoded by the standard library, so its metadata chunks are removed from
+// the container instead.
+func Sanitize(data []byte) (*Sanitized, error) {
+	img, format, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		img = applyOrientation(img, jpegOrientation(data))
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: sanitizedJPEGQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return &Sanitized{Data: buf.Bytes(), ContentType: "image/jpeg", Image: img}, nil
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode png: %w", err)
+		}
+		return &Sanitized{Data: buf.Bytes(), ContentType: "image/png", Image: img}, nil
+	case "webp":
+		stripped, err := stripWebPMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Sanitized{Data: stripped, ContentType: "image/webp", Image: img}, nil
+	default:
+		return nil, fmt.Errorf("unsupported image format %q", format)
+	}
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG. It returns 1
+// (upright) when the tag is missing or cannot be parsed.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		// Start of scan: no more metadata segments follow
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		payload := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return exifOrientation(payload[6:])
+		}
+		pos = end
+	}
+	return 1
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// applyOrientation transforms img so that it displays upright without the
+// EXIF orientation tag
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	// img is not used past this point and the caller replaces it with the
+	// result, so the decoded image can be collected before dst is allocated
+	// and at most two full copies are held at once
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			// Map each destination pixel back to its source pixel
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = width-1-x, y
+			case 3:
+				sx, sy = width-1-x, height-1-y
+			case 4:
+				sx, sy = x, height-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, height-1-x
+			case 7:
+				sx, sy = width-1-y, height-1-x
+			case 8:
+				sx, sy = width-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// stripWebPMetadata removes the EXIF and XMP chunks from a WebP container and
+// clears the matching feature flags in the extended header
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformedWebP
+	}
+
+	const (
+		flagXMP  = 0x04
+		flagEXIF = 0x08
+	)
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, ErrMalformedWebP
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if pos+8+size > len(data) {
+			return nil, ErrMalformedWebP
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+			// Dropped
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if size > 0 {
+				chunk[8] &^= flagEXIF | flagXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
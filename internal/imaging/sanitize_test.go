@@ -0,0 +1,186 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifSegment builds a little-endian APP1 EXIF segment holding an orientation
+// tag and some GPS-looking payload
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("GPSLatitude 51.5007N")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func jpegWithExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exifSegment(orientation)...)
+	return append(out, data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	img := testImage(40, 20)
+	if got := jpegOrientation(jpegWithExif(t, img, 6)); got != 6 {
+		t.Errorf("jpegOrientation() = %d, want 6", got)
+	}
+
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, img, nil); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	if got := jpegOrientation(plain.Bytes()); got != 1 {
+		t.Errorf("jpegOrientation() without EXIF = %d, want 1", got)
+	}
+
+	if got := jpegOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF}); got != 1 {
+		t.Errorf("jpegOrientation() with truncated segment = %d, want 1", got)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image with a red pixel in the top left corner
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{R: 255, A: 255}
+	img.Set(0, 0, red)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		redX, redY    int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, tt := range tests {
+		got := applyOrientation(img, tt.orientation)
+		if got.Bounds().Dx() != tt.width || got.Bounds().Dy() != tt.height {
+			t.Errorf("orientation %d: size = %dx%d, want %dx%d",
+				tt.orientation, got.Bounds().Dx(), got.Bounds().Dy(), tt.width, tt.height)
+			continue
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.redX, tt.redY)); c != red {
+			t.Errorf("orientation %d: pixel (%d,%d) = %v, want red", tt.orientation, tt.redX, tt.redY, c)
+		}
+	}
+}
+
+func TestSanitize_JPEG(t *testing.T) {
+	data := jpegWithExif(t, testImage(40, 20), 6)
+
+	sanitized, err := Sanitize(data)
+	if err != nil {
+		t.Fatalf("Sanitize() error = %v", err)
+	}
+	if sanitized.ContentType != "image/jpeg" {
+		t.Errorf("ContentType = %q, want image/jpeg", sanitized.ContentType)
+	}
+	if bytes.Contains(sanitized.Data, []byte("Exif")) || bytes.Contains(sanitized.Data, []byte("GPSLatitude")) {
+		t.Error("sanitized JPEG still contains EXIF data")
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(sanitized.Data))
+	if err != nil {
+		t.Fatalf("sanitized data is not a valid JPEG: %v", err)
+	}
+	if cfg.Width != 20 || cfg.Height != 40 {
+		t.Errorf("sanitized size = %dx%d, want 20x40 after rotation", cfg.Width, cfg.Height)
+	}
+}
+
+func TestSanitize_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(10, 10)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	// Insert a tEXt chunk after the IHDR chunk (8 byte signature + 25 byte IHDR)
+	text := []byte("Location\x00Home address")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, []byte("tEXt")...)
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	data := append(append(append([]byte{}, buf.Bytes()[:33]...), chunk...), buf.Bytes()[33:]...)
+
+	sanitized, err := Sanitize(data)
+	if err != nil {
+		t.Fatalf("Sanitize() error = %v", err)
+	}
+	if sanitized.ContentType != "image/png" {
+		t.Errorf("ContentType = %q, want image/png", sanitized.ContentType)
+	}
+	if bytes.Contains(sanitized.Data, []byte("Home address")) {
+		t.Error("sanitized PNG still contains text metadata")
+	}
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	var body []byte
+	body = append(body, webpChunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 9, 0, 0, 9, 0, 0})...)
+	body = append(body, webpChunk("VP8L", []byte{1, 2, 3})...)
+	body = append(body, webpChunk("EXIF", []byte("GPSLatitude 51.5007N"))...)
+	body = append(body, webpChunk("XMP ", []byte("<x:xmpmeta/>"))...)
+
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	data = append(data, []byte("WEBP")...)
+	data = append(data, body...)
+
+	out, err := stripWebPMetadata(data)
+	if err != nil {
+		t.Fatalf("stripWebPMetadata() error = %v", err)
+	}
+	if bytes.Contains(out, []byte("EXIF")) || bytes.Contains(out, []byte("GPSLatitude")) || bytes.Contains(out, []byte("xmpmeta")) {
+		t.Error("metadata chunks were not removed")
+	}
+	if !bytes.Contains(out, []byte("VP8L")) {
+		t.Error("image chunk was removed")
+	}
+	if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(out)-8)
+	}
+	if flags := out[20]; flags != 0x10 {
+		t.Errorf("VP8X flags = %#x, want 0x10", flags)
+	}
+
+	if _, err := stripWebPMetadata([]byte("RIFF\x10\x00\x00\x00WEBPVP8L\xff\x00\x00\x00")); err != ErrMalformedWebP {
+		t.Errorf("stripWebPMetadata() on truncated chunk error = %v, want ErrMalformedWebP", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package mail delivers transactional email such as password reset links.
+package mail
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	appconfig "github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// ErrInvalidHeader is returned when a recipient or subject would inject
+// additional headers into a message
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// Message is a plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP mailer, or a mailer that only logs messages when no
+// SMTP host is configured
+func New(cfg *appconfig.MailConfig, logger *log.Logger) Mailer {
+	if cfg.SMTPHost == "" {
+		return NewLogMailer(logger)
+	}
+	return NewSMTPMailer(cfg)
+}
+
+// LogMailer writes messages to the log instead of sending them. It is meant
+// for local development.
+type LogMailer struct {
+	logger *log.Logger
+}
+
+// NewLogMailer creates a mailer that logs messages
+func NewLogMailer(logger *log.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send logs the message. The body, which may contain single-use links, is only
+// logged at debug level.
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+	logger := m.logger.WithField("to", msg.To).WithField("subject", msg.Subject)
+	logger.Info("Email not sent, SMTP is not configured")
+	logger.WithField("body", msg.Body).Debug("Email body")
+	return nil
+}
+
+func validateHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	appconfig "github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/config"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// smtpServer is a minimal local SMTP stand-in that accepts one message per
+// connection and records the envelope and data
+type smtpServer struct {
+	listener net.Listener
+	received chan receivedMail
+}
+
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &smtpServer{listener: listener, received: make(chan receivedMail, 1)}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		server.serve(conn)
+	}()
+	return server
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	var mail receivedMail
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mail.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			mail.to = append(mail.to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			mail.data = data.String()
+			s.received <- mail
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) config() *appconfig.MailConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &appconfig.MailConfig{
+		SMTPHost: addr.IP.String(),
+		SMTPPort: addr.Port,
+		From:     "TinySchoolHub <no-reply@example.com>",
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := newSMTPServer(t)
+	mailer := NewSMTPMailer(server.config())
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "parent@example.com",
+		Subject: "Réinitialisation du mot de passe",
+		Body:    "Hello,\nfollow this link.",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	mail := <-server.received
+	if mail.from != "no-reply@example.com" {
+		t.Errorf("MAIL FROM = %q, want no-reply@example.com", mail.from)
+	}
+	if len(mail.to) != 1 || mail.to[0] != "parent@example.com" {
+		t.Errorf("RCPT TO = %v, want [parent@example.com]", mail.to)
+	}
+	for _, want := range []string{
+		"From: \"TinySchoolHub\" <no-reply@example.com>\r\n",
+		"To: <parent@example.com>\r\n",
+		"Subject: =?UTF-8?q?",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\nHello,\r\nfollow this link.",
+	} {
+		if !strings.Contains(mail.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, mail.data)
+		}
+	}
+}
+
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer(&appconfig.MailConfig{SMTPHost: "127.0.0.1", SMTPPort: 1, From: "a@example.com"})
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "parent@example.com\r\nBcc: attacker@example.com",
+		Subject: "Hello",
+	})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Send() error = %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	logger := log.New("error", "json")
+
+	if _, ok := New(&appconfig.MailConfig{}, logger).(*LogMailer); !ok {
+		t.Error("New() without SMTP host should return a LogMailer")
+	}
+
+	cfg := &appconfig.MailConfig{SMTPHost: "smtp.example.com", SMTPPort: 587}
+	mailer, ok := New(cfg, logger).(*SMTPMailer)
+	if !ok {
+		t.Fatal("New() with SMTP host should return an SMTPMailer")
+	}
+	if mailer.host+":"+strconv.Itoa(mailer.port) != "smtp.example.com:587" {
+		t.Errorf("SMTPMailer address = %s:%d", mailer.host, mailer.port)
+	}
+}
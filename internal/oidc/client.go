@@ -0,0 +1,415 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+)
+
+const (
+	// verifierBytes gives a 43 character PKCE code verifier, the minimum
+	// length RFC 7636 allows
+	verifierBytes = 32
+	// jwksRefreshInterval limits how often an unknown kid refetches the
+	// provider's keys
+	jwksRefreshInterval = time.Minute
+	// clockSkew is the leeway for ID token times
+	clockSkew     = time.Minute
+	maxResponse   = 1 << 20
+	httpTimeout   = 10 * time.Second
+	discoveryPath = "/.well-known/openid-configuration"
+)
+
+var (
+	// ErrInvalidIDToken is returned when the provider's ID token fails
+	// verification
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	// ErrExchangeFailed is returned when the provider rejects the
+	// authorization code
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Identity is the verified identity of a user at a provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// discovery is the part of the provider metadata the login flow uses
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client runs the login flow against one provider. Provider metadata and
+// keys are fetched on first use and cached.
+type Client struct {
+	Config     ProviderConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	metadata    *discovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// NewClient creates a client for a validated provider configuration
+func NewClient(cfg ProviderConfig, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: httpTimeout}
+	}
+	return &Client{Config: cfg, httpClient: httpClient}
+}
+
+// Registry holds the clients of all configured providers
+type Registry struct {
+	clients map[string]*Client
+	order   []*Client
+}
+
+// NewRegistry creates a client for each provider
+func NewRegistry(providers []ProviderConfig, httpClient *http.Client) *Registry {
+	reg := &Registry{clients: make(map[string]*Client, len(providers))}
+	for _, cfg := range providers {
+		client := NewClient(cfg, httpClient)
+		reg.clients[cfg.ID] = client
+		reg.order = append(reg.order, client)
+	}
+	return reg
+}
+
+// Get returns the client for a provider ID
+func (reg *Registry) Get(id string) (*Client, error) {
+	client, ok := reg.clients[id]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return client, nil
+}
+
+// List returns the configured providers in configuration order
+func (reg *Registry) List() []*Client {
+	return reg.order
+}
+
+// NewCodeVerifier generates a PKCE code verifier
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, verifierBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge for a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL returns the provider URL that starts the login. state and
+// nonce bind the callback and the ID token to this login attempt.
+func (c *Client) AuthorizationURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.Config.ClientID)
+	query.Set("redirect_uri", c.Config.RedirectURL)
+	query.Set("scope", strings.Join(c.Config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the
+// verified ID token
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	metadata, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.Config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if c.Config.ClientSecret == "" {
+		form.Set("client_id", c.Config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.Config.ClientID), url.QueryEscape(c.Config.ClientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("%w: unreadable token response (status %d)", ErrExchangeFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchangeFailed, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in response", ErrExchangeFailed)
+	}
+
+	return c.verifyIDToken(ctx, metadata, token.IDToken, nonce)
+}
+
+// verifyIDToken checks the ID token signature against the provider's keys and
+// its issuer, audience, expiry and nonce
+func (c *Client) verifyIDToken(ctx context.Context, metadata *discovery, idToken, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return c.publicKey(ctx, metadata, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(c.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	// A token issued to several audiences must name us as the party it was
+	// issued for
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != c.Config.ClientID {
+			return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+		}
+	}
+
+	identity := &Identity{
+		Email:         strings.TrimSpace(stringClaim(claims, "email")),
+		EmailVerified: boolClaim(claims, "email_verified") || c.Config.TrustEmail,
+		Name:          stringClaim(claims, "name"),
+		Groups:        stringsClaim(claims, c.Config.GroupsClaim),
+	}
+	identity.Subject, _ = claims.GetSubject()
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return identity, nil
+}
+
+// discover fetches and caches the provider metadata
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var metadata discovery
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.Config.Issuer, "/")+discoveryPath, &metadata); err != nil {
+		return nil, fmt.Errorf("provider discovery failed: %w", err)
+	}
+	// The issuer must match exactly, or tokens from another tenant of the
+	// same provider could be accepted
+	if metadata.Issuer != c.Config.Issuer {
+		return nil, fmt.Errorf("provider discovery failed: issuer %q does not match %q", metadata.Issuer, c.Config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("provider discovery failed: metadata is incomplete")
+	}
+
+	c.metadata = &metadata
+	return c.metadata, nil
+}
+
+// publicKey returns the provider key for kid. Unknown kids refetch the key
+// set, at most once per jwksRefreshInterval, to pick up key rotations.
+func (c *Client) publicKey(ctx context.Context, metadata *discovery, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.keysFetched) < jwksRefreshInterval {
+		return nil, auth.ErrUnknownKey
+	}
+
+	var set auth.JWKS
+	if err := c.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the set
+		if key, err := parseJWK(jwk); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	c.keys = keys
+	c.keysFetched = time.Now()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, auth.ErrUnknownKey
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(v)
+}
+
+// parseJWK converts an RSA or EC public key from JSON Web Key format
+func parseJWK(jwk auth.JWK) (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) { //nolint:staticcheck // validating untrusted coordinates
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// boolClaim reads a boolean claim. Some providers send booleans as strings.
+func boolClaim(claims jwt.MapClaims, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
+
+// stringsClaim reads a claim holding a list of strings or a single string
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
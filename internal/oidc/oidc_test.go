@@ -0,0 +1,426 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/auth"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+)
+
+const (
+	testClientID    = "tiny-school-hub"
+	testRedirectURL = "https://app.example.com/oidc/callback"
+)
+
+// mockProvider is a minimal OpenID Connect provider that signs in a fixed user
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	grants map[string]url.Values
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{
+		key:    key,
+		kid:    "mock-key",
+		grants: make(map[string]url.Values),
+		claims: jwt.MapClaims{
+			"sub":            "user-123",
+			"email":          "teacher@lincoln.example",
+			"email_verified": true,
+			"name":           "Jane Teacher",
+			"groups":         []string{"staff", "teachers"},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+discoveryPath, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(discovery{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, _ *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(auth.JWKS{Keys: []auth.JWK{{
+			KeyType:   "RSA",
+			KeyID:     p.kid,
+			Use:       "sig",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}}})
+	})
+	// The user is signed in already and approves immediately
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		code := rand.Text()
+		p.mu.Lock()
+		p.grants[code] = query
+		p.mu.Unlock()
+
+		redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != testClientID || secret != "secret" {
+		fail("invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostFormValue("code")]
+	delete(p.grants, r.PostFormValue("code"))
+	claims := jwt.MapClaims{}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	if !ok || r.PostFormValue("redirect_uri") != grant.Get("redirect_uri") {
+		fail("invalid_grant")
+		return
+	}
+	if CodeChallenge(r.PostFormValue("code_verifier")) != grant.Get("code_challenge") {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	defaults := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": grant.Get("nonce"),
+	}
+	for k, v := range defaults {
+		if _, set := claims[k]; !set {
+			claims[k] = v
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		fail("server_error")
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func (p *mockProvider) setClaim(name string, value interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims[name] = value
+}
+
+func (p *mockProvider) config() ProviderConfig {
+	cfg := ProviderConfig{
+		ID:           "lincoln",
+		Issuer:       p.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+	}
+	_ = cfg.validate()
+	return cfg
+}
+
+// login runs the browser part of the flow and returns the code and state the
+// provider redirected back with
+func login(t *testing.T, client *Client, state, nonce, verifier string) (code, returnedState string) {
+	t.Helper()
+
+	authURL, err := client.AuthorizationURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthorizationURL() error = %v", err)
+	}
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := browser.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestClient_Login(t *testing.T) {
+	provider := newMockProvider(t)
+	client := NewClient(provider.config(), nil)
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := login(t, client, "state-1", "nonce-1", verifier)
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+
+	identity, err := client.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if identity.Subject != "user-123" || identity.Email != "teacher@lincoln.example" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+	if identity.Name != "Jane Teacher" || len(identity.Groups) != 2 {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	t.Run("code is single use", func(t *testing.T) {
+		if _, err := client.Exchange(context.Background(), code, verifier, "nonce-1"); !errors.Is(err, ErrExchangeFailed) {
+			t.Errorf("Exchange() error = %v, want ErrExchangeFailed", err)
+		}
+	})
+}
+
+func TestClient_Exchange_Rejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claim    string
+		value    interface{}
+		verifier string
+		nonce    string
+		wantErr  error
+	}{
+		{name: "wrong code verifier", verifier: "wrong-verifier-wrong-verifier-wrong-verifier", wantErr: ErrExchangeFailed},
+		{name: "wrong nonce", nonce: "other-nonce", wantErr: ErrInvalidIDToken},
+		{name: "other audience", claim: "aud", value: "other-client", wantErr: ErrInvalidIDToken},
+		{name: "other issuer", claim: "iss", value: "https://evil.example", wantErr: ErrInvalidIDToken},
+		{name: "expired", claim: "exp", value: time.Now().Add(-time.Hour).Unix(), wantErr: ErrInvalidIDToken},
+		{name: "multiple audiences without azp", claim: "aud", value: []string{testClientID, "other-client"}, wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockProvider(t)
+			if tt.claim != "" {
+				provider.setClaim(tt.claim, tt.value)
+			}
+			client := NewClient(provider.config(), nil)
+
+			verifier, err := NewCodeVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := login(t, client, "state", "nonce", verifier)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			if _, err := client.Exchange(context.Background(), code, verifier, nonce); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_Exchange_KeyRotation(t *testing.T) {
+	provider := newMockProvider(t)
+	client := NewClient(provider.config(), nil)
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := login(t, client, "state", "nonce", verifier)
+	if _, err := client.Exchange(context.Background(), code, verifier, "nonce"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	// The provider rotates to a key the client has not seen yet
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.mu.Lock()
+	provider.key, provider.kid = rotated, "rotated"
+	provider.mu.Unlock()
+
+	code, _ = login(t, client, "state", "nonce", verifier)
+	if _, err := client.Exchange(context.Background(), code, verifier, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange() error = %v, want ErrInvalidIDToken while refetching is throttled", err)
+	}
+
+	client.mu.Lock()
+	client.keysFetched = time.Now().Add(-jwksRefreshInterval)
+	client.mu.Unlock()
+
+	code, _ = login(t, client, "state", "nonce", verifier)
+	if _, err := client.Exchange(context.Background(), code, verifier, "nonce"); err != nil {
+		t.Errorf("Exchange() after refetch error = %v", err)
+	}
+}
+
+func TestClient_DiscoveryIssuerMismatch(t *testing.T) {
+	provider := newMockProvider(t)
+	cfg := provider.config()
+	cfg.Issuer = provider.server.URL + "/"
+	client := NewClient(cfg, nil)
+
+	if _, err := client.AuthorizationURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Error("AuthorizationURL() should fail when the discovered issuer differs")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Example from RFC 7636, appendix B
+	got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallenge() = %s, want %s", got, want)
+	}
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier) != 43 {
+		t.Errorf("verifier length = %d, want 43", len(verifier))
+	}
+}
+
+func TestLoadProviders(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "providers.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	providers, err := LoadProviders(write(t, `[{
+		"id": "lincoln",
+		"issuer": "https://login.lincoln.example",
+		"client_id": "abc",
+		"redirect_url": "https://app.example.com/oidc/callback",
+		"allowed_domains": ["@Lincoln.example"],
+		"role_mappings": {"teachers": "TEACHER"}
+	}]`))
+	if err != nil {
+		t.Fatalf("LoadProviders() error = %v", err)
+	}
+	p := providers[0]
+	if p.Name != "lincoln" || p.GroupsClaim != "groups" || len(p.Scopes) != 3 {
+		t.Errorf("defaults not applied: %+v", p)
+	}
+	if p.AllowedDomains[0] != "lincoln.example" {
+		t.Errorf("AllowedDomains = %v", p.AllowedDomains)
+	}
+
+	invalid := map[string]string{
+		"bad id":       `[{"id": "Lincoln!", "issuer": "https://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb", "allowed_domains": ["a.example"]}]`,
+		"http issuer":  `[{"id": "a", "issuer": "http://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb", "allowed_domains": ["a.example"]}]`,
+		"no client id": `[{"id": "a", "issuer": "https://a.example", "redirect_url": "https://app.example.com/cb", "allowed_domains": ["a.example"]}]`,
+		"bad role":     `[{"id": "a", "issuer": "https://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb", "allowed_domains": ["a.example"], "role_mappings": {"x": "OWNER"}}]`,
+		"duplicate":    `[{"id": "a", "issuer": "https://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb", "allowed_domains": ["a.example"]}, {"id": "a", "issuer": "https://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb", "allowed_domains": ["a.example"]}]`,
+		"no domains":   `[{"id": "a", "issuer": "https://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb"}]`,
+		"empty domain": `[{"id": "a", "issuer": "https://a.example", "client_id": "abc", "redirect_url": "https://app.example.com/cb", "allowed_domains": [" "]}]`,
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadProviders(write(t, content)); err == nil {
+				t.Error("LoadProviders() should fail")
+			}
+		})
+	}
+}
+
+func TestProviderConfig_MappedRole(t *testing.T) {
+	p := ProviderConfig{RoleMappings: map[string]domain.Role{
+		"parents":  domain.RoleParent,
+		"teachers": domain.RoleTeacher,
+		"it-staff": domain.RoleAdmin,
+	}}
+
+	tests := []struct {
+		groups   []string
+		wantRole domain.Role
+		wantOK   bool
+	}{
+		{groups: nil, wantOK: false},
+		{groups: []string{"students"}, wantOK: false},
+		{groups: []string{"parents"}, wantRole: domain.RoleParent, wantOK: true},
+		{groups: []string{"parents", "teachers"}, wantRole: domain.RoleTeacher, wantOK: true},
+		{groups: []string{"it-staff", "teachers"}, wantRole: domain.RoleAdmin, wantOK: true},
+	}
+	for _, tt := range tests {
+		role, ok := p.MappedRole(tt.groups)
+		if role != tt.wantRole || ok != tt.wantOK {
+			t.Errorf("MappedRole(%v) = %s, %v, want %s, %v", tt.groups, role, ok, tt.wantRole, tt.wantOK)
+		}
+	}
+}
+
+func TestProviderConfig_AllowsEmail(t *testing.T) {
+	p := ProviderConfig{AllowedDomains: []string{"lincoln.example"}}
+	if !p.AllowsEmail("Jane@Lincoln.example") {
+		t.Error("AllowsEmail() should allow the configured domain")
+	}
+	if p.AllowsEmail("jane@gmail.com") || p.AllowsEmail("lincoln.example") {
+		t.Error("AllowsEmail() should reject other domains")
+	}
+	if (&ProviderConfig{}).AllowsEmail("jane@gmail.com") {
+		t.Error("AllowsEmail() should allow no domain when none are configured")
+	}
+}
@@ -0,0 +1,185 @@
+// Package oidc implements OpenID Connect login against the identity providers
+// of individual schools, using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+)
+
+// defaultGroupsClaim is the ID token claim that lists the user's groups
+const defaultGroupsClaim = "groups"
+
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ErrUnknownProvider is returned for provider IDs that are not configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// ProviderConfig configures the identity provider of one school
+type ProviderConfig struct {
+	// ID names the provider in URLs, e.g. "lincoln-elementary"
+	ID string `json:"id"`
+	// Name is shown on the login screen
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL is the app page the provider sends the user back to. It must
+	// be registered with the provider.
+	RedirectURL string   `json:"redirect_url"`
+	Scopes      []string `json:"scopes"`
+	// AllowedDomains restricts logins to email addresses in these domains. It
+	// is required, since a provider is trusted to vouch for the addresses and
+	// existing accounts with them are linked to it.
+	AllowedDomains []string `json:"allowed_domains"`
+	// GroupsClaim is the ID token claim with the user's groups, "groups" by
+	// default
+	GroupsClaim string `json:"groups_claim"`
+	// RoleMappings maps provider groups to roles. A user in several mapped
+	// groups gets the most privileged role.
+	RoleMappings map[string]domain.Role `json:"role_mappings"`
+	// DefaultRole is given to new users in no mapped group. Without it, they
+	// cannot sign up through the provider.
+	DefaultRole domain.Role `json:"default_role"`
+	// TrustEmail treats email addresses as verified for providers that only
+	// issue managed accounts but do not send the email_verified claim
+	TrustEmail bool `json:"trust_email"`
+}
+
+// LoadProviders reads provider configurations from a JSON file holding an
+// array of providers
+func LoadProviders(path string) ([]ProviderConfig, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path comes from operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OIDC providers: %w", err)
+	}
+
+	var providers []ProviderConfig
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC providers: %w", err)
+	}
+
+	seen := make(map[string]bool, len(providers))
+	for i := range providers {
+		p := &providers[i]
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("OIDC provider %q: %w", p.ID, err)
+		}
+		if seen[p.ID] {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", p.ID)
+		}
+		seen[p.ID] = true
+	}
+	return providers, nil
+}
+
+func (p *ProviderConfig) validate() error {
+	if !providerIDPattern.MatchString(p.ID) {
+		return errors.New("id must be lower case letters, digits and dashes")
+	}
+	if p.Name == "" {
+		p.Name = p.ID
+	}
+
+	issuer, err := url.Parse(p.Issuer)
+	if err != nil || issuer.Host == "" {
+		return errors.New("issuer must be an absolute URL")
+	}
+	// Plain HTTP is only allowed for local test providers
+	if issuer.Scheme != "https" && !isLoopback(issuer.Hostname()) {
+		return errors.New("issuer must use https")
+	}
+
+	if p.ClientID == "" {
+		return errors.New("client_id is required")
+	}
+	if redirect, err := url.Parse(p.RedirectURL); err != nil || !redirect.IsAbs() {
+		return errors.New("redirect_url must be an absolute URL")
+	}
+
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "email", "profile"}
+	}
+	if !containsString(p.Scopes, "openid") {
+		p.Scopes = append([]string{"openid"}, p.Scopes...)
+	}
+	if p.GroupsClaim == "" {
+		p.GroupsClaim = defaultGroupsClaim
+	}
+
+	for group, role := range p.RoleMappings {
+		if !role.IsValid() {
+			return fmt.Errorf("invalid role %q for group %q", role, group)
+		}
+	}
+	if p.DefaultRole != "" && !p.DefaultRole.IsValid() {
+		return fmt.Errorf("invalid default_role %q", p.DefaultRole)
+	}
+	if len(p.AllowedDomains) == 0 {
+		return errors.New("allowed_domains is required")
+	}
+	for i, domainName := range p.AllowedDomains {
+		p.AllowedDomains[i] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domainName), "@"))
+		if p.AllowedDomains[i] == "" {
+			return errors.New("allowed_domains must not contain empty domains")
+		}
+	}
+	return nil
+}
+
+// AllowsEmail reports whether the provider may log in users with email. No
+// address is allowed when no domains are configured.
+func (p *ProviderConfig) AllowsEmail(email string) bool {
+	_, emailDomain, ok := strings.Cut(strings.ToLower(email), "@")
+	return ok && containsString(p.AllowedDomains, emailDomain)
+}
+
+// MappedRole returns the most privileged role mapped from groups. ok is false
+// when none of the groups is mapped.
+func (p *ProviderConfig) MappedRole(groups []string) (role domain.Role, ok bool) {
+	for _, group := range groups {
+		mapped, found := p.RoleMappings[group]
+		if found && (!ok || rolePriority(mapped) > rolePriority(role)) {
+			role, ok = mapped, true
+		}
+	}
+	return role, ok
+}
+
+func rolePriority(role domain.Role) int {
+	switch role {
+	case domain.RoleAdmin:
+		return 3
+	case domain.RoleTeacher:
+		return 2
+	case domain.RoleParent:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
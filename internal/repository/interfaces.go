@@ -15,6 +15,14 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	Update(ctx context.Context, user *domain.User) error
+	// MarkVerified records that the user verified their email address. It
+	// keeps the original time if the user was already verified.
+	MarkVerified(ctx context.Context, id uuid.UUID, verifiedAt time.Time) error
+	// ReplacePasswordHash swaps in a new hash of the same password. It returns
+	// domain.ErrNotFound if the stored hash is no longer oldHash, for example
+	// because the password was changed in the meantime.
+	ReplacePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error
+	// Delete removes the user and revokes their outstanding access tokens
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -48,12 +56,55 @@ type ClassMemberRepository interface {
 	IsTeacher(ctx context.Context, userID, classID uuid.UUID) (bool, error)
 }
 
+// ClassInviteRepository defines the interface for class invite persistence
+type ClassInviteRepository interface {
+	Create(ctx context.Context, invite *domain.ClassInvite) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.ClassInvite, error)
+	GetByCode(ctx context.Context, code string) (*domain.ClassInvite, error)
+	ListActiveByClass(ctx context.Context, classID uuid.UUID) ([]*domain.ClassInvite, error)
+	Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+}
+
+// ClassJoinRequestRepository defines the interface for class join request persistence
+type ClassJoinRequestRepository interface {
+	Create(ctx context.Context, request *domain.ClassJoinRequest) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.ClassJoinRequest, error)
+	HasPending(ctx context.Context, userID, classID uuid.UUID) (bool, error)
+	ListByClass(ctx context.Context, classID uuid.UUID, status domain.JoinRequestStatus, limit, offset int) ([]*domain.ClassJoinRequest, error)
+	ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.ClassJoinRequest, error)
+	// Decide moves a pending request to status. It returns domain.ErrNotFound
+	// if the request is no longer pending.
+	Decide(ctx context.Context, id uuid.UUID, status domain.JoinRequestStatus, decidedBy uuid.UUID, decidedAt time.Time) error
+	// Reopen moves a decided request back to pending
+	Reopen(ctx context.Context, id uuid.UUID) error
+}
+
 // PhotoRepository defines the interface for photo persistence
 type PhotoRepository interface {
 	Create(ctx context.Context, photo *domain.Photo) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Photo, error)
+	// ListByClass only returns photos whose upload has been confirmed
 	ListByClass(ctx context.Context, classID uuid.UUID, limit, offset int) ([]*domain.Photo, error)
+	ListPendingBefore(ctx context.Context, before time.Time, limit int) ([]*domain.Photo, error)
+	// ListProcessing returns confirmed photos that still need to be sanitized
+	// and resized and that have failed fewer than maxAttempts times
+	ListProcessing(ctx context.Context, maxAttempts, limit int) ([]*domain.Photo, error)
+	UpdateStatus(ctx context.Context, id uuid.UUID, status domain.PhotoStatus) error
+	// ConfirmUpload moves a pending photo to processing. It returns
+	// domain.ErrNotFound if the photo is gone or no longer pending.
+	ConfirmUpload(ctx context.Context, id uuid.UUID) error
+	// MarkProcessed records the sanitized original and makes the photo visible.
+	// It returns domain.ErrNotFound if the photo no longer exists.
+	MarkProcessed(ctx context.Context, id uuid.UUID, contentType string, fileSizeBytes int) error
+	IncrementProcessingAttempts(ctx context.Context, id uuid.UUID) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	// DeleteWithObjects deletes the photo and records the deletions of its
+	// storage objects in one transaction
+	DeleteWithObjects(ctx context.Context, id uuid.UUID, deletions []*domain.StorageDeletion) error
+	// DeletePendingWithObjects is DeleteWithObjects for a photo whose upload
+	// has not been confirmed. It returns domain.ErrNotFound if the photo is
+	// gone or no longer pending.
+	DeletePendingWithObjects(ctx context.Context, id uuid.UUID, deletions []*domain.StorageDeletion) error
 }
 
 // AbsenceRepository defines the interface for absence persistence
@@ -61,6 +112,7 @@ type AbsenceRepository interface {
 	Create(ctx context.Context, absence *domain.Absence) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Absence, error)
 	ListByClass(ctx context.Context, classID uuid.UUID, limit, offset int) ([]*domain.Absence, error)
+	ListByClassAndReporter(ctx context.Context, classID, reporterID uuid.UUID, limit, offset int) ([]*domain.Absence, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status domain.AbsenceStatus) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -70,6 +122,7 @@ type MessageRepository interface {
 	Create(ctx context.Context, message *domain.Message) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Message, error)
 	ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.Message, error)
+	ListByClass(ctx context.Context, classID uuid.UUID, limit, offset int) ([]*domain.Message, error)
 	MarkAsRead(ctx context.Context, id uuid.UUID, readAt time.Time) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -80,6 +133,7 @@ type AnnouncementRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Announcement, error)
 	ListByClass(ctx context.Context, classID *uuid.UUID, limit, offset int) ([]*domain.Announcement, error)
 	ListGlobal(ctx context.Context, limit, offset int) ([]*domain.Announcement, error)
+	ListScheduledByAuthor(ctx context.Context, authorID uuid.UUID, limit, offset int) ([]*domain.Announcement, error)
 	Update(ctx context.Context, announcement *domain.Announcement) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -89,6 +143,206 @@ type RefreshTokenRepository interface {
 	Create(ctx context.Context, token *domain.RefreshToken) error
 	GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
 	Revoke(ctx context.Context, tokenHash string, revokedAt time.Time) error
+	// Rotate revokes the token with oldTokenHash and stores next in one
+	// transaction. It returns domain.ErrNotFound if the old token was already
+	// revoked, which happens when the same token is used twice.
+	Rotate(ctx context.Context, oldTokenHash string, next *domain.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID, revokedAt time.Time) error
 	RevokeAllForUser(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error
 	DeleteExpired(ctx context.Context) error
 }
+
+// SessionRepository defines the interface for login session persistence
+type SessionRepository interface {
+	Create(ctx context.Context, session *domain.Session) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error)
+	ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error)
+	// Touch records a refresh from the given device and extends the session
+	Touch(ctx context.Context, id uuid.UUID, ipAddress, userAgent string, usedAt, expiresAt time.Time) error
+	// Revoke returns domain.ErrNotFound if the session is not active
+	Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error
+}
+
+// UserTokenRepository defines the interface for single-use user token persistence
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *domain.UserToken) error
+	GetByTokenHash(ctx context.Context, purpose domain.UserTokenPurpose, tokenHash string) (*domain.UserToken, error)
+	// MarkUsed returns domain.ErrNotFound if the token was already used or has expired
+	MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+	// InvalidateForUser marks every unused token of the given purpose as used
+	InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose domain.UserTokenPurpose, at time.Time) error
+}
+
+// MFARepository defines the interface for two-factor authentication persistence
+type MFARepository interface {
+	GetFactor(ctx context.Context, userID uuid.UUID) (*domain.MFAFactor, error)
+	// SavePendingFactor creates or replaces a pending factor. It returns
+	// domain.ErrAlreadyExists if the user has an enabled factor.
+	SavePendingFactor(ctx context.Context, factor *domain.MFAFactor) error
+	// EnableFactor confirms a pending factor and replaces the recovery codes.
+	// It returns domain.ErrNotFound if there is no pending factor.
+	EnableFactor(ctx context.Context, userID uuid.UUID, step int64, enabledAt time.Time, codes []*domain.MFARecoveryCode) error
+	// UseStep records an accepted TOTP step. It returns domain.ErrNotFound if
+	// the step, or a later one, was already used.
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) error
+	DeleteFactor(ctx context.Context, userID uuid.UUID) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*domain.MFARecoveryCode) error
+	// UseRecoveryCode returns domain.ErrNotFound if the code does not exist or was used
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) error
+	CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+// MFAChallengeRepository defines the interface for pending login challenge persistence
+type MFAChallengeRepository interface {
+	Create(ctx context.Context, challenge *domain.MFAChallenge) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*domain.MFAChallenge, error)
+	// CountAttempt counts an attempt at the challenge before its code is
+	// checked and returns the updated challenge. It returns
+	// domain.ErrNotFound if the challenge was used, has expired or ran out of
+	// attempts, so concurrent attempts cannot get past the limit.
+	CountAttempt(ctx context.Context, id uuid.UUID, at time.Time) (*domain.MFAChallenge, error)
+	// MarkUsed returns domain.ErrNotFound if the challenge was already used,
+	// has expired or ran out of attempts
+	MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+	// DeleteExpired deletes challenges that expired before now
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// LoginFailureRepository defines the interface for failed login tracking
+type LoginFailureRepository interface {
+	Get(ctx context.Context, scope domain.LoginFailureScope, key string) (*domain.LoginFailure, error)
+	// CountAttempt counts a login attempt before its credentials are checked
+	// and returns the updated record. Attempts are counted from one again if
+	// the last one was before windowStart. The attempt that reaches
+	// maxAttempts locks the key until holdUntil, so no other attempt is let
+	// through while it is checked. It returns domain.ErrLockedOut without
+	// counting if the key is locked at at.
+	CountAttempt(
+		ctx context.Context, scope domain.LoginFailureScope, key string,
+		at, windowStart time.Time, maxAttempts int, holdUntil time.Time,
+	) (*domain.LoginFailure, error)
+	// Release uncounts an attempt that succeeded, lifting the lock it held
+	Release(ctx context.Context, scope domain.LoginFailureScope, key string, held bool) error
+	Lock(ctx context.Context, scope domain.LoginFailureScope, key string, until time.Time) error
+	// Clear forgets the failures and lifts any lockout
+	Clear(ctx context.Context, scope domain.LoginFailureScope, key string) error
+}
+
+// RateLimitRepository defines the interface for request counters shared by all
+// API instances
+type RateLimitRepository interface {
+	// Hit counts a request in a fixed window and returns the requests counted
+	// in it so far and when it started. A window that started before
+	// windowStart is replaced by a new one starting at now.
+	Hit(ctx context.Context, scope domain.RateLimitScope, key string, now, windowStart time.Time) (hits int, startedAt time.Time, err error)
+	// DeleteExpired deletes the counters of windows that started before
+	// windowStart
+	DeleteExpired(ctx context.Context, windowStart time.Time) error
+}
+
+// UserIdentityRepository defines the interface for OpenID Connect identity persistence
+type UserIdentityRepository interface {
+	// Create links the identity. It returns domain.ErrAlreadyExists if the
+	// provider account is already linked.
+	Create(ctx context.Context, identity *domain.UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.UserIdentity, error)
+	RecordLogin(ctx context.Context, id uuid.UUID, email string, at time.Time) error
+}
+
+// OIDCLoginStateRepository defines the interface for pending OpenID Connect logins
+type OIDCLoginStateRepository interface {
+	Create(ctx context.Context, state *domain.OIDCLoginState) error
+	// Consume marks the login state used and returns it. It returns
+	// domain.ErrNotFound if the state is unknown, used or expired.
+	Consume(ctx context.Context, stateHash string, usedAt time.Time) (*domain.OIDCLoginState, error)
+	// DeleteExpired deletes login states that expired before now
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// WebAuthnCredentialRepository defines the interface for passkey persistence
+type WebAuthnCredentialRepository interface {
+	// Create stores the credential. It returns domain.ErrAlreadyExists if the
+	// credential ID is already registered.
+	Create(ctx context.Context, credential *domain.WebAuthnCredential) error
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.WebAuthnCredential, error)
+	// UpdateSignCount stores the counter of a login. It returns
+	// domain.ErrNotFound if the counter changed since oldCount was read.
+	UpdateSignCount(ctx context.Context, id uuid.UUID, oldCount, newCount uint32, usedAt time.Time) error
+	// Delete returns domain.ErrNotFound if the user has no such credential
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+}
+
+// WebAuthnChallengeRepository defines the interface for pending WebAuthn ceremonies
+type WebAuthnChallengeRepository interface {
+	Create(ctx context.Context, challenge *domain.WebAuthnChallenge) error
+	// Consume marks the challenge used and returns it. It returns
+	// domain.ErrNotFound if the challenge is unknown, used, expired or was
+	// issued for another ceremony.
+	Consume(ctx context.Context, challengeHash string, ceremony domain.WebAuthnCeremony, usedAt time.Time) (*domain.WebAuthnChallenge, error)
+	// DeleteExpired deletes challenges that expired before now
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// APIKeyRepository defines the interface for API key persistence
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *domain.APIKey) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.APIKey, error)
+	GetByKeyHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	// List returns keys that have not been revoked, newest first
+	List(ctx context.Context, limit, offset int) ([]*domain.APIKey, error)
+	MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+	// Revoke returns domain.ErrNotFound if the key does not exist or was
+	// already revoked
+	Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+}
+
+// AccessTokenRevocationRepository defines the interface for access token
+// revocation persistence
+type AccessTokenRevocationRepository interface {
+	// Revoke invalidates the user's access tokens issued before validAfter. An
+	// earlier time never replaces a later one.
+	Revoke(ctx context.Context, userID uuid.UUID, validAfter time.Time) error
+	// ListSince returns the revocations with a ValidAfter after since
+	ListSince(ctx context.Context, since time.Time) ([]*domain.AccessTokenRevocation, error)
+}
+
+// SecurityEventRepository defines the interface for security event persistence
+type SecurityEventRepository interface {
+	Create(ctx context.Context, event *domain.SecurityEvent) error
+	ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.SecurityEvent, error)
+}
+
+// RoleInvitationRepository defines the interface for role invitation persistence
+type RoleInvitationRepository interface {
+	Create(ctx context.Context, invitation *domain.RoleInvitation) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.RoleInvitation, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RoleInvitation, error)
+	ListPending(ctx context.Context, limit, offset int) ([]*domain.RoleInvitation, error)
+	// MarkUsed redeems the invitation. It returns domain.ErrNotFound if the
+	// invitation was already used or revoked in the meantime.
+	MarkUsed(ctx context.Context, id, usedBy uuid.UUID, usedAt time.Time) error
+	Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+}
+
+// RoleChangeRepository defines the interface for role change persistence
+type RoleChangeRepository interface {
+	// Apply updates the user's role, records the change and revokes the user's
+	// outstanding access tokens in one transaction. It returns
+	// domain.ErrNotFound if the user no longer has change.OldRole.
+	Apply(ctx context.Context, change *domain.RoleChange) error
+	ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.RoleChange, error)
+}
+
+// StorageDeletionRepository defines the interface for pending storage deletions
+type StorageDeletionRepository interface {
+	Create(ctx context.Context, deletions []*domain.StorageDeletion) error
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.StorageDeletion, error)
+	MarkFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	// DeleteByObjectKey cancels the pending deletions of an object. It returns
+	// domain.ErrNotFound if none is pending.
+	DeleteByObjectKey(ctx context.Context, objectKey string) error
+}
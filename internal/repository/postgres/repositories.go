@@ -59,10 +59,10 @@ func NewUserRepo(db *DB) repository.UserRepository {
 
 func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
 	query := `
-		INSERT INTO users (id, email, password_hash, role, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (id, email, password_hash, role, verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.Role, user.CreatedAt, user.UpdatedAt)
+	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.Role, user.VerifiedAt, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -70,9 +70,9 @@ func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
 }
 
 func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
-	query := `SELECT id, email, password_hash, role, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, email, password_hash, role, verified_at, created_at, updated_at FROM users WHERE id = $1`
 	user := &domain.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.VerifiedAt, &user.CreatedAt, &user.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrNotFound
 	}
@@ -83,9 +83,9 @@ func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, err
 }
 
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `SELECT id, email, password_hash, role, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, email, password_hash, role, verified_at, created_at, updated_at FROM users WHERE email = $1`
 	user := &domain.User{}
-	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.VerifiedAt, &user.CreatedAt, &user.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrNotFound
 	}
@@ -101,12 +101,46 @@ func (r *UserRepo) Update(ctx context.Context, user *domain.User) error {
 	return err
 }
 
-func (r *UserRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+func (r *UserRepo) MarkVerified(ctx context.Context, id uuid.UUID, verifiedAt time.Time) error {
+	query := `UPDATE users SET verified_at = COALESCE(verified_at, $1), updated_at = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, verifiedAt, id)
 	return err
 }
 
+func (r *UserRepo) ReplacePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`
+	result, err := r.db.ExecContext(ctx, query, newHash, id, oldHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, revokeAccessTokensQuery, id, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 // ProfileRepo implements repository.ProfileRepository
 type ProfileRepo struct {
 	db *DB
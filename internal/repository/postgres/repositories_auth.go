@@ -0,0 +1,1062 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+)
+
+// RoleInvitationRepo implements repository.RoleInvitationRepository
+type RoleInvitationRepo struct {
+	db *DB
+}
+
+func NewRoleInvitationRepo(db *DB) repository.RoleInvitationRepository {
+	return &RoleInvitationRepo{db: db}
+}
+
+const roleInvitationColumns = `id, email, role, token_hash, created_by, expires_at, used_at, used_by, revoked_at, created_at`
+
+func scanRoleInvitation(row interface{ Scan(...any) error }) (*domain.RoleInvitation, error) {
+	inv := &domain.RoleInvitation{}
+	err := row.Scan(&inv.ID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.CreatedBy, &inv.ExpiresAt, &inv.UsedAt, &inv.UsedBy, &inv.RevokedAt, &inv.CreatedAt)
+	return inv, err
+}
+
+func (r *RoleInvitationRepo) Create(ctx context.Context, inv *domain.RoleInvitation) error {
+	query := `INSERT INTO role_invitations (id, email, role, token_hash, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, inv.ID, inv.Email, inv.Role, inv.TokenHash, inv.CreatedBy, inv.ExpiresAt, inv.CreatedAt)
+	return err
+}
+
+func (r *RoleInvitationRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.RoleInvitation, error) {
+	query := `SELECT ` + roleInvitationColumns + ` FROM role_invitations WHERE id = $1`
+	inv, err := scanRoleInvitation(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return inv, err
+}
+
+func (r *RoleInvitationRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RoleInvitation, error) {
+	query := `SELECT ` + roleInvitationColumns + ` FROM role_invitations WHERE token_hash = $1`
+	inv, err := scanRoleInvitation(r.db.QueryRowContext(ctx, query, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return inv, err
+}
+
+func (r *RoleInvitationRepo) ListPending(ctx context.Context, limit, offset int) ([]*domain.RoleInvitation, error) {
+	query := `SELECT ` + roleInvitationColumns + ` FROM role_invitations
+		WHERE used_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*domain.RoleInvitation
+	for rows.Next() {
+		inv, err := scanRoleInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *RoleInvitationRepo) MarkUsed(ctx context.Context, id, usedBy uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE role_invitations SET used_at = $1, used_by = $2
+		WHERE id = $3 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $1`
+	result, err := r.db.ExecContext(ctx, query, usedAt, usedBy, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *RoleInvitationRepo) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE role_invitations SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, revokedAt, id)
+	return err
+}
+
+// RoleChangeRepo implements repository.RoleChangeRepository
+type RoleChangeRepo struct {
+	db *DB
+}
+
+func NewRoleChangeRepo(db *DB) repository.RoleChangeRepository {
+	return &RoleChangeRepo{db: db}
+}
+
+func (r *RoleChangeRepo) Apply(ctx context.Context, change *domain.RoleChange) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3 AND role = $4`,
+		change.NewRole, change.CreatedAt, change.UserID, change.OldRole)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	query := `INSERT INTO role_changes (id, user_id, old_role, new_role, changed_by, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := tx.ExecContext(ctx, query, change.ID, change.UserID, change.OldRole, change.NewRole, change.ChangedBy, change.Reason, change.CreatedAt); err != nil {
+		return fmt.Errorf("failed to record role change: %w", err)
+	}
+
+	// Tokens issued before the change still carry the old role
+	if _, err := tx.ExecContext(ctx, revokeAccessTokensQuery, change.UserID, change.CreatedAt); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *RoleChangeRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.RoleChange, error) {
+	query := `SELECT id, user_id, old_role, new_role, changed_by, reason, created_at
+		FROM role_changes WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*domain.RoleChange
+	for rows.Next() {
+		change := &domain.RoleChange{}
+		if err := rows.Scan(&change.ID, &change.UserID, &change.OldRole, &change.NewRole, &change.ChangedBy, &change.Reason, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// SessionRepo implements repository.SessionRepository
+type SessionRepo struct {
+	db *DB
+}
+
+func NewSessionRepo(db *DB) repository.SessionRepository {
+	return &SessionRepo{db: db}
+}
+
+const sessionColumns = `id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at`
+
+func scanSession(row interface{ Scan(...any) error }) (*domain.Session, error) {
+	s := &domain.Session{}
+	err := row.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt)
+	return s, err
+}
+
+func (r *SessionRepo) Create(ctx context.Context, s *domain.Session) error {
+	query := `INSERT INTO sessions (` + sessionColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := r.db.ExecContext(ctx, query, s.ID, s.UserID, s.UserAgent, s.IPAddress, s.CreatedAt, s.LastUsedAt, s.ExpiresAt, s.RevokedAt)
+	return err
+}
+
+func (r *SessionRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	s, err := scanSession(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return s, err
+}
+
+func (r *SessionRepo) ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*domain.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepo) Touch(ctx context.Context, id uuid.UUID, ipAddress, userAgent string, usedAt, expiresAt time.Time) error {
+	query := `UPDATE sessions SET ip_address = $1, user_agent = $2, last_used_at = $3, expires_at = $4
+		WHERE id = $5 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, ipAddress, userAgent, usedAt, expiresAt, id)
+	return err
+}
+
+func (r *SessionRepo) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, revokedAt, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *SessionRepo) RevokeAllForUser(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, revokedAt, userID)
+	return err
+}
+
+// UserTokenRepo implements repository.UserTokenRepository
+type UserTokenRepo struct {
+	db *DB
+}
+
+func NewUserTokenRepo(db *DB) repository.UserTokenRepository {
+	return &UserTokenRepo{db: db}
+}
+
+func (r *UserTokenRepo) Create(ctx context.Context, token *domain.UserToken) error {
+	query := `INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (r *UserTokenRepo) GetByTokenHash(ctx context.Context, purpose domain.UserTokenPurpose, tokenHash string) (*domain.UserToken, error) {
+	query := `SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at
+		FROM user_tokens WHERE purpose = $1 AND token_hash = $2`
+	token := &domain.UserToken{}
+	err := r.db.QueryRowContext(ctx, query, purpose, tokenHash).Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash,
+		&token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return token, err
+}
+
+func (r *UserTokenRepo) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL AND expires_at > $1`
+	result, err := r.db.ExecContext(ctx, query, usedAt, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserTokenRepo) InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose domain.UserTokenPurpose, at time.Time) error {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, at, userID, purpose)
+	return err
+}
+
+// MFARepo implements repository.MFARepository
+type MFARepo struct {
+	db *DB
+}
+
+func NewMFARepo(db *DB) repository.MFARepository {
+	return &MFARepo{db: db}
+}
+
+func (r *MFARepo) GetFactor(ctx context.Context, userID uuid.UUID) (*domain.MFAFactor, error) {
+	query := `SELECT user_id, secret, last_used_step, enabled_at, created_at FROM mfa_factors WHERE user_id = $1`
+	factor := &domain.MFAFactor{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&factor.UserID, &factor.Secret, &factor.LastUsedStep,
+		&factor.EnabledAt, &factor.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return factor, err
+}
+
+func (r *MFARepo) SavePendingFactor(ctx context.Context, factor *domain.MFAFactor) error {
+	query := `INSERT INTO mfa_factors (user_id, secret, last_used_step, enabled_at, created_at)
+		VALUES ($1, $2, 0, NULL, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = EXCLUDED.created_at
+		WHERE mfa_factors.enabled_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, factor.UserID, factor.Secret, factor.CreatedAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *MFARepo) EnableFactor(
+	ctx context.Context, userID uuid.UUID, step int64, enabledAt time.Time, codes []*domain.MFARecoveryCode,
+) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `UPDATE mfa_factors SET enabled_at = $1, last_used_step = $2
+		WHERE user_id = $3 AND enabled_at IS NULL`, enabledAt, step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable factor: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *MFARepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `UPDATE mfa_factors SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+	result, err := r.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *MFARepo) DeleteFactor(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_factors WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete factor: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *MFARepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*domain.MFARecoveryCode) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes deletes every recovery code of the user and stores codes
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uuid.UUID, codes []*domain.MFARecoveryCode) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	query := `INSERT INTO mfa_recovery_codes (id, user_id, code_hash, used_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, query, code.ID, code.UserID, code.CodeHash, code.UsedAt, code.CreatedAt); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) error {
+	query := `UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, usedAt, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *MFARepo) CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	var count int
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MFAChallengeRepo implements repository.MFAChallengeRepository
+type MFAChallengeRepo struct {
+	db *DB
+}
+
+func NewMFAChallengeRepo(db *DB) repository.MFAChallengeRepository {
+	return &MFAChallengeRepo{db: db}
+}
+
+func (r *MFAChallengeRepo) Create(ctx context.Context, c *domain.MFAChallenge) error {
+	query := `INSERT INTO mfa_challenges (id, user_id, token_hash, attempts, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, c.ID, c.UserID, c.TokenHash, c.Attempts, c.ExpiresAt, c.UsedAt, c.CreatedAt)
+	return err
+}
+
+func (r *MFAChallengeRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.MFAChallenge, error) {
+	query := `SELECT id, user_id, token_hash, attempts, expires_at, used_at, created_at
+		FROM mfa_challenges WHERE token_hash = $1`
+	c := &domain.MFAChallenge{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&c.ID, &c.UserID, &c.TokenHash, &c.Attempts,
+		&c.ExpiresAt, &c.UsedAt, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return c, err
+}
+
+func (r *MFAChallengeRepo) CountAttempt(ctx context.Context, id uuid.UUID, at time.Time) (*domain.MFAChallenge, error) {
+	query := `UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE id = $1 AND used_at IS NULL AND expires_at > $2 AND attempts < $3
+		RETURNING id, user_id, token_hash, attempts, expires_at, used_at, created_at`
+	c := &domain.MFAChallenge{}
+	err := r.db.QueryRowContext(ctx, query, id, at, domain.MaxMFAChallengeAttempts).Scan(&c.ID, &c.UserID,
+		&c.TokenHash, &c.Attempts, &c.ExpiresAt, &c.UsedAt, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return c, err
+}
+
+// MarkUsed accepts a challenge whose last allowed attempt is the one being
+// completed, since attempts are counted before the code is checked
+func (r *MFAChallengeRepo) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE mfa_challenges SET used_at = $1
+		WHERE id = $2 AND used_at IS NULL AND expires_at > $1 AND attempts <= $3`
+	result, err := r.db.ExecContext(ctx, query, usedAt, id, domain.MaxMFAChallengeAttempts)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *MFAChallengeRepo) DeleteExpired(ctx context.Context, now time.Time) error {
+	query := `DELETE FROM mfa_challenges WHERE expires_at < $1`
+	_, err := r.db.ExecContext(ctx, query, now)
+	return err
+}
+
+// LoginFailureRepo implements repository.LoginFailureRepository
+type LoginFailureRepo struct {
+	db *DB
+}
+
+func NewLoginFailureRepo(db *DB) repository.LoginFailureRepository {
+	return &LoginFailureRepo{db: db}
+}
+
+func (r *LoginFailureRepo) Get(ctx context.Context, scope domain.LoginFailureScope, key string) (*domain.LoginFailure, error) {
+	query := `SELECT scope, key, failures, last_failed_at, locked_until FROM login_failures WHERE scope = $1 AND key = $2`
+	failure := &domain.LoginFailure{}
+	err := r.db.QueryRowContext(ctx, query, scope, key).Scan(&failure.Scope, &failure.Key, &failure.Failures,
+		&failure.LastFailedAt, &failure.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login failures: %w", err)
+	}
+	return failure, nil
+}
+
+func (r *LoginFailureRepo) CountAttempt(
+	ctx context.Context, scope domain.LoginFailureScope, key string,
+	at, windowStart time.Time, maxAttempts int, holdUntil time.Time,
+) (*domain.LoginFailure, error) {
+	// The conflict update only applies to an unlocked row and runs with the
+	// row locked, so concurrent attempts cannot all pass the lockout check
+	query := `INSERT INTO login_failures (scope, key, failures, last_failed_at, locked_until)
+		VALUES ($1, $2, 1, $3, CASE WHEN $5::int <= 1 THEN $6::timestamptz END)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failed_at < $4 THEN 1 ELSE login_failures.failures + 1 END,
+			last_failed_at = EXCLUDED.last_failed_at,
+			locked_until = CASE
+				WHEN (CASE WHEN login_failures.last_failed_at < $4 THEN 1 ELSE login_failures.failures + 1 END) >= $5
+				THEN $6::timestamptz
+			END
+		WHERE login_failures.locked_until IS NULL OR login_failures.locked_until <= $3
+		RETURNING scope, key, failures, last_failed_at, locked_until`
+	failure := &domain.LoginFailure{}
+	err := r.db.QueryRowContext(ctx, query, scope, key, at, windowStart, maxAttempts, holdUntil).Scan(
+		&failure.Scope, &failure.Key, &failure.Failures, &failure.LastFailedAt, &failure.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrLockedOut
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to count login attempt: %w", err)
+	}
+	return failure, nil
+}
+
+func (r *LoginFailureRepo) Release(ctx context.Context, scope domain.LoginFailureScope, key string, held bool) error {
+	query := `UPDATE login_failures SET failures = GREATEST(failures - 1, 0),
+			locked_until = CASE WHEN $3 THEN NULL ELSE locked_until END
+		WHERE scope = $1 AND key = $2`
+	_, err := r.db.ExecContext(ctx, query, scope, key, held)
+	return err
+}
+
+func (r *LoginFailureRepo) Lock(ctx context.Context, scope domain.LoginFailureScope, key string, until time.Time) error {
+	query := `UPDATE login_failures SET locked_until = $1 WHERE scope = $2 AND key = $3`
+	_, err := r.db.ExecContext(ctx, query, until, scope, key)
+	return err
+}
+
+func (r *LoginFailureRepo) Clear(ctx context.Context, scope domain.LoginFailureScope, key string) error {
+	query := `DELETE FROM login_failures WHERE scope = $1 AND key = $2`
+	_, err := r.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// RateLimitRepo implements repository.RateLimitRepository
+type RateLimitRepo struct {
+	db *DB
+}
+
+func NewRateLimitRepo(db *DB) repository.RateLimitRepository {
+	return &RateLimitRepo{db: db}
+}
+
+func (r *RateLimitRepo) Hit(
+	ctx context.Context, scope domain.RateLimitScope, key string, now, windowStart time.Time,
+) (int, time.Time, error) {
+	query := `INSERT INTO rate_limits (scope, key, window_start, hits) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			hits = CASE WHEN rate_limits.window_start < $4 THEN 1 ELSE rate_limits.hits + 1 END,
+			window_start = CASE WHEN rate_limits.window_start < $4 THEN EXCLUDED.window_start ELSE rate_limits.window_start END
+		RETURNING hits, window_start`
+	var (
+		hits      int
+		startedAt time.Time
+	)
+	if err := r.db.QueryRowContext(ctx, query, scope, key, now, windowStart).Scan(&hits, &startedAt); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count request: %w", err)
+	}
+	return hits, startedAt, nil
+}
+
+func (r *RateLimitRepo) DeleteExpired(ctx context.Context, windowStart time.Time) error {
+	query := `DELETE FROM rate_limits WHERE window_start < $1`
+	_, err := r.db.ExecContext(ctx, query, windowStart)
+	return err
+}
+
+// UserIdentityRepo implements repository.UserIdentityRepository
+type UserIdentityRepo struct {
+	db *DB
+}
+
+func NewUserIdentityRepo(db *DB) repository.UserIdentityRepository {
+	return &UserIdentityRepo{db: db}
+}
+
+const userIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanUserIdentity(row interface{ Scan(...any) error }) (*domain.UserIdentity, error) {
+	identity := &domain.UserIdentity{}
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+		&identity.CreatedAt, &identity.LastLoginAt)
+	return identity, err
+}
+
+func (r *UserIdentityRepo) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	query := `INSERT INTO user_identities (` + userIdentityColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (provider, subject) DO NOTHING`
+	result, err := r.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.Subject,
+		identity.Email, identity.CreatedAt, identity.LastLoginAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *UserIdentityRepo) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+	identity, err := scanUserIdentity(r.db.QueryRowContext(ctx, query, provider, subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return identity, err
+}
+
+func (r *UserIdentityRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.UserIdentity, error) {
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*domain.UserIdentity
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *UserIdentityRepo) RecordLogin(ctx context.Context, id uuid.UUID, email string, at time.Time) error {
+	query := `UPDATE user_identities SET email = $1, last_login_at = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, email, at, id)
+	return err
+}
+
+// OIDCLoginStateRepo implements repository.OIDCLoginStateRepository
+type OIDCLoginStateRepo struct {
+	db *DB
+}
+
+func NewOIDCLoginStateRepo(db *DB) repository.OIDCLoginStateRepository {
+	return &OIDCLoginStateRepo{db: db}
+}
+
+func (r *OIDCLoginStateRepo) Create(ctx context.Context, state *domain.OIDCLoginState) error {
+	query := `INSERT INTO oidc_login_states (id, provider, state_hash, code_verifier, nonce, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := r.db.ExecContext(ctx, query, state.ID, state.Provider, state.StateHash, state.CodeVerifier,
+		state.Nonce, state.ExpiresAt, state.UsedAt, state.CreatedAt)
+	return err
+}
+
+func (r *OIDCLoginStateRepo) Consume(ctx context.Context, stateHash string, usedAt time.Time) (*domain.OIDCLoginState, error) {
+	query := `UPDATE oidc_login_states SET used_at = $1
+		WHERE state_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING id, provider, state_hash, code_verifier, nonce, expires_at, used_at, created_at`
+	state := &domain.OIDCLoginState{}
+	err := r.db.QueryRowContext(ctx, query, usedAt, stateHash).Scan(&state.ID, &state.Provider, &state.StateHash,
+		&state.CodeVerifier, &state.Nonce, &state.ExpiresAt, &state.UsedAt, &state.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume login state: %w", err)
+	}
+	return state, nil
+}
+
+func (r *OIDCLoginStateRepo) DeleteExpired(ctx context.Context, now time.Time) error {
+	query := `DELETE FROM oidc_login_states WHERE expires_at < $1`
+	_, err := r.db.ExecContext(ctx, query, now)
+	return err
+}
+
+// WebAuthnCredentialRepo implements repository.WebAuthnCredentialRepository
+type WebAuthnCredentialRepo struct {
+	db *DB
+}
+
+func NewWebAuthnCredentialRepo(db *DB) repository.WebAuthnCredentialRepository {
+	return &WebAuthnCredentialRepo{db: db}
+}
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, sign_count, aaguid, name, created_at, last_used_at`
+
+func scanWebAuthnCredential(row interface{ Scan(...any) error }) (*domain.WebAuthnCredential, error) {
+	credential := &domain.WebAuthnCredential{}
+	var signCount int64
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.CredentialID, &credential.PublicKey, &signCount,
+		&credential.AAGUID, &credential.Name, &credential.CreatedAt, &credential.LastUsedAt)
+	credential.SignCount = uint32(signCount) //nolint:gosec // stored from a uint32
+	return credential, err
+}
+
+func (r *WebAuthnCredentialRepo) Create(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	query := `INSERT INTO webauthn_credentials (` + webAuthnCredentialColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (credential_id) DO NOTHING`
+	result, err := r.db.ExecContext(ctx, query, credential.ID, credential.UserID, credential.CredentialID,
+		credential.PublicKey, int64(credential.SignCount), credential.AAGUID, credential.Name, credential.CreatedAt,
+		credential.LastUsedAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *WebAuthnCredentialRepo) GetByCredentialID(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE credential_id = $1`
+	credential, err := scanWebAuthnCredential(r.db.QueryRowContext(ctx, query, credentialID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return credential, err
+}
+
+func (r *WebAuthnCredentialRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []*domain.WebAuthnCredential
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *WebAuthnCredentialRepo) UpdateSignCount(ctx context.Context, id uuid.UUID, oldCount, newCount uint32, usedAt time.Time) error {
+	query := `UPDATE webauthn_credentials SET sign_count = $1, last_used_at = $2 WHERE id = $3 AND sign_count = $4`
+	result, err := r.db.ExecContext(ctx, query, int64(newCount), usedAt, id, int64(oldCount))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *WebAuthnCredentialRepo) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// WebAuthnChallengeRepo implements repository.WebAuthnChallengeRepository
+type WebAuthnChallengeRepo struct {
+	db *DB
+}
+
+func NewWebAuthnChallengeRepo(db *DB) repository.WebAuthnChallengeRepository {
+	return &WebAuthnChallengeRepo{db: db}
+}
+
+func (r *WebAuthnChallengeRepo) Create(ctx context.Context, challenge *domain.WebAuthnChallenge) error {
+	query := `INSERT INTO webauthn_challenges (id, user_id, ceremony, challenge_hash, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, challenge.ID, challenge.UserID, challenge.Ceremony, challenge.ChallengeHash,
+		challenge.ExpiresAt, challenge.UsedAt, challenge.CreatedAt)
+	return err
+}
+
+func (r *WebAuthnChallengeRepo) Consume(
+	ctx context.Context, challengeHash string, ceremony domain.WebAuthnCeremony, usedAt time.Time,
+) (*domain.WebAuthnChallenge, error) {
+	query := `UPDATE webauthn_challenges SET used_at = $1
+		WHERE challenge_hash = $2 AND ceremony = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING id, user_id, ceremony, challenge_hash, expires_at, used_at, created_at`
+	challenge := &domain.WebAuthnChallenge{}
+	err := r.db.QueryRowContext(ctx, query, usedAt, challengeHash, ceremony).Scan(&challenge.ID, &challenge.UserID,
+		&challenge.Ceremony, &challenge.ChallengeHash, &challenge.ExpiresAt, &challenge.UsedAt, &challenge.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume WebAuthn challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+func (r *WebAuthnChallengeRepo) DeleteExpired(ctx context.Context, now time.Time) error {
+	query := `DELETE FROM webauthn_challenges WHERE expires_at < $1`
+	_, err := r.db.ExecContext(ctx, query, now)
+	return err
+}
+
+// APIKeyRepo implements repository.APIKeyRepository
+type APIKeyRepo struct {
+	db *DB
+}
+
+func NewAPIKeyRepo(db *DB) repository.APIKeyRepository {
+	return &APIKeyRepo{db: db}
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, allowed_ips, expires_at, last_used_at, created_by, revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	var scopes, allowedIPs []byte
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &allowedIPs,
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedBy, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode API key scopes: %w", err)
+	}
+	if err := json.Unmarshal(allowedIPs, &key.AllowedIPs); err != nil {
+		return nil, fmt.Errorf("failed to decode API key allowed IPs: %w", err)
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepo) Create(ctx context.Context, key *domain.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return fmt.Errorf("failed to encode API key scopes: %w", err)
+	}
+	allowedIPs := key.AllowedIPs
+	if allowedIPs == nil {
+		allowedIPs = []string{}
+	}
+	allowedIPsJSON, err := json.Marshal(allowedIPs)
+	if err != nil {
+		return fmt.Errorf("failed to encode API key allowed IPs: %w", err)
+	}
+
+	query := `INSERT INTO api_keys (` + apiKeyColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err = r.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, scopes, allowedIPsJSON,
+		key.ExpiresAt, key.LastUsedAt, key.CreatedBy, key.RevokedAt, key.CreatedAt)
+	return err
+}
+
+func (r *APIKeyRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return key, err
+}
+
+func (r *APIKeyRepo) GetByKeyHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return key, err
+}
+
+func (r *APIKeyRepo) List(ctx context.Context, limit, offset int) ([]*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE revoked_at IS NULL
+		ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepo) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, usedAt, id)
+	return err
+}
+
+func (r *APIKeyRepo) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, revokedAt, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// revokeAccessTokensQuery records an access token revocation without moving an
+// existing one back in time
+const revokeAccessTokensQuery = `INSERT INTO access_token_revocations (user_id, valid_after) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET valid_after = GREATEST(access_token_revocations.valid_after, EXCLUDED.valid_after)`
+
+// AccessTokenRevocationRepo implements repository.AccessTokenRevocationRepository
+type AccessTokenRevocationRepo struct {
+	db *DB
+}
+
+func NewAccessTokenRevocationRepo(db *DB) repository.AccessTokenRevocationRepository {
+	return &AccessTokenRevocationRepo{db: db}
+}
+
+func (r *AccessTokenRevocationRepo) Revoke(ctx context.Context, userID uuid.UUID, validAfter time.Time) error {
+	_, err := r.db.ExecContext(ctx, revokeAccessTokensQuery, userID, validAfter)
+	return err
+}
+
+func (r *AccessTokenRevocationRepo) ListSince(ctx context.Context, since time.Time) ([]*domain.AccessTokenRevocation, error) {
+	query := `SELECT user_id, valid_after FROM access_token_revocations WHERE valid_after > $1`
+	rows, err := r.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revocations []*domain.AccessTokenRevocation
+	for rows.Next() {
+		revocation := &domain.AccessTokenRevocation{}
+		if err := rows.Scan(&revocation.UserID, &revocation.ValidAfter); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+	return revocations, rows.Err()
+}
+
+// SecurityEventRepo implements repository.SecurityEventRepository
+type SecurityEventRepo struct {
+	db *DB
+}
+
+func NewSecurityEventRepo(db *DB) repository.SecurityEventRepository {
+	return &SecurityEventRepo{db: db}
+}
+
+func (r *SecurityEventRepo) Create(ctx context.Context, event *domain.SecurityEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode event details: %w", err)
+	}
+
+	query := `INSERT INTO security_events (id, user_id, type, ip_address, user_agent, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = r.db.ExecContext(ctx, query, event.ID, event.UserID, event.Type, event.IPAddress, event.UserAgent, details, event.CreatedAt)
+	return err
+}
+
+func (r *SecurityEventRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.SecurityEvent, error) {
+	query := `SELECT id, user_id, type, ip_address, user_agent, details, created_at
+		FROM security_events WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.SecurityEvent
+	for rows.Next() {
+		event := &domain.SecurityEvent{}
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.IPAddress, &event.UserAgent, &details, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(details, &event.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode event details: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,16 +23,16 @@ func NewPhotoRepo(db *DB) repository.PhotoRepository {
 }
 
 func (r *PhotoRepo) Create(ctx context.Context, photo *domain.Photo) error {
-	query := `INSERT INTO photos (id, class_id, uploader_id, caption, media_key, content_type, file_size_bytes, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := r.db.ExecContext(ctx, query, photo.ID, photo.ClassID, photo.UploaderID, photo.Caption, photo.MediaKey, photo.ContentType, photo.FileSizeBytes, photo.CreatedAt)
+	query := `INSERT INTO photos (id, class_id, uploader_id, caption, media_key, content_type, file_size_bytes, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := r.db.ExecContext(ctx, query, photo.ID, photo.ClassID, photo.UploaderID, photo.Caption, photo.MediaKey, photo.ContentType, photo.FileSizeBytes, photo.Status, photo.CreatedAt)
 	return err
 }
 
 func (r *PhotoRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Photo, error) {
-	query := `SELECT id, class_id, uploader_id, caption, media_key, content_type, file_size_bytes, created_at FROM photos WHERE id = $1`
+	query := `SELECT ` + photoColumns + ` FROM photos WHERE id = $1`
 	photo := &domain.Photo{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&photo.ID, &photo.ClassID, &photo.UploaderID, &photo.Caption, &photo.MediaKey, &photo.ContentType, &photo.FileSizeBytes, &photo.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(photoFields(photo)...)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrNotFound
 	}
@@ -39,18 +40,55 @@ func (r *PhotoRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Photo, e
 }
 
 func (r *PhotoRepo) ListByClass(ctx context.Context, classID uuid.UUID, limit, offset int) ([]*domain.Photo, error) {
-	query := `SELECT id, class_id, uploader_id, caption, media_key, content_type, file_size_bytes, created_at 
-		FROM photos WHERE class_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	query := `SELECT ` + photoColumns + `
+		FROM photos WHERE class_id = $1 AND status = 'READY' ORDER BY created_at DESC LIMIT $2 OFFSET $3`
 	rows, err := r.db.QueryContext(ctx, query, classID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanPhotos(rows)
+}
+
+func (r *PhotoRepo) ListPendingBefore(ctx context.Context, before time.Time, limit int) ([]*domain.Photo, error) {
+	query := `SELECT ` + photoColumns + `
+		FROM photos WHERE status = 'PENDING' AND created_at < $1 ORDER BY created_at ASC LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+func (r *PhotoRepo) ListProcessing(ctx context.Context, maxAttempts, limit int) ([]*domain.Photo, error) {
+	query := `SELECT ` + photoColumns + `
+		FROM photos WHERE status = 'PROCESSING' AND processing_attempts < $1
+		ORDER BY created_at ASC LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, maxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPhotos(rows)
+}
+
+const photoColumns = `id, class_id, uploader_id, caption, media_key, content_type, file_size_bytes, status,
+	variants_ready, sanitized, processing_attempts, created_at`
+
+func photoFields(photo *domain.Photo) []any {
+	return []any{&photo.ID, &photo.ClassID, &photo.UploaderID, &photo.Caption, &photo.MediaKey, &photo.ContentType,
+		&photo.FileSizeBytes, &photo.Status, &photo.VariantsReady, &photo.Sanitized, &photo.ProcessingAttempts, &photo.CreatedAt}
+}
+
+func scanPhotos(rows *sql.Rows) ([]*domain.Photo, error) {
 	var photos []*domain.Photo
 	for rows.Next() {
 		photo := &domain.Photo{}
-		if err := rows.Scan(&photo.ID, &photo.ClassID, &photo.UploaderID, &photo.Caption, &photo.MediaKey, &photo.ContentType, &photo.FileSizeBytes, &photo.CreatedAt); err != nil {
+		if err := rows.Scan(photoFields(photo)...); err != nil {
 			return nil, err
 		}
 		photos = append(photos, photo)
@@ -58,12 +96,105 @@ func (r *PhotoRepo) ListByClass(ctx context.Context, classID uuid.UUID, limit, o
 	return photos, rows.Err()
 }
 
+func (r *PhotoRepo) UpdateStatus(ctx context.Context, id uuid.UUID, status domain.PhotoStatus) error {
+	query := `UPDATE photos SET status = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, status, id)
+	return err
+}
+
+func (r *PhotoRepo) ConfirmUpload(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE photos SET status = 'PROCESSING' WHERE id = $1 AND status = 'PENDING'`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *PhotoRepo) MarkProcessed(ctx context.Context, id uuid.UUID, contentType string, fileSizeBytes int) error {
+	query := `UPDATE photos
+		SET status = 'READY', sanitized = TRUE, variants_ready = TRUE, content_type = $1, file_size_bytes = $2
+		WHERE id = $3`
+	result, err := r.db.ExecContext(ctx, query, contentType, fileSizeBytes, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *PhotoRepo) IncrementProcessingAttempts(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE photos SET processing_attempts = processing_attempts + 1 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
 func (r *PhotoRepo) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM photos WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
+func (r *PhotoRepo) DeleteWithObjects(ctx context.Context, id uuid.UUID, deletions []*domain.StorageDeletion) error {
+	return r.deleteWithObjects(ctx, `DELETE FROM photos WHERE id = $1`, id, deletions)
+}
+
+func (r *PhotoRepo) DeletePendingWithObjects(ctx context.Context, id uuid.UUID, deletions []*domain.StorageDeletion) error {
+	// The status is checked by the delete itself, so a photo confirmed after
+	// it was listed is kept
+	query := `DELETE FROM photos WHERE id = $1 AND status = 'PENDING'`
+	return r.deleteWithObjects(ctx, query, id, deletions)
+}
+
+func (r *PhotoRepo) deleteWithObjects(ctx context.Context, query string, id uuid.UUID, deletions []*domain.StorageDeletion) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete photo: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if err := insertStorageDeletions(ctx, tx, deletions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertStorageDeletions(ctx context.Context, tx *sql.Tx, deletions []*domain.StorageDeletion) error {
+	query := `INSERT INTO storage_deletions (id, object_key, attempts, next_attempt_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+	for _, d := range deletions {
+		if _, err := tx.ExecContext(ctx, query, d.ID, d.ObjectKey, d.Attempts, d.NextAttemptAt, d.CreatedAt); err != nil {
+			return fmt.Errorf("failed to record storage deletion: %w", err)
+		}
+	}
+	return nil
+}
+
 // AbsenceRepo implements repository.AbsenceRepository
 type AbsenceRepo struct {
 	db *DB
@@ -110,6 +241,26 @@ func (r *AbsenceRepo) ListByClass(ctx context.Context, classID uuid.UUID, limit,
 	return absences, rows.Err()
 }
 
+func (r *AbsenceRepo) ListByClassAndReporter(ctx context.Context, classID, reporterID uuid.UUID, limit, offset int) ([]*domain.Absence, error) {
+	query := `SELECT id, student_name, class_id, absence_date, reported_by, reporter_id, reason, status, created_at, updated_at 
+		FROM absences WHERE class_id = $1 AND reporter_id = $2 ORDER BY absence_date DESC LIMIT $3 OFFSET $4`
+	rows, err := r.db.QueryContext(ctx, query, classID, reporterID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var absences []*domain.Absence
+	for rows.Next() {
+		absence := &domain.Absence{}
+		if err := rows.Scan(&absence.ID, &absence.StudentName, &absence.ClassID, &absence.AbsenceDate, &absence.ReportedBy, &absence.ReporterID, &absence.Reason, &absence.Status, &absence.CreatedAt, &absence.UpdatedAt); err != nil {
+			return nil, err
+		}
+		absences = append(absences, absence)
+	}
+	return absences, rows.Err()
+}
+
 func (r *AbsenceRepo) UpdateStatus(ctx context.Context, id uuid.UUID, status domain.AbsenceStatus) error {
 	query := `UPDATE absences SET status = $1, updated_at = $2 WHERE id = $3`
 	_, err := r.db.ExecContext(ctx, query, status, time.Now(), id)
@@ -168,6 +319,26 @@ func (r *MessageRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit, o
 	return messages, rows.Err()
 }
 
+func (r *MessageRepo) ListByClass(ctx context.Context, classID uuid.UUID, limit, offset int) ([]*domain.Message, error) {
+	query := `SELECT id, sender_id, recipient_id, class_id, body, read_at, created_at 
+		FROM messages WHERE class_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	rows, err := r.db.QueryContext(ctx, query, classID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*domain.Message
+	for rows.Next() {
+		message := &domain.Message{}
+		if err := rows.Scan(&message.ID, &message.SenderID, &message.RecipientID, &message.ClassID, &message.Body, &message.ReadAt, &message.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
 func (r *MessageRepo) MarkAsRead(ctx context.Context, id uuid.UUID, readAt time.Time) error {
 	query := `UPDATE messages SET read_at = $1 WHERE id = $2`
 	_, err := r.db.ExecContext(ctx, query, readAt, id)
@@ -246,6 +417,26 @@ func (r *AnnouncementRepo) ListGlobal(ctx context.Context, limit, offset int) ([
 	return announcements, rows.Err()
 }
 
+func (r *AnnouncementRepo) ListScheduledByAuthor(ctx context.Context, authorID uuid.UUID, limit, offset int) ([]*domain.Announcement, error) {
+	query := `SELECT id, class_id, author_id, title, body, publish_at, created_at, updated_at 
+		FROM announcements WHERE author_id = $1 AND publish_at > NOW() ORDER BY publish_at ASC LIMIT $2 OFFSET $3`
+	rows, err := r.db.QueryContext(ctx, query, authorID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []*domain.Announcement
+	for rows.Next() {
+		announcement := &domain.Announcement{}
+		if err := rows.Scan(&announcement.ID, &announcement.ClassID, &announcement.AuthorID, &announcement.Title, &announcement.Body, &announcement.PublishAt, &announcement.CreatedAt, &announcement.UpdatedAt); err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, announcement)
+	}
+	return announcements, rows.Err()
+}
+
 func (r *AnnouncementRepo) Update(ctx context.Context, announcement *domain.Announcement) error {
 	query := `UPDATE announcements SET title = $1, body = $2, publish_at = $3, updated_at = $4 WHERE id = $5`
 	_, err := r.db.ExecContext(ctx, query, announcement.Title, announcement.Body, announcement.PublishAt, announcement.UpdatedAt, announcement.ID)
@@ -267,17 +458,24 @@ func NewRefreshTokenRepo(db *DB) repository.RefreshTokenRepository {
 	return &RefreshTokenRepo{db: db}
 }
 
+const insertRefreshTokenQuery = `INSERT INTO refresh_tokens (id, user_id, family_id, parent_id, token_hash, expires_at, revoked_at, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+func refreshTokenArgs(token *domain.RefreshToken) []any {
+	return []any{token.ID, token.UserID, token.FamilyID, token.ParentID, token.TokenHash, token.ExpiresAt, token.RevokedAt, token.CreatedAt}
+}
+
 func (r *RefreshTokenRepo) Create(ctx context.Context, token *domain.RefreshToken) error {
-	query := `INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, revoked_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := r.db.ExecContext(ctx, query, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.RevokedAt, token.CreatedAt)
+	_, err := r.db.ExecContext(ctx, insertRefreshTokenQuery, refreshTokenArgs(token)...)
 	return err
 }
 
 func (r *RefreshTokenRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
-	query := `SELECT id, user_id, token_hash, expires_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = $1`
+	query := `SELECT id, user_id, family_id, parent_id, token_hash, expires_at, revoked_at, created_at
+		FROM refresh_tokens WHERE token_hash = $1`
 	token := &domain.RefreshToken{}
-	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.ParentID,
+		&token.TokenHash, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrNotFound
 	}
@@ -290,6 +488,39 @@ func (r *RefreshTokenRepo) Revoke(ctx context.Context, tokenHash string, revoked
 	return err
 }
 
+func (r *RefreshTokenRepo) Rotate(ctx context.Context, oldTokenHash string, next *domain.RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $1 WHERE token_hash = $2 AND revoked_at IS NULL`,
+		next.CreatedAt, oldTokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, insertRefreshTokenQuery, refreshTokenArgs(next)...); err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, familyID uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, revokedAt, familyID)
+	return err
+}
+
 func (r *RefreshTokenRepo) RevokeAllForUser(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error {
 	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
 	_, err := r.db.ExecContext(ctx, query, revokedAt, userID)
@@ -301,3 +532,240 @@ func (r *RefreshTokenRepo) DeleteExpired(ctx context.Context) error {
 	_, err := r.db.ExecContext(ctx, query)
 	return err
 }
+
+// ClassInviteRepo implements repository.ClassInviteRepository
+type ClassInviteRepo struct {
+	db *DB
+}
+
+func NewClassInviteRepo(db *DB) repository.ClassInviteRepository {
+	return &ClassInviteRepo{db: db}
+}
+
+func (r *ClassInviteRepo) Create(ctx context.Context, invite *domain.ClassInvite) error {
+	query := `INSERT INTO class_invites (id, class_id, code, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.ExecContext(ctx, query, invite.ID, invite.ClassID, invite.Code, invite.CreatedBy, invite.ExpiresAt, invite.CreatedAt)
+	return err
+}
+
+func (r *ClassInviteRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.ClassInvite, error) {
+	query := `SELECT id, class_id, code, created_by, expires_at, revoked_at, created_at FROM class_invites WHERE id = $1`
+	invite := &domain.ClassInvite{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&invite.ID, &invite.ClassID, &invite.Code, &invite.CreatedBy, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return invite, err
+}
+
+func (r *ClassInviteRepo) GetByCode(ctx context.Context, code string) (*domain.ClassInvite, error) {
+	query := `SELECT id, class_id, code, created_by, expires_at, revoked_at, created_at FROM class_invites WHERE code = $1`
+	invite := &domain.ClassInvite{}
+	err := r.db.QueryRowContext(ctx, query, code).Scan(&invite.ID, &invite.ClassID, &invite.Code, &invite.CreatedBy, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return invite, err
+}
+
+func (r *ClassInviteRepo) ListActiveByClass(ctx context.Context, classID uuid.UUID) ([]*domain.ClassInvite, error) {
+	query := `SELECT id, class_id, code, created_by, expires_at, revoked_at, created_at
+		FROM class_invites WHERE class_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*domain.ClassInvite
+	for rows.Next() {
+		invite := &domain.ClassInvite{}
+		if err := rows.Scan(&invite.ID, &invite.ClassID, &invite.Code, &invite.CreatedBy, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+func (r *ClassInviteRepo) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE class_invites SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, revokedAt, id)
+	return err
+}
+
+// ClassJoinRequestRepo implements repository.ClassJoinRequestRepository
+type ClassJoinRequestRepo struct {
+	db *DB
+}
+
+func NewClassJoinRequestRepo(db *DB) repository.ClassJoinRequestRepository {
+	return &ClassJoinRequestRepo{db: db}
+}
+
+func (r *ClassJoinRequestRepo) Create(ctx context.Context, request *domain.ClassJoinRequest) error {
+	query := `INSERT INTO class_join_requests (id, class_id, user_id, invite_id, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.ExecContext(ctx, query, request.ID, request.ClassID, request.UserID, request.InviteID, request.Status, request.CreatedAt)
+	return err
+}
+
+func (r *ClassJoinRequestRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.ClassJoinRequest, error) {
+	query := `SELECT id, class_id, user_id, invite_id, status, decided_by, decided_at, created_at FROM class_join_requests WHERE id = $1`
+	req := &domain.ClassJoinRequest{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&req.ID, &req.ClassID, &req.UserID, &req.InviteID, &req.Status, &req.DecidedBy, &req.DecidedAt, &req.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return req, err
+}
+
+func (r *ClassJoinRequestRepo) HasPending(ctx context.Context, userID, classID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM class_join_requests WHERE user_id = $1 AND class_id = $2 AND status = 'PENDING')`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, userID, classID).Scan(&exists)
+	return exists, err
+}
+
+func (r *ClassJoinRequestRepo) ListByClass(
+	ctx context.Context, classID uuid.UUID, status domain.JoinRequestStatus, limit, offset int,
+) ([]*domain.ClassJoinRequest, error) {
+	query := `SELECT jr.id, jr.class_id, jr.user_id, jr.invite_id, jr.status, jr.decided_by, jr.decided_at, jr.created_at,
+			u.email, COALESCE(p.display_name, '')
+		FROM class_join_requests jr
+		JOIN users u ON u.id = jr.user_id
+		LEFT JOIN profiles p ON p.user_id = jr.user_id
+		WHERE jr.class_id = $1 AND jr.status = $2
+		ORDER BY jr.created_at ASC LIMIT $3 OFFSET $4`
+	rows, err := r.db.QueryContext(ctx, query, classID, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*domain.ClassJoinRequest
+	for rows.Next() {
+		req := &domain.ClassJoinRequest{}
+		if err := rows.Scan(&req.ID, &req.ClassID, &req.UserID, &req.InviteID, &req.Status, &req.DecidedBy, &req.DecidedAt, &req.CreatedAt,
+			&req.Email, &req.DisplayName); err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+func (r *ClassJoinRequestRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.ClassJoinRequest, error) {
+	query := `SELECT id, class_id, user_id, invite_id, status, decided_by, decided_at, created_at
+		FROM class_join_requests WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*domain.ClassJoinRequest
+	for rows.Next() {
+		req := &domain.ClassJoinRequest{}
+		if err := rows.Scan(&req.ID, &req.ClassID, &req.UserID, &req.InviteID, &req.Status, &req.DecidedBy, &req.DecidedAt, &req.CreatedAt); err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+func (r *ClassJoinRequestRepo) Decide(
+	ctx context.Context, id uuid.UUID, status domain.JoinRequestStatus, decidedBy uuid.UUID, decidedAt time.Time,
+) error {
+	query := `UPDATE class_join_requests SET status = $1, decided_by = $2, decided_at = $3 WHERE id = $4 AND status = 'PENDING'`
+	result, err := r.db.ExecContext(ctx, query, status, decidedBy, decidedAt, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *ClassJoinRequestRepo) Reopen(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE class_join_requests SET status = 'PENDING', decided_by = NULL, decided_at = NULL WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// StorageDeletionRepo implements repository.StorageDeletionRepository
+type StorageDeletionRepo struct {
+	db *DB
+}
+
+func NewStorageDeletionRepo(db *DB) repository.StorageDeletionRepository {
+	return &StorageDeletionRepo{db: db}
+}
+
+func (r *StorageDeletionRepo) Create(ctx context.Context, deletions []*domain.StorageDeletion) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := insertStorageDeletions(ctx, tx, deletions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *StorageDeletionRepo) ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.StorageDeletion, error) {
+	query := `SELECT id, object_key, attempts, last_error, next_attempt_at, created_at
+		FROM storage_deletions WHERE next_attempt_at <= $1 ORDER BY next_attempt_at ASC LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*domain.StorageDeletion
+	for rows.Next() {
+		d := &domain.StorageDeletion{}
+		if err := rows.Scan(&d.ID, &d.ObjectKey, &d.Attempts, &d.LastError, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *StorageDeletionRepo) MarkFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	query := `UPDATE storage_deletions SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, lastError, nextAttemptAt, id)
+	return err
+}
+
+func (r *StorageDeletionRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM storage_deletions WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *StorageDeletionRepo) DeleteByObjectKey(ctx context.Context, objectKey string) error {
+	query := `DELETE FROM storage_deletions WHERE object_key = $1`
+	result, err := r.db.ExecContext(ctx, query, objectKey)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -121,6 +123,46 @@ func (c *Client) GeneratePresignedGetURL(ctx context.Context, key string) (strin
 	return presignResult.URL, nil
 }
 
+// GetObject downloads an object. Objects larger than maxBytes are rejected
+// with domain.ErrFileTooLarge.
+func (c *Client) GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	out, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(out.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, domain.ErrFileTooLarge
+	}
+	return data, nil
+}
+
+// PutObject uploads an object
+func (c *Client) PutObject(ctx context.Context, key, contentType string, data []byte) error {
+	_, err := c.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(c.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
 // DeleteObject deletes an object from storage
 func (c *Client) DeleteObject(ctx context.Context, key string) error {
 	_, err := c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -133,6 +175,12 @@ func (c *Client) DeleteObject(ctx context.Context, key string) error {
 	return nil
 }
 
+// ObjectInfo holds the metadata of a stored object
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
 // ObjectExists checks if an object exists
 func (c *Client) ObjectExists(ctx context.Context, key string) (bool, error) {
 	_, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
@@ -140,7 +188,7 @@ func (c *Client) ObjectExists(ctx context.Context, key string) (bool, error) {
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		if strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "NoSuchKey") {
+		if isNotFound(err) {
 			return false, nil
 		}
 		return false, err
@@ -148,6 +196,33 @@ func (c *Client) ObjectExists(ctx context.Context, key string) (bool, error) {
 	return true, nil
 }
 
+// StatObject returns the size and content type of an object. It returns
+// domain.ErrNotFound if the object does not exist.
+func (c *Client) StatObject(ctx context.Context, key string) (*ObjectInfo, error) {
+	out, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	info := &ObjectInfo{
+		ContentType: aws.ToString(out.ContentType),
+	}
+	if out.ContentLength != nil {
+		info.Size = *out.ContentLength
+	}
+	return info, nil
+}
+
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "NoSuchKey")
+}
+
 // HealthCheck performs a health check on the storage
 func (c *Client) HealthCheck(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
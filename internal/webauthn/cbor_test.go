@@ -0,0 +1,97 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples from RFC 8949, appendix A
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"f90001", 5.960464477539063e-8},
+		{"f93c00", 1.0},
+		{"f9c400", -4.0},
+		{"fa47c35000", 100000.0},
+		{"fb3ff199999999999a", 1.1},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"c11a514b67b0", int64(1363896240)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.hex)
+			got, n, err := decodeCBOR(data)
+			if err != nil {
+				t.Fatalf("decodeCBOR() error = %v", err)
+			}
+			if n != len(data) {
+				t.Errorf("decodeCBOR() used %d bytes, want %d", n, len(data))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("half-precision infinity", func(t *testing.T) {
+		got, _, err := decodeCBOR([]byte{0xf9, 0x7c, 0x00})
+		if err != nil || got != math.Inf(1) {
+			t.Errorf("decodeCBOR() = %v, %v", got, err)
+		}
+	})
+
+	t.Run("trailing data", func(t *testing.T) {
+		_, n, err := decodeCBOR([]byte{0x01, 0x02})
+		if err != nil || n != 1 {
+			t.Errorf("decodeCBOR() used %d bytes, %v, want 1", n, err)
+		}
+	})
+}
+
+func TestDecodeCBOR_Invalid(t *testing.T) {
+	deep := make([]byte, maxCBORDepth+2)
+	for i := range deep {
+		deep[i] = 0x81 // array of one item
+	}
+
+	tests := map[string][]byte{
+		"empty":              {},
+		"truncated integer":  {0x19, 0x01},
+		"truncated string":   {0x44, 0x01, 0x02},
+		"huge array":         {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length":  {0x5f, 0x41, 0x01, 0xff},
+		"reserved info":      {0x1c},
+		"duplicate map key":  {0xa2, 0x01, 0x02, 0x01, 0x03},
+		"array map key":      {0xa1, 0x80, 0x01},
+		"uint64 overflow":    {0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"nesting too deep":   deep,
+		"unsupported simple": {0xf0},
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(data); err == nil {
+				t.Error("decodeCBOR() should fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) of the supported credential keys
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// COSE key parameters and values
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+	coseKeyCurve     = -1
+	coseKeyX         = -2
+	coseKeyY         = -3
+	coseKeyN         = -1
+	coseKeyE         = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	minRSAKeyBits = 2048
+)
+
+// publicKey is a credential public key with its COSE algorithm
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key. It returns the number of bytes the key
+// used, since attested credential data may be followed by extensions.
+func parsePublicKey(data []byte) (*publicKey, int, error) {
+	v, n, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("COSE key is not a map")
+	}
+
+	kty, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseKeyAlgorithm)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		y, _ := m[int64(coseKeyY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid EC2 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) { //nolint:staticcheck // validating untrusted coordinates
+			return nil, 0, errors.New("EC point is not on the curve")
+		}
+		return &publicKey{alg: alg, key: key}, n, nil
+
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid OKP key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, n, nil
+
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		nBytes, _ := m[int64(coseKeyN)].([]byte)
+		eBytes, _ := m[int64(coseKeyE)].([]byte)
+		modulus := new(big.Int).SetBytes(nBytes)
+		exponent := new(big.Int).SetBytes(eBytes)
+		if modulus.BitLen() < minRSAKeyBits || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, 0, errors.New("invalid RSA key")
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}}, n, nil
+
+	default:
+		return nil, 0, fmt.Errorf("unsupported key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verify checks a signature over message
+func (k *publicKey) verify(message, signature []byte) error {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, signature) {
+			return ErrInvalidSignature
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", k.key)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+// Package webauthn implements the relying party side of WebAuthn (passkey)
+// registration and authentication ceremonies. Attestation statements are not
+// verified: credentials are requested with attestation "none", so any
+// authenticator the user owns can be registered.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ChallengeSize is the length of generated challenges in bytes
+	ChallengeSize = 32
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+
+	// authenticator data: RP ID hash, flags and sign counter
+	authDataMinLength = 32 + 1 + 4
+	aaguidLength      = 16
+	maxCredentialID   = 1023
+)
+
+var (
+	// ErrInvalidResponse is returned for malformed authenticator responses or
+	// responses that do not belong to this relying party or challenge
+	ErrInvalidResponse = errors.New("invalid authenticator response")
+	// ErrInvalidSignature is returned when an assertion signature is invalid
+	ErrInvalidSignature = errors.New("invalid assertion signature")
+	// ErrSignCount is returned when the signature counter did not increase,
+	// which means the credential may have been cloned
+	ErrSignCount = errors.New("signature counter did not increase")
+)
+
+// RelyingParty identifies this service to authenticators
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to, e.g. "app.example.com"
+	ID   string
+	Name string
+	// Origins lists the web origins ceremonies may run on
+	Origins []string
+}
+
+// Credential is a public key credential registered by an authenticator
+type Credential struct {
+	ID []byte
+	// PublicKey is the credential public key as a COSE_Key
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+}
+
+// NewChallenge generates a random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// clientData is the part of the client data JSON the ceremonies check
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ChallengeFromClientData returns the challenge a response was made for, so
+// the stored challenge can be looked up before the response is verified
+func ChallengeFromClientData(clientDataJSON []byte) ([]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, fmt.Errorf("%w: client data: %w", ErrInvalidResponse, err)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return nil, fmt.Errorf("%w: client data challenge", ErrInvalidResponse)
+	}
+	return challenge, nil
+}
+
+// verifyClientData checks the ceremony type, challenge and origin
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %w", ErrInvalidResponse, err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: client data type %q", ErrInvalidResponse, cd.Type)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if cd.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremony", ErrInvalidResponse)
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidResponse, cd.Origin)
+}
+
+// authenticatorData is parsed authenticator data (WebAuthn §6.1)
+type authenticatorData struct {
+	rpIDHash   []byte
+	flags      byte
+	signCount  uint32
+	credential *Credential
+	publicKey  *publicKey
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < authDataMinLength {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAttestedCredData == 0 {
+		return ad, nil
+	}
+
+	rest := data[authDataMinLength:]
+	if len(rest) < aaguidLength+2 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+	}
+	aaguid := rest[:aaguidLength]
+	idLength := int(binary.BigEndian.Uint16(rest[aaguidLength:]))
+	rest = rest[aaguidLength+2:]
+	if idLength == 0 || idLength > maxCredentialID || len(rest) < idLength {
+		return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+	}
+	credentialID := rest[:idLength]
+	rest = rest[idLength:]
+
+	key, n, err := parsePublicKey(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credential public key: %w", ErrInvalidResponse, err)
+	}
+
+	ad.publicKey = key
+	ad.credential = &Credential{
+		ID:        append([]byte(nil), credentialID...),
+		PublicKey: append([]byte(nil), rest[:n]...),
+		SignCount: ad.signCount,
+		AAGUID:    append([]byte(nil), aaguid...),
+	}
+	return ad, nil
+}
+
+// verifyFlags checks that the authenticator data is for this relying party
+// and that the user was present and verified. User verification (a PIN or
+// biometric) is always required, so a passkey replaces both the password and
+// the second factor.
+func (rp *RelyingParty) verifyFlags(ad *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.rpIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: RP ID mismatch", ErrInvalidResponse)
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// VerifyRegistration checks the response to a registration ceremony started
+// with challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(clientDataJSON, attestationObject, challenge []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %w", ErrInvalidResponse, err)
+	}
+	attestation, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object has no authData", ErrInvalidResponse)
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyFlags(ad); err != nil {
+		return nil, err
+	}
+	if ad.credential == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+	return ad.credential, nil
+}
+
+// VerifyAssertion checks the response to an authentication ceremony started
+// with challenge, signed by credential. It returns the authenticator's new
+// signature counter, which must be stored for the next assertion.
+func (rp *RelyingParty) VerifyAssertion(
+	credential *Credential, clientDataJSON, authenticatorDataBytes, signature, challenge []byte,
+) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyGet, challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(authenticatorDataBytes)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyFlags(ad); err != nil {
+		return 0, err
+	}
+
+	key, _, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("stored credential public key: %w", err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := bytes.Join([][]byte{authenticatorDataBytes, clientDataHash[:]}, nil)
+	if err := key.verify(signed, signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators without a counter always send 0. Otherwise it has to
+	// grow with every assertion, or another copy of the key is in use.
+	if (ad.signCount != 0 || credential.SignCount != 0) && ad.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+	return ad.signCount, nil
+}
+
+// CredentialParameter is a credential type and algorithm the relying party
+// accepts
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies a credential in ceremony options
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// RelyingPartyEntity identifies the relying party in creation options
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the user in creation options
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// AuthenticatorSelection states the authenticator features the relying
+// party requires
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options for navigator.credentials.create in the
+// WebAuthn JSON format, with binary values base64url encoded
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options for navigator.credentials.get in the
+// WebAuthn JSON format
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions returns the options of a registration ceremony. Credentials
+// must be discoverable, so users can sign in without typing an email. exclude
+// lists the user's existing credentials, so an authenticator is not
+// registered twice.
+func (rp *RelyingParty) CreationOptions(
+	challenge, userID []byte, userName, displayName string, exclude [][]byte, timeout time.Duration,
+) CreationOptions {
+	return CreationOptions{
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User: UserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(userID),
+			Name:        userName,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options of an authentication ceremony. An empty
+// allow list lets the user pick any discoverable credential for this site.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte, timeout time.Duration) RequestOptions {
+	return RequestOptions{
+		Challenge:        base64.RawURLEncoding.EncodeToString(challenge),
+		RPID:             rp.ID,
+		Timeout:          timeout.Milliseconds(),
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		list[i] = CredentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(id)}
+	}
+	return list
+}
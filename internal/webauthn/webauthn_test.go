@@ -0,0 +1,408 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "app.example.com"
+	testOrigin = "https://app.example.com"
+)
+
+func testRelyingParty() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Name: "TinySchoolHub", Origins: []string{testOrigin}}
+}
+
+// softAuthenticator is a software WebAuthn authenticator for tests
+type softAuthenticator struct {
+	key          crypto.Signer
+	credentialID []byte
+	signCount    uint32
+	// counterStep is added to signCount for every assertion; 0 emulates
+	// authenticators without a counter
+	counterStep uint32
+
+	rpID   string
+	origin string
+	flags  byte
+}
+
+func newSoftAuthenticator(t *testing.T, alg int64) *softAuthenticator {
+	t.Helper()
+
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch alg {
+	case AlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		key:          key,
+		credentialID: id,
+		counterStep:  1,
+		rpID:         testRPID,
+		origin:       testOrigin,
+		flags:        flagUserPresent | flagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge []byte) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) coseKey() map[interface{}]interface{} {
+	switch key := a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return map[interface{}]interface{}{
+			int64(coseKeyType): int64(coseKeyTypeEC2), int64(coseKeyAlgorithm): AlgES256,
+			int64(coseKeyCurve): int64(coseCurveP256),
+			int64(coseKeyX):     key.X.FillBytes(make([]byte, 32)),
+			int64(coseKeyY):     key.Y.FillBytes(make([]byte, 32)),
+		}
+	case ed25519.PublicKey:
+		return map[interface{}]interface{}{
+			int64(coseKeyType): int64(coseKeyTypeOKP), int64(coseKeyAlgorithm): AlgEdDSA,
+			int64(coseKeyCurve): int64(coseCurveEd25519), int64(coseKeyX): []byte(key),
+		}
+	case *rsa.PublicKey:
+		return map[interface{}]interface{}{
+			int64(coseKeyType): int64(coseKeyTypeRSA), int64(coseKeyAlgorithm): AlgRS256,
+			int64(coseKeyN): key.N.Bytes(), int64(coseKeyE): big.NewInt(int64(key.E)).Bytes(),
+		}
+	}
+	return nil
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredData
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, aaguidLength)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID))) //nolint:gosec // test IDs are short
+		data = append(data, a.credentialID...)
+		data = append(data, encodeCBOR(a.coseKey())...)
+	}
+	return data
+}
+
+// create answers a registration ceremony with a "none" attestation
+func (a *softAuthenticator) create(t *testing.T, challenge []byte) (clientDataJSON, attestationObject []byte) {
+	t.Helper()
+
+	attestationObject = encodeCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": a.authData(true),
+	})
+	return a.clientData(t, ceremonyCreate, challenge), attestationObject
+}
+
+// get answers an authentication ceremony
+func (a *softAuthenticator) get(t *testing.T, challenge []byte) (clientDataJSON, authData, signature []byte) {
+	t.Helper()
+
+	a.signCount += a.counterStep
+	clientDataJSON = a.clientData(t, ceremonyGet, challenge)
+	authData = a.authData(false)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var err error
+	switch key := a.key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, signed)
+	default:
+		digest := sha256.Sum256(signed)
+		signature, err = a.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientDataJSON, authData, signature
+}
+
+// encodeCBOR encodes the value types the decoder produces
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n)) //nolint:gosec // test values are small
+		}
+	}
+
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		// Sort keys so encodings are deterministic
+		keys := make([][]byte, 0, len(v))
+		values := make(map[string][]byte, len(v))
+		for key, value := range v {
+			encoded := encodeCBOR(key)
+			keys = append(keys, encoded)
+			values[string(encoded)] = encodeCBOR(value)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+		out := head(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(out, key...)
+			out = append(out, values[string(key)]...)
+		}
+		return out
+	}
+	panic("unsupported CBOR test value")
+}
+
+func register(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator) *Credential {
+	t.Helper()
+
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDataJSON, attestationObject := authenticator.create(t, challenge)
+	credential, err := rp.VerifyRegistration(clientDataJSON, attestationObject, challenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	return credential
+}
+
+func TestCeremonies(t *testing.T) {
+	algorithms := map[string]int64{"ES256": AlgES256, "EdDSA": AlgEdDSA, "RS256": AlgRS256}
+
+	for name, alg := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			rp := testRelyingParty()
+			authenticator := newSoftAuthenticator(t, alg)
+
+			credential := register(t, rp, authenticator)
+			if !bytes.Equal(credential.ID, authenticator.credentialID) {
+				t.Errorf("credential ID = %x, want %x", credential.ID, authenticator.credentialID)
+			}
+
+			for i := 1; i <= 2; i++ {
+				challenge, err := NewChallenge()
+				if err != nil {
+					t.Fatal(err)
+				}
+				clientDataJSON, authData, signature := authenticator.get(t, challenge)
+
+				got, err := ChallengeFromClientData(clientDataJSON)
+				if err != nil || !bytes.Equal(got, challenge) {
+					t.Fatalf("ChallengeFromClientData() = %x, %v", got, err)
+				}
+
+				signCount, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, challenge)
+				if err != nil {
+					t.Fatalf("VerifyAssertion() error = %v", err)
+				}
+				if signCount != uint32(i) { //nolint:gosec // small loop counter
+					t.Errorf("sign count = %d, want %d", signCount, i)
+				}
+				credential.SignCount = signCount
+			}
+		})
+	}
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *softAuthenticator)
+		other  bool
+	}{
+		{name: "other origin", modify: func(a *softAuthenticator) { a.origin = "https://evil.example.com" }},
+		{name: "other RP ID", modify: func(a *softAuthenticator) { a.rpID = "evil.example.com" }},
+		{name: "user not verified", modify: func(a *softAuthenticator) { a.flags = flagUserPresent }},
+		{name: "user not present", modify: func(a *softAuthenticator) { a.flags = flagUserVerified }},
+		{name: "other challenge", other: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRelyingParty()
+			authenticator := newSoftAuthenticator(t, AlgES256)
+			if tt.modify != nil {
+				tt.modify(authenticator)
+			}
+
+			challenge, err := NewChallenge()
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientDataJSON, attestationObject := authenticator.create(t, challenge)
+			if tt.other {
+				challenge, _ = NewChallenge()
+			}
+
+			if _, err := rp.VerifyRegistration(clientDataJSON, attestationObject, challenge); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("VerifyRegistration() error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+
+	t.Run("assertion instead of registration", func(t *testing.T) {
+		rp := testRelyingParty()
+		authenticator := newSoftAuthenticator(t, AlgES256)
+		challenge, _ := NewChallenge()
+		_, attestationObject := authenticator.create(t, challenge)
+		clientDataJSON := authenticator.clientData(t, ceremonyGet, challenge)
+
+		if _, err := rp.VerifyRegistration(clientDataJSON, attestationObject, challenge); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("VerifyRegistration() error = %v, want ErrInvalidResponse", err)
+		}
+	})
+}
+
+func TestVerifyAssertion_Rejects(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t, AlgES256)
+	credential := register(t, rp, authenticator)
+
+	t.Run("signature by another key", func(t *testing.T) {
+		other := newSoftAuthenticator(t, AlgES256)
+		other.signCount = authenticator.signCount
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := other.get(t, challenge)
+
+		if _, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, challenge); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("VerifyAssertion() error = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := authenticator.get(t, challenge)
+		authData[36]++
+
+		if _, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, challenge); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("VerifyAssertion() error = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("other challenge", func(t *testing.T) {
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := authenticator.get(t, challenge)
+		other, _ := NewChallenge()
+
+		if _, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, other); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("VerifyAssertion() error = %v, want ErrInvalidResponse", err)
+		}
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := authenticator.get(t, challenge)
+		signCount, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, challenge)
+		if err != nil {
+			t.Fatalf("VerifyAssertion() error = %v", err)
+		}
+		credential.SignCount = signCount
+
+		// A copy of the key that has not seen the last assertion replays
+		// the same counter value
+		authenticator.signCount--
+		challenge, _ = NewChallenge()
+		clientDataJSON, authData, signature = authenticator.get(t, challenge)
+		if _, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, challenge); !errors.Is(err, ErrSignCount) {
+			t.Errorf("VerifyAssertion() error = %v, want ErrSignCount", err)
+		}
+	})
+}
+
+func TestVerifyAssertion_WithoutCounter(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t, AlgES256)
+	authenticator.counterStep = 0
+	credential := register(t, rp, authenticator)
+
+	for i := 0; i < 2; i++ {
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := authenticator.get(t, challenge)
+		if _, err := rp.VerifyAssertion(credential, clientDataJSON, authData, signature, challenge); err != nil {
+			t.Fatalf("VerifyAssertion() error = %v", err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	rp := testRelyingParty()
+	challenge := []byte{1, 2, 3}
+
+	creation := rp.CreationOptions(challenge, []byte("user"), "jane@example.com", "Jane", [][]byte{{9}}, time.Minute)
+	if creation.Challenge != "AQID" || creation.RP.ID != testRPID || creation.User.ID != "dXNlcg" {
+		t.Errorf("CreationOptions() = %+v", creation)
+	}
+	if creation.Timeout != 60000 || len(creation.ExcludeCredentials) != 1 || creation.ExcludeCredentials[0].ID != "CQ" {
+		t.Errorf("CreationOptions() = %+v", creation)
+	}
+	if creation.AuthenticatorSelection.UserVerification != "required" || creation.Attestation != "none" {
+		t.Errorf("CreationOptions() = %+v", creation)
+	}
+
+	request := rp.RequestOptions(challenge, nil, time.Minute)
+	if request.RPID != testRPID || request.AllowCredentials == nil || len(request.AllowCredentials) != 0 {
+		t.Errorf("RequestOptions() = %+v", request)
+	}
+}
@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// ExpiryCleanup deletes the expired rows of one table
+type ExpiryCleanup struct {
+	Table string
+	// DeleteExpired deletes the rows that expired by now
+	DeleteExpired func(ctx context.Context, now time.Time) error
+}
+
+// ExpiryCleaner deletes rows that are only kept until they expire, such as
+// rate limit windows, so tables written by unauthenticated requests do not
+// grow without bound
+type ExpiryCleaner struct {
+	cleanups []ExpiryCleanup
+	interval time.Duration
+	logger   *log.Logger
+}
+
+// NewExpiryCleaner creates a cleaner that runs the cleanups every interval
+func NewExpiryCleaner(interval time.Duration, logger *log.Logger, cleanups ...ExpiryCleanup) *ExpiryCleaner {
+	return &ExpiryCleaner{
+		cleanups: cleanups,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run cleans periodically until ctx is cancelled
+func (c *ExpiryCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Clean(ctx, time.Now())
+		}
+	}
+}
+
+// Clean runs every cleanup once and returns how many failed. A failed cleanup
+// does not stop the others.
+func (c *ExpiryCleaner) Clean(ctx context.Context, now time.Time) int {
+	failed := 0
+	for _, cleanup := range c.cleanups {
+		if err := cleanup.DeleteExpired(ctx, now); err != nil {
+			c.logger.WithError(err).WithField("table", cleanup.Table).Error("Failed to delete expired rows")
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+func TestExpiryCleaner_Clean(t *testing.T) {
+	now := time.Now()
+	var cleaned []string
+	cleanup := func(table string, err error) ExpiryCleanup {
+		return ExpiryCleanup{
+			Table: table,
+			DeleteExpired: func(_ context.Context, at time.Time) error {
+				if !at.Equal(now) {
+					t.Errorf("%s cleaned at %v, want %v", table, at, now)
+				}
+				cleaned = append(cleaned, table)
+				return err
+			},
+		}
+	}
+
+	cleaner := NewExpiryCleaner(time.Minute, log.New("error", "json"),
+		cleanup("rate_limits", errors.New("database unavailable")),
+		cleanup("oidc_login_states", nil),
+	)
+
+	if failed := cleaner.Clean(context.Background(), now); failed != 1 {
+		t.Errorf("Clean() failed = %d, want 1", failed)
+	}
+	if len(cleaned) != 2 {
+		t.Errorf("cleaned %v, want every table despite the failure", cleaned)
+	}
+}
@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/imaging"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/storage"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const (
+	processBatchSize      = 20
+	maxProcessingAttempts = 5
+)
+
+// ObjectStore is the subset of the storage client used by the photo processor
+type ObjectStore interface {
+	ObjectDeleter
+	GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error)
+	PutObject(ctx context.Context, key, contentType string, data []byte) error
+}
+
+// PhotoProcessor strips metadata from confirmed photos and generates their
+// resized variants. A photo only becomes visible once both are done.
+type PhotoProcessor struct {
+	photoRepo repository.PhotoRepository
+	storage   ObjectStore
+	interval  time.Duration
+	wake      chan struct{}
+	logger    *log.Logger
+}
+
+// NewPhotoProcessor creates a processor that looks for new work every interval
+// and whenever Notify is called
+func NewPhotoProcessor(
+	photoRepo repository.PhotoRepository,
+	storage ObjectStore,
+	interval time.Duration,
+	logger *log.Logger,
+) *PhotoProcessor {
+	return &PhotoProcessor{
+		photoRepo: photoRepo,
+		storage:   storage,
+		interval:  interval,
+		wake:      make(chan struct{}, 1),
+		logger:    logger,
+	}
+}
+
+// Notify tells the processor that a photo is waiting, without blocking
+func (p *PhotoProcessor) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes photos until ctx is cancelled
+func (p *PhotoProcessor) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+
+		if _, err := p.ProcessPending(ctx); err != nil {
+			p.logger.WithError(err).Error("Photo processing failed")
+		}
+	}
+}
+
+// ProcessPending processes one batch of photos and returns how many succeeded
+func (p *PhotoProcessor) ProcessPending(ctx context.Context) (int, error) {
+	photos, err := p.photoRepo.ListProcessing(ctx, maxProcessingAttempts, processBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, photo := range photos {
+		logger := p.logger.WithField("photo_id", photo.ID.String())
+
+		if err := p.process(ctx, photo); err != nil {
+			logger.WithError(err).Warn("Failed to process photo")
+			if err := p.photoRepo.IncrementProcessingAttempts(ctx, photo.ID); err != nil {
+				logger.WithError(err).Error("Failed to record processing attempt")
+			}
+			if photo.ProcessingAttempts+1 >= maxProcessingAttempts {
+				logger.Error("Giving up on photo, it stays hidden until it is deleted")
+			}
+			continue
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// process stores a sanitized copy of the original and every variant, then
+// removes the raw upload
+func (p *PhotoProcessor) process(ctx context.Context, photo *domain.Photo) error {
+	data, err := p.storage.GetObject(ctx, photo.MediaKey, storage.MaxFileSize)
+	if err != nil {
+		return fmt.Errorf("failed to download original: %w", err)
+	}
+
+	sanitized, err := imaging.Sanitize(data)
+	if err != nil {
+		return err
+	}
+	if err := p.storage.PutObject(ctx, photo.SanitizedKey(), sanitized.ContentType, sanitized.Data); err != nil {
+		return fmt.Errorf("failed to upload sanitized original: %w", err)
+	}
+
+	for _, variant := range imaging.Variants {
+		var buf bytes.Buffer
+		if err := imaging.EncodeVariant(&buf, sanitized.Image, variant); err != nil {
+			return fmt.Errorf("failed to render %s: %w", variant.Name, err)
+		}
+		key := photo.VariantKey(domain.PhotoVariant(variant.Name))
+		if err := p.storage.PutObject(ctx, key, imaging.VariantContentType, buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", variant.Name, err)
+		}
+	}
+
+	if err := p.photoRepo.MarkProcessed(ctx, photo.ID, sanitized.ContentType, len(sanitized.Data)); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			// The photo was deleted while we were working on it
+			p.removeObjects(ctx, photo, photo.ObjectKeys())
+			return nil
+		}
+		return err
+	}
+
+	// The raw upload still carries the metadata, so it is not kept around
+	p.removeObjects(ctx, photo, []string{photo.MediaKey})
+	return nil
+}
+
+func (p *PhotoProcessor) removeObjects(ctx context.Context, photo *domain.Photo, keys []string) {
+	for _, key := range keys {
+		if err := p.storage.DeleteObject(ctx, key); err != nil {
+			p.logger.WithError(err).WithField("photo_id", photo.ID.String()).Warn("Failed to remove photo object")
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/imaging"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+type memoryStore struct {
+	objects map[string][]byte
+}
+
+func (m *memoryStore) GetObject(_ context.Context, key string, _ int64) ([]byte, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *memoryStore) PutObject(_ context.Context, key, _ string, data []byte) error {
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memoryStore) DeleteObject(_ context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+type processorPhotoRepo struct {
+	fakePhotoRepo
+	attempts map[uuid.UUID]int
+}
+
+func (f *processorPhotoRepo) ListProcessing(_ context.Context, maxAttempts, limit int) ([]*domain.Photo, error) {
+	var photos []*domain.Photo
+	for _, photo := range f.photos {
+		if photo.Status == domain.PhotoStatusProcessing && f.attempts[photo.ID] < maxAttempts && len(photos) < limit {
+			photos = append(photos, photo)
+		}
+	}
+	return photos, nil
+}
+
+func (f *processorPhotoRepo) MarkProcessed(_ context.Context, id uuid.UUID, contentType string, fileSizeBytes int) error {
+	photo, ok := f.photos[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	photo.Status = domain.PhotoStatusReady
+	photo.Sanitized = true
+	photo.VariantsReady = true
+	photo.ContentType = contentType
+	photo.FileSizeBytes = fileSizeBytes
+	return nil
+}
+
+func (f *processorPhotoRepo) IncrementProcessingAttempts(_ context.Context, id uuid.UUID) error {
+	f.attempts[id]++
+	return nil
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPhotoProcessor_SanitizesAndGeneratesVariants(t *testing.T) {
+	good := newPhoto(domain.PhotoStatusProcessing, time.Minute)
+	corrupt := newPhoto(domain.PhotoStatusProcessing, time.Minute)
+
+	repo := &processorPhotoRepo{
+		fakePhotoRepo: fakePhotoRepo{photos: map[uuid.UUID]*domain.Photo{good.ID: good, corrupt.ID: corrupt}},
+		attempts:      map[uuid.UUID]int{},
+	}
+	store := &memoryStore{objects: map[string][]byte{
+		good.MediaKey:    encodePNG(t, 2000, 1500),
+		corrupt.MediaKey: []byte("not an image"),
+	}}
+
+	processor := NewPhotoProcessor(repo, store, time.Minute, log.New("error", "json"))
+
+	processed, err := processor.ProcessPending(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessPending() error = %v", err)
+	}
+	if processed != 1 {
+		t.Errorf("ProcessPending() processed = %d, want 1", processed)
+	}
+
+	if !good.IsReady() || !good.Sanitized || !good.VariantsReady {
+		t.Errorf("photo should be ready, sanitized and have variants: %+v", good)
+	}
+	sanitized, ok := store.objects[good.SanitizedKey()]
+	if !ok {
+		t.Fatal("sanitized original should be stored")
+	}
+	if good.FileSizeBytes != len(sanitized) {
+		t.Errorf("FileSizeBytes = %d, want %d", good.FileSizeBytes, len(sanitized))
+	}
+	if _, ok := store.objects[good.MediaKey]; ok {
+		t.Error("raw upload should be removed")
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(store.objects[good.VariantKey(domain.PhotoVariantThumbnail)]))
+	if err != nil {
+		t.Fatalf("thumbnail is not a valid JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 320 || b.Dy() != 240 {
+		t.Errorf("thumbnail size = %dx%d, want 320x240", b.Dx(), b.Dy())
+	}
+	if _, ok := store.objects[good.VariantKey(domain.PhotoVariantMedium)]; !ok {
+		t.Error("medium variant should be stored")
+	}
+
+	if corrupt.IsReady() {
+		t.Error("corrupt photo should not be marked ready")
+	}
+	if repo.attempts[corrupt.ID] != 1 {
+		t.Errorf("corrupt photo attempts = %d, want 1", repo.attempts[corrupt.ID])
+	}
+}
+
+func TestPhotoProcessor_VariantsMatchDomain(t *testing.T) {
+	if len(imaging.Variants) != len(domain.PhotoVariants) {
+		t.Fatalf("imaging has %d variants, domain has %d", len(imaging.Variants), len(domain.PhotoVariants))
+	}
+	for i, variant := range imaging.Variants {
+		if domain.PhotoVariant(variant.Name) != domain.PhotoVariants[i] {
+			t.Errorf("variant %d: imaging %q != domain %q", i, variant.Name, domain.PhotoVariants[i])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package worker contains background jobs that run alongside the API server.
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// sweepBatchSize bounds how many photos are purged per sweep
+const sweepBatchSize = 100
+
+// PhotoSweeper purges photos whose upload was never confirmed
+type PhotoSweeper struct {
+	photoRepo repository.PhotoRepository
+	cleaner   *StorageCleaner
+	ttl       time.Duration
+	interval  time.Duration
+	logger    *log.Logger
+}
+
+// NewPhotoSweeper creates a sweeper that removes pending photos older than ttl
+// every interval
+func NewPhotoSweeper(
+	photoRepo repository.PhotoRepository,
+	cleaner *StorageCleaner,
+	ttl, interval time.Duration,
+	logger *log.Logger,
+) *PhotoSweeper {
+	return &PhotoSweeper{
+		photoRepo: photoRepo,
+		cleaner:   cleaner,
+		ttl:       ttl,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run sweeps periodically until ctx is cancelled
+func (s *PhotoSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.Sweep(ctx)
+			if err != nil {
+				s.logger.WithError(err).Error("Pending photo sweep failed")
+			}
+			if purged > 0 {
+				s.logger.WithField("purged", purged).Info("Purged abandoned photo uploads")
+			}
+		}
+	}
+}
+
+// Sweep removes one batch of expired pending photos and returns how many were
+// purged. A photo is only deleted if it is still pending, together with a
+// record of its upload object; objects that cannot be deleted right away are
+// retried by the storage cleaner.
+func (s *PhotoSweeper) Sweep(ctx context.Context) (int, error) {
+	photos, err := s.photoRepo.ListPendingBefore(ctx, time.Now().Add(-s.ttl), sweepBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, photo := range photos {
+		logger := s.logger.WithField("photo_id", photo.ID.String())
+
+		deletions := NewStorageDeletions([]string{photo.MediaKey})
+		if err := s.photoRepo.DeletePendingWithObjects(ctx, photo.ID, deletions); err != nil {
+			// Not found means the upload was confirmed since it was listed
+			if !errors.Is(err, domain.ErrNotFound) {
+				logger.WithError(err).Warn("Failed to delete pending photo")
+			}
+			continue
+		}
+
+		// Deleting a key that was never uploaded is a no-op in S3
+		s.cleaner.Purge(ctx, deletions)
+		purged++
+	}
+
+	return purged, nil
+}
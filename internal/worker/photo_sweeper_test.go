@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+// fakePhotoRepo implements only the methods the sweeper needs
+type fakePhotoRepo struct {
+	repository.PhotoRepository
+	photos map[uuid.UUID]*domain.Photo
+	// confirmAfterList simulates uploads confirmed while a sweep runs
+	confirmAfterList bool
+}
+
+func (f *fakePhotoRepo) ListPendingBefore(_ context.Context, before time.Time, limit int) ([]*domain.Photo, error) {
+	var photos []*domain.Photo
+	for _, photo := range f.photos {
+		if photo.Status == domain.PhotoStatusPending && photo.CreatedAt.Before(before) && len(photos) < limit {
+			photos = append(photos, photo)
+		}
+	}
+	if f.confirmAfterList {
+		for _, photo := range photos {
+			f.photos[photo.ID] = &domain.Photo{ID: photo.ID, MediaKey: photo.MediaKey, Status: domain.PhotoStatusProcessing}
+		}
+	}
+	return photos, nil
+}
+
+func (f *fakePhotoRepo) DeletePendingWithObjects(_ context.Context, id uuid.UUID, _ []*domain.StorageDeletion) error {
+	photo, ok := f.photos[id]
+	if !ok || photo.Status != domain.PhotoStatusPending {
+		return domain.ErrNotFound
+	}
+	delete(f.photos, id)
+	return nil
+}
+
+type fakeStorage struct {
+	deleted []string
+	failFor string
+}
+
+func (f *fakeStorage) DeleteObject(_ context.Context, key string) error {
+	if key == f.failFor {
+		return errors.New("storage unavailable")
+	}
+	f.deleted = append(f.deleted, key)
+	return nil
+}
+
+func newPhoto(status domain.PhotoStatus, age time.Duration) *domain.Photo {
+	id := uuid.New()
+	return &domain.Photo{
+		ID:        id,
+		MediaKey:  "photos/class/" + id.String(),
+		Status:    status,
+		CreatedAt: time.Now().Add(-age),
+	}
+}
+
+func TestPhotoSweeper_Sweep(t *testing.T) {
+	stale := newPhoto(domain.PhotoStatusPending, 2*time.Hour)
+	fresh := newPhoto(domain.PhotoStatusPending, 5*time.Minute)
+	ready := newPhoto(domain.PhotoStatusReady, 48*time.Hour)
+
+	repo := &fakePhotoRepo{photos: map[uuid.UUID]*domain.Photo{
+		stale.ID: stale,
+		fresh.ID: fresh,
+		ready.ID: ready,
+	}}
+	store := &fakeStorage{}
+
+	cleaner := NewStorageCleaner(newFakeDeletionRepo(), store, time.Minute, log.New("error", "json"))
+	sweeper := NewPhotoSweeper(repo, cleaner, time.Hour, time.Minute, log.New("error", "json"))
+
+	purged, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Sweep() purged = %d, want 1", purged)
+	}
+	if _, ok := repo.photos[stale.ID]; ok {
+		t.Error("stale pending photo should have been deleted")
+	}
+	if _, ok := repo.photos[fresh.ID]; !ok {
+		t.Error("fresh pending photo should be kept")
+	}
+	if _, ok := repo.photos[ready.ID]; !ok {
+		t.Error("ready photo should be kept")
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != stale.MediaKey {
+		t.Errorf("deleted objects = %v, want [%s]", store.deleted, stale.MediaKey)
+	}
+}
+
+func TestPhotoSweeper_RetriesObjectWhenStorageFails(t *testing.T) {
+	stale := newPhoto(domain.PhotoStatusPending, 2*time.Hour)
+
+	repo := &fakePhotoRepo{photos: map[uuid.UUID]*domain.Photo{stale.ID: stale}}
+	deletionRepo := newFakeDeletionRepo()
+	store := &fakeStorage{failFor: stale.MediaKey}
+
+	cleaner := NewStorageCleaner(deletionRepo, store, time.Minute, log.New("error", "json"))
+	sweeper := NewPhotoSweeper(repo, cleaner, time.Hour, time.Minute, log.New("error", "json"))
+
+	purged, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Sweep() purged = %d, want 1", purged)
+	}
+	if _, ok := repo.photos[stale.ID]; ok {
+		t.Error("pending photo should be deleted even when its object could not be")
+	}
+	if len(deletionRepo.failed) != 1 {
+		t.Errorf("failed deletions = %d, want 1 left for the storage cleaner", len(deletionRepo.failed))
+	}
+}
+
+func TestPhotoSweeper_KeepsConfirmedPhoto(t *testing.T) {
+	stale := newPhoto(domain.PhotoStatusPending, 2*time.Hour)
+
+	repo := &fakePhotoRepo{photos: map[uuid.UUID]*domain.Photo{stale.ID: stale}, confirmAfterList: true}
+	store := &fakeStorage{}
+
+	cleaner := NewStorageCleaner(newFakeDeletionRepo(), store, time.Minute, log.New("error", "json"))
+	sweeper := NewPhotoSweeper(repo, cleaner, time.Hour, time.Minute, log.New("error", "json"))
+
+	purged, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if purged != 0 {
+		t.Errorf("Sweep() purged = %d, want 0", purged)
+	}
+	if _, ok := repo.photos[stale.ID]; !ok {
+		t.Error("photo confirmed during the sweep should be kept")
+	}
+	if len(store.deleted) != 0 {
+		t.Errorf("deleted objects = %v, want none for a confirmed photo", store.deleted)
+	}
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+const (
+	cleanupBatchSize  = 100
+	cleanupBaseDelay  = time.Minute
+	cleanupMaxDelay   = 6 * time.Hour
+	cleanupAlertAfter = 10
+)
+
+// ObjectDeleter is the subset of the storage client used by the storage cleaner
+type ObjectDeleter interface {
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// StorageCleaner deletes storage objects recorded as storage deletions and
+// retries failed deletions with exponential backoff
+type StorageCleaner struct {
+	deletionRepo repository.StorageDeletionRepository
+	storage      ObjectDeleter
+	interval     time.Duration
+	logger       *log.Logger
+}
+
+// NewStorageCleaner creates a cleaner that retries due deletions every interval
+func NewStorageCleaner(
+	deletionRepo repository.StorageDeletionRepository,
+	storage ObjectDeleter,
+	interval time.Duration,
+	logger *log.Logger,
+) *StorageCleaner {
+	return &StorageCleaner{
+		deletionRepo: deletionRepo,
+		storage:      storage,
+		interval:     interval,
+		logger:       logger,
+	}
+}
+
+// NewStorageDeletions builds the deletion records for the given keys, ready to
+// be stored alongside the deletion of the row that owns them
+func NewStorageDeletions(keys []string) []*domain.StorageDeletion {
+	now := time.Now()
+	deletions := make([]*domain.StorageDeletion, len(keys))
+	for i, key := range keys {
+		deletions[i] = &domain.StorageDeletion{
+			ID:            uuid.New(),
+			ObjectKey:     key,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+	}
+	return deletions
+}
+
+// Schedule records the deletion of the objects at the given time, so uploads
+// that are never claimed are swept by the cleaner
+func (c *StorageCleaner) Schedule(ctx context.Context, keys []string, at time.Time) error {
+	deletions := NewStorageDeletions(keys)
+	for _, d := range deletions {
+		d.NextAttemptAt = at
+	}
+	return c.deletionRepo.Create(ctx, deletions)
+}
+
+// Cancel forgets the scheduled deletion of an object. It returns
+// domain.ErrNotFound if none is pending, for instance because the object was
+// already swept.
+func (c *StorageCleaner) Cancel(ctx context.Context, key string) error {
+	return c.deletionRepo.DeleteByObjectKey(ctx, key)
+}
+
+// Remove records the deletion of the objects and deletes them right away.
+// Objects that cannot be deleted now are retried like any other deletion.
+func (c *StorageCleaner) Remove(ctx context.Context, keys []string) error {
+	deletions := NewStorageDeletions(keys)
+	if err := c.deletionRepo.Create(ctx, deletions); err != nil {
+		return err
+	}
+	c.Purge(ctx, deletions)
+	return nil
+}
+
+// Run retries due deletions periodically until ctx is cancelled
+func (c *StorageCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deletions, err := c.deletionRepo.ListDue(ctx, time.Now(), cleanupBatchSize)
+			if err != nil {
+				c.logger.WithError(err).Error("Failed to list pending storage deletions")
+				continue
+			}
+			c.Purge(ctx, deletions)
+		}
+	}
+}
+
+// Purge deletes the objects and returns how many were removed. Failed
+// deletions stay recorded and are rescheduled.
+func (c *StorageCleaner) Purge(ctx context.Context, deletions []*domain.StorageDeletion) int {
+	purged := 0
+	for _, d := range deletions {
+		logger := c.logger.WithField("object_key", d.ObjectKey)
+
+		if err := c.storage.DeleteObject(ctx, d.ObjectKey); err != nil {
+			attempts := d.Attempts + 1
+			if attempts >= cleanupAlertAfter {
+				logger.WithError(err).WithField("attempts", attempts).Error("Storage object still not deleted")
+			} else {
+				logger.WithError(err).Warn("Failed to delete storage object, will retry")
+			}
+			if err := c.deletionRepo.MarkFailed(ctx, d.ID, err.Error(), time.Now().Add(retryDelay(attempts))); err != nil {
+				logger.WithError(err).Error("Failed to reschedule storage deletion")
+			}
+			continue
+		}
+
+		if err := c.deletionRepo.Delete(ctx, d.ID); err != nil {
+			// The object is gone; retrying the delete later is harmless
+			logger.WithError(err).Warn("Failed to clear storage deletion record")
+		}
+		purged++
+	}
+	return purged
+}
+
+// retryDelay doubles the delay with every attempt, up to cleanupMaxDelay
+func retryDelay(attempts int) time.Duration {
+	delay := cleanupBaseDelay
+	for i := 1; i < attempts && delay < cleanupMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > cleanupMaxDelay {
+		delay = cleanupMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/core/domain"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/internal/repository"
+	"github.com/TinySchoolHub/tiny-school-hub-api-backend/pkg/log"
+)
+
+type fakeDeletionRepo struct {
+	repository.StorageDeletionRepository
+	created []*domain.StorageDeletion
+	deleted map[uuid.UUID]bool
+	failed  map[uuid.UUID]time.Time
+}
+
+func newFakeDeletionRepo() *fakeDeletionRepo {
+	return &fakeDeletionRepo{deleted: map[uuid.UUID]bool{}, failed: map[uuid.UUID]time.Time{}}
+}
+
+func (f *fakeDeletionRepo) Create(_ context.Context, deletions []*domain.StorageDeletion) error {
+	f.created = append(f.created, deletions...)
+	return nil
+}
+
+func (f *fakeDeletionRepo) MarkFailed(_ context.Context, id uuid.UUID, _ string, nextAttemptAt time.Time) error {
+	f.failed[id] = nextAttemptAt
+	return nil
+}
+
+func (f *fakeDeletionRepo) Delete(_ context.Context, id uuid.UUID) error {
+	f.deleted[id] = true
+	return nil
+}
+
+func TestStorageCleaner_Purge(t *testing.T) {
+	deletions := NewStorageDeletions([]string{"photos/a", "photos/b"})
+	repo := newFakeDeletionRepo()
+	store := &fakeStorage{failFor: "photos/b"}
+
+	cleaner := NewStorageCleaner(repo, store, time.Minute, log.New("error", "json"))
+
+	if purged := cleaner.Purge(context.Background(), deletions); purged != 1 {
+		t.Errorf("Purge() = %d, want 1", purged)
+	}
+	if !repo.deleted[deletions[0].ID] {
+		t.Error("record for a deleted object should be cleared")
+	}
+	if repo.deleted[deletions[1].ID] {
+		t.Error("record for a failed deletion must be kept")
+	}
+	if next, ok := repo.failed[deletions[1].ID]; !ok || !next.After(time.Now()) {
+		t.Error("failed deletion should be rescheduled in the future")
+	}
+}
+
+func TestNewStorageDeletions(t *testing.T) {
+	deletions := NewStorageDeletions([]string{"photos/a"})
+	if len(deletions) != 1 {
+		t.Fatalf("NewStorageDeletions() returned %d records, want 1", len(deletions))
+	}
+
+	d := deletions[0]
+	if d.ID == uuid.Nil || d.ObjectKey != "photos/a" || d.Attempts != 0 {
+		t.Errorf("unexpected deletion record: %+v", d)
+	}
+	if d.NextAttemptAt.After(time.Now()) {
+		t.Error("new deletions should be due immediately")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{30, cleanupMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestStorageCleaner_Schedule(t *testing.T) {
+	repo := newFakeDeletionRepo()
+	store := &fakeStorage{}
+	cleaner := NewStorageCleaner(repo, store, time.Minute, log.New("error", "json"))
+
+	at := time.Now().Add(time.Hour)
+	if err := cleaner.Schedule(context.Background(), []string{"avatars/a"}, at); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if len(repo.created) != 1 || !repo.created[0].NextAttemptAt.Equal(at) {
+		t.Errorf("Schedule() recorded %v, want one deletion due at %v", repo.created, at)
+	}
+	if len(store.deleted) != 0 {
+		t.Errorf("Schedule() deleted %v before the deletion is due", store.deleted)
+	}
+}
+
+func TestStorageCleaner_Remove(t *testing.T) {
+	repo := newFakeDeletionRepo()
+	store := &fakeStorage{failFor: "avatars/b"}
+	cleaner := NewStorageCleaner(repo, store, time.Minute, log.New("error", "json"))
+
+	if err := cleaner.Remove(context.Background(), []string{"avatars/a", "avatars/b"}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if len(repo.created) != 2 {
+		t.Fatalf("Remove() recorded %d deletions, want 2", len(repo.created))
+	}
+	if !repo.deleted[repo.created[0].ID] {
+		t.Error("record for a deleted object should be cleared")
+	}
+	if _, ok := repo.failed[repo.created[1].ID]; !ok {
+		t.Error("failed deletion should stay recorded for a retry")
+	}
+}
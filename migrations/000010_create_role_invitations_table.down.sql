@@ -0,0 +1,4 @@
+-- Drop role_invitations table
+DROP INDEX IF EXISTS idx_role_invitations_created_by;
+DROP INDEX IF EXISTS idx_role_invitations_email;
+DROP TABLE IF EXISTS role_invitations;
@@ -0,0 +1,17 @@
+-- Create role_invitations table
+CREATE TABLE IF NOT EXISTS role_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('TEACHER', 'PARENT', 'ADMIN')),
+    token_hash TEXT NOT NULL UNIQUE,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    used_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for efficient lookups
+CREATE INDEX idx_role_invitations_email ON role_invitations(email);
+CREATE INDEX idx_role_invitations_created_by ON role_invitations(created_by);
@@ -0,0 +1,3 @@
+-- Drop role_changes table
+DROP INDEX IF EXISTS idx_role_changes_user_id;
+DROP TABLE IF EXISTS role_changes;
@@ -0,0 +1,3 @@
+-- Drop class_invites table
+DROP INDEX IF EXISTS idx_class_invites_class_id;
+DROP TABLE IF EXISTS class_invites;
@@ -0,0 +1,5 @@
+-- Drop class_join_requests table
+DROP INDEX IF EXISTS idx_class_join_requests_user_id;
+DROP INDEX IF EXISTS idx_class_join_requests_class_id;
+DROP INDEX IF EXISTS idx_class_join_requests_pending;
+DROP TABLE IF EXISTS class_join_requests;
@@ -0,0 +1,18 @@
+-- Create class_join_requests table
+CREATE TABLE IF NOT EXISTS class_join_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    class_id UUID NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    invite_id UUID REFERENCES class_invites(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'APPROVED', 'REJECTED')),
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Only one open request per user and class
+CREATE UNIQUE INDEX idx_class_join_requests_pending ON class_join_requests(class_id, user_id) WHERE status = 'PENDING';
+
+-- Create indexes for efficient lookups
+CREATE INDEX idx_class_join_requests_class_id ON class_join_requests(class_id, status);
+CREATE INDEX idx_class_join_requests_user_id ON class_join_requests(user_id);
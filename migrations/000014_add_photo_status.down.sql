@@ -0,0 +1,3 @@
+-- Remove photo status
+DROP INDEX IF EXISTS idx_photos_pending;
+ALTER TABLE photos DROP COLUMN IF EXISTS status;
@@ -0,0 +1,8 @@
+-- Photos start as PENDING until the client confirms the upload. Existing
+-- photos predate the confirmation step and are treated as READY.
+ALTER TABLE photos ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'READY'
+    CONSTRAINT photos_status_check CHECK (status IN ('PENDING', 'READY'));
+ALTER TABLE photos ALTER COLUMN status SET DEFAULT 'PENDING';
+
+-- Create index for the pending upload sweeper
+CREATE INDEX idx_photos_pending ON photos(created_at) WHERE status = 'PENDING';
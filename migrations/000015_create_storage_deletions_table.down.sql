@@ -0,0 +1,3 @@
+-- Drop storage_deletions table
+DROP INDEX IF EXISTS idx_storage_deletions_next_attempt_at;
+DROP TABLE IF EXISTS storage_deletions;
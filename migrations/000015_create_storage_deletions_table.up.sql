@@ -0,0 +1,13 @@
+-- Create storage_deletions table. Rows are written in the same transaction
+-- that deletes the owning record and removed once the object is gone.
+CREATE TABLE IF NOT EXISTS storage_deletions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    object_key TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create index for the retry worker
+CREATE INDEX idx_storage_deletions_next_attempt_at ON storage_deletions(next_attempt_at);
@@ -0,0 +1,4 @@
+-- Remove photo variant tracking
+DROP INDEX IF EXISTS idx_photos_unprocessed;
+ALTER TABLE photos DROP COLUMN IF EXISTS processing_attempts;
+ALTER TABLE photos DROP COLUMN IF EXISTS variants_ready;
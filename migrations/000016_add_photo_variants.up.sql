@@ -0,0 +1,7 @@
+-- Track generation of resized photo variants. Existing photos are picked up
+-- by the background processor as well.
+ALTER TABLE photos ADD COLUMN variants_ready BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE photos ADD COLUMN processing_attempts INTEGER NOT NULL DEFAULT 0;
+
+-- Create index for the variant processor
+CREATE INDEX idx_photos_unprocessed ON photos(created_at) WHERE status = 'READY' AND NOT variants_ready;
@@ -0,0 +1,11 @@
+-- Remove photo sanitization tracking. Sanitized photos keep serving their raw
+-- upload key afterwards, which the processor has already deleted.
+DROP INDEX IF EXISTS idx_photos_processing;
+CREATE INDEX idx_photos_unprocessed ON photos(created_at) WHERE status = 'READY' AND NOT variants_ready;
+
+UPDATE photos SET status = 'READY' WHERE status = 'PROCESSING';
+
+ALTER TABLE photos DROP CONSTRAINT photos_status_check;
+ALTER TABLE photos ADD CONSTRAINT photos_status_check CHECK (status IN ('PENDING', 'READY'));
+
+ALTER TABLE photos DROP COLUMN IF EXISTS sanitized;
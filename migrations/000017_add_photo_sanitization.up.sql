@@ -0,0 +1,13 @@
+-- Uploaded photos are sanitized (EXIF, XMP and GPS metadata removed) before
+-- they become visible. Photos that were already served unsanitized are hidden
+-- again until the processor has cleaned them.
+ALTER TABLE photos ADD COLUMN sanitized BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE photos DROP CONSTRAINT photos_status_check;
+ALTER TABLE photos ADD CONSTRAINT photos_status_check CHECK (status IN ('PENDING', 'PROCESSING', 'READY'));
+
+UPDATE photos SET status = 'PROCESSING', processing_attempts = 0 WHERE status = 'READY';
+
+-- Replace the variant processor index
+DROP INDEX IF EXISTS idx_photos_unprocessed;
+CREATE INDEX idx_photos_processing ON photos(created_at) WHERE status = 'PROCESSING';
@@ -0,0 +1,10 @@
+-- Group rotated refresh tokens into families. Existing tokens each start their
+-- own family.
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+UPDATE refresh_tokens SET family_id = id;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN parent_id UUID REFERENCES refresh_tokens(id) ON DELETE SET NULL;
+
+-- Create index for family revocation
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
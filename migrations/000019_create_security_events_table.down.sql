@@ -0,0 +1,3 @@
+-- Drop security_events table
+DROP INDEX IF EXISTS idx_security_events_user_id;
+DROP TABLE IF EXISTS security_events;
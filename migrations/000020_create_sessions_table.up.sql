@@ -0,0 +1,25 @@
+-- Create sessions table. A session is one login on one device; its refresh
+-- tokens share the session ID as their family ID.
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Existing token families become sessions without device information
+INSERT INTO sessions (id, user_id, created_at, last_used_at, expires_at, revoked_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at), MAX(expires_at),
+       CASE WHEN BOOL_AND(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_family_id_fkey
+    FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+-- Create index for listing a user's active sessions
+CREATE INDEX idx_sessions_user_id ON sessions(user_id) WHERE revoked_at IS NULL;
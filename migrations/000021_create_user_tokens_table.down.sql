@@ -0,0 +1,3 @@
+-- Drop user_tokens table
+DROP INDEX IF EXISTS idx_user_tokens_user_purpose;
+DROP TABLE IF EXISTS user_tokens;
@@ -0,0 +1,14 @@
+-- Create user_tokens table for single-use tokens sent by email, such as
+-- password reset links
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(30) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create index for invalidating a user's outstanding tokens
+CREATE INDEX idx_user_tokens_user_purpose ON user_tokens(user_id, purpose) WHERE used_at IS NULL;
@@ -0,0 +1,3 @@
+-- Remove email verification tracking
+ALTER TABLE users DROP COLUMN IF EXISTS verified_at;
+DELETE FROM user_tokens WHERE purpose = 'EMAIL_VERIFICATION';
@@ -0,0 +1,5 @@
+-- Track when users verified their email address
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Accounts created before verification existed are treated as verified
+UPDATE users SET verified_at = created_at;
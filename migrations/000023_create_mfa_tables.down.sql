@@ -0,0 +1,4 @@
+-- Drop two-factor authentication tables
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS mfa_factors;
@@ -0,0 +1,10 @@
+-- Create login_failures table counting recent failed logins per account
+-- (email address) and per client IP for brute-force lockouts
+CREATE TABLE IF NOT EXISTS login_failures (
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('ACCOUNT', 'IP')),
+    key VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,9 @@
+-- Create rate_limits table counting requests per fixed window, shared by all
+-- API instances, e.g. magic link requests per email address and client IP
+CREATE TABLE IF NOT EXISTS rate_limits (
+    scope VARCHAR(30) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, key)
+);
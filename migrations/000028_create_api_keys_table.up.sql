@@ -0,0 +1,19 @@
+-- Create api_keys table for admin-managed keys that let integrations such as
+-- a school information system call the API as a user. Only the hash of a key
+-- is stored; scopes and allowed_ips are JSON arrays.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes JSONB NOT NULL,
+    allowed_ips JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
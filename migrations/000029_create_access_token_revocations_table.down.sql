@@ -0,0 +1,2 @@
+-- Drop access_token_revocations table
+DROP TABLE IF EXISTS access_token_revocations;
@@ -0,0 +1,9 @@
+-- Create access_token_revocations table. Access tokens of a user issued before
+-- valid_after are rejected. Rows are kept when the user is deleted, so there
+-- is no foreign key; rows older than the access token lifetime have no effect.
+CREATE TABLE IF NOT EXISTS access_token_revocations (
+    user_id UUID PRIMARY KEY,
+    valid_after TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_access_token_revocations_valid_after ON access_token_revocations(valid_after);
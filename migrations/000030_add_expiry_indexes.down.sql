@@ -0,0 +1,4 @@
+-- Drop expiry indexes of short-lived login rows
+DROP INDEX IF EXISTS idx_mfa_challenges_expires_at;
+DROP INDEX IF EXISTS idx_webauthn_challenges_expires_at;
+DROP INDEX IF EXISTS idx_oidc_login_states_expires_at;
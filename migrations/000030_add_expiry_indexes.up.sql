@@ -0,0 +1,5 @@
+-- Index the expiry of short-lived login rows, which are deleted periodically
+-- once they expire
+CREATE INDEX idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
+CREATE INDEX idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
+CREATE INDEX idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
@@ -0,0 +1,2 @@
+-- Drop the storage deletions object key index
+DROP INDEX IF EXISTS idx_storage_deletions_object_key;
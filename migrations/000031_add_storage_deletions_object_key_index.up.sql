@@ -0,0 +1,3 @@
+-- Index storage deletions by object key, so the deletion scheduled for an
+-- avatar upload can be cancelled once the avatar is set
+CREATE INDEX idx_storage_deletions_object_key ON storage_deletions(object_key);